@@ -0,0 +1,60 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/labbsr0x/bindman-dns-bind9/manager"
+	"github.com/labbsr0x/bindman-dns-webhook/src/hook/metrics"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Address the address the HTTP REST API listens on
+const Address = "0.0.0.0:7070"
+
+// API serves the HTTP REST API of a Bind9Manager
+type API struct {
+	Manager *manager.Bind9Manager
+}
+
+// New creates a new API
+func New(m *manager.Bind9Manager) (*API, error) {
+	if m == nil {
+		return nil, errors.New("not possible to start the API; API expects a valid non-nil Bind9Manager")
+	}
+	return &API{Manager: m}, nil
+}
+
+// Router builds the router exposing the API endpoints
+func (a *API) Router(prometheus *metrics.Prometheus) *mux.Router {
+	router := mux.NewRouter()
+	router.Handle(prometheus.HandleFunc("/records", a.GetDNSRecords)).Methods("GET")
+	router.HandleFunc(prometheus.HandleFunc("/records/{name}/{type}", a.GetDNSRecord)).Methods("GET")
+	router.HandleFunc(prometheus.HandleFunc("/records/{name}/{type}", a.RemoveDNSRecord)).Methods("DELETE")
+	router.HandleFunc(prometheus.HandleFunc("/records/{name}/{type}/propagation", a.GetPropagation)).Methods("GET")
+	router.HandleFunc(prometheus.HandleFunc("/records/{name}/{type}/lookup", a.LookupDNSRecord)).Methods("GET")
+	router.HandleFunc(prometheus.HandleFunc("/records", a.AddDNSRecord)).Methods("POST")
+	router.HandleFunc(prometheus.HandleFunc("/records", a.UpdateDNSRecord)).Methods("PUT")
+	router.HandleFunc(prometheus.HandleFunc("/operations/{id}", a.GetOperation)).Methods("GET")
+	router.HandleFunc(prometheus.HandleFunc("/removals", a.GetRemovals)).Methods("GET")
+	router.HandleFunc(prometheus.HandleFunc("/plan", a.PlanChanges)).Methods("POST")
+	router.HandleFunc(prometheus.HandleFunc("/apply", a.ApplyChanges)).Methods("POST")
+	router.HandleFunc(prometheus.HandleFunc("/filesource", a.GetFileSourceStatus)).Methods("GET")
+	// not instrumented, as the response writer of the instrumentation cannot be flushed and the stream would never be sent
+	router.HandleFunc("/events", a.GetEvents).Methods("GET")
+
+	// exposes /metrics endpoint with standard golang metrics used by prometheus
+	router.Handle("/metrics", promhttp.Handler())
+	return router
+}
+
+// Server builds the HTTP server of the API, listening on Address. The change streams are closed and the requests waiting
+// for a change to be propagated are released when it shuts down
+func (a *API) Server(serviceVersion string) *http.Server {
+	server := &http.Server{Addr: Address, Handler: a.Router(metrics.New(serviceVersion))}
+	// the change streams and the requests waiting for the propagation would otherwise keep the server from shutting down
+	server.RegisterOnShutdown(a.Manager.CloseEvents)
+	server.RegisterOnShutdown(a.Manager.StopPropagation)
+	return server
+}
@@ -0,0 +1,379 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labbsr0x/bindman-dns-bind9/manager"
+	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
+	"github.com/labbsr0x/bindman-dns-webhook/src/hook/metrics"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const basePath = "./data"
+
+var prometheus = metrics.New("test")
+
+func TestMain(m *testing.M) {
+	exitCode := m.Run()
+	_ = os.RemoveAll(basePath)
+	os.Exit(exitCode)
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(nil); err == nil {
+		t.Error("api.New should return an error in face of a nil Bind9Manager")
+	}
+}
+
+func TestRecordsHandlers(t *testing.T) {
+	router, _ := initRouter(t)
+	record := hookTypes.DNSRecord{Name: "api.test.com", Value: "0.0.0.0", Type: "A"}
+
+	res := serve(router, http.MethodPost, "/records", record)
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d adding a record, got %d: %s", http.StatusNoContent, res.Code, res.Body.String())
+	}
+
+	res = serve(router, http.MethodGet, "/records/api.test.com/A", nil)
+	var got hookTypes.DNSRecord
+	if res.Code != http.StatusOK || json.NewDecoder(res.Body).Decode(&got) != nil || got != record {
+		t.Errorf("expected the record %v to be retrieved, got status %d and record %v", record, res.Code, got)
+	}
+
+	record.Value = "127.0.0.1"
+	if res = serve(router, http.MethodPut, "/records", record); res.Code != http.StatusNoContent {
+		t.Errorf("expected status %d updating a record, got %d: %s", http.StatusNoContent, res.Code, res.Body.String())
+	}
+
+	res = serve(router, http.MethodGet, "/records", nil)
+	var list []hookTypes.DNSRecord
+	if res.Code != http.StatusOK || json.NewDecoder(res.Body).Decode(&list) != nil || len(list) != 1 || list[0] != record {
+		t.Errorf("expected the list to hold exactly the updated record %v, got status %d and list %v", record, res.Code, list)
+	}
+
+	if res = serve(router, http.MethodDelete, "/records/api.test.com/A", nil); res.Code != http.StatusNoContent {
+		t.Errorf("expected status %d removing a record, got %d: %s", http.StatusNoContent, res.Code, res.Body.String())
+	}
+
+	if res = serve(router, http.MethodGet, "/records/api.test.com/A", nil); res.Code != http.StatusNotFound {
+		t.Errorf("expected status %d getting a removed record, got %d", http.StatusNotFound, res.Code)
+	}
+
+	res = serve(router, http.MethodGet, "/removals", nil)
+	var removals removalsResponse
+	if res.Code != http.StatusOK || json.NewDecoder(res.Body).Decode(&removals) != nil || len(removals.Pending) != 1 || removals.Pending[0].Name != record.Name {
+		t.Errorf("expected the removal of the record to be pending, got status %d and %v", res.Code, removals)
+	}
+}
+
+func TestApexAndWildcardPaths(t *testing.T) {
+	router, _ := initRouter(t)
+	records := []hookTypes.DNSRecord{
+		{Name: "test.com", Value: "v=spf1 -all", Type: "TXT"},
+		{Name: "*.apps.test.com", Value: "0.0.0.0", Type: "A"},
+	}
+
+	for _, record := range records {
+		if res := serve(router, http.MethodPost, "/records", record); res.Code != http.StatusNoContent {
+			t.Fatalf("expected status %d adding '%s', got %d: %s", http.StatusNoContent, record.Name, res.Code, res.Body.String())
+		}
+		res := serve(router, http.MethodGet, "/records/"+record.Name+"/"+record.Type, nil)
+		var got hookTypes.DNSRecord
+		if res.Code != http.StatusOK || json.NewDecoder(res.Body).Decode(&got) != nil || got != record {
+			t.Errorf("expected the record %v to be retrieved by its name, got status %d and record %v", record, res.Code, got)
+		}
+		if res = serve(router, http.MethodDelete, "/records/"+record.Name+"/"+record.Type, nil); res.Code != http.StatusNoContent {
+			t.Errorf("expected status %d removing '%s', got %d: %s", http.StatusNoContent, record.Name, res.Code, res.Body.String())
+		}
+	}
+}
+
+func TestListRecordsFilters(t *testing.T) {
+	router, _ := initRouter(t)
+	records := []manager.Record{
+		{DNSRecord: hookTypes.DNSRecord{Name: "a.api.test.com", Value: "0.0.0.1", Type: "A"}, Labels: map[string]string{"env": "prod"}},
+		{DNSRecord: hookTypes.DNSRecord{Name: "b.api.test.com", Value: "0.0.0.2", Type: "A"}, Labels: map[string]string{"env": "prod"}},
+		{DNSRecord: hookTypes.DNSRecord{Name: "c.api.test.com", Value: "0.0.0.3", Type: "A"}, Labels: map[string]string{"env": "dev"}},
+	}
+	for _, r := range records {
+		if res := serve(router, http.MethodPost, "/records", r); res.Code != http.StatusNoContent {
+			t.Fatalf("expected status %d adding a record, got %d: %s", http.StatusNoContent, res.Code, res.Body.String())
+		}
+	}
+
+	res := serve(router, http.MethodGet, "/records?label=env%3Dprod&sort=-name&limit=1", nil)
+	var page []manager.Record
+	if res.Code != http.StatusOK || json.NewDecoder(res.Body).Decode(&page) != nil || len(page) != 1 || page[0].Name != "b.api.test.com" || page[0].Labels["env"] != "prod" {
+		t.Fatalf("expected the first page to hold the labelled record b.api.test.com, got status %d and %v", res.Code, page)
+	}
+	next := res.Header().Get("X-Next-Cursor")
+	if next == "" {
+		t.Fatal("expected the cursor of the next page to be sent")
+	}
+
+	res = serve(router, http.MethodGet, "/records?label=env%3Dprod&sort=-name&limit=1&cursor="+next, nil)
+	if res.Code != http.StatusOK || json.NewDecoder(res.Body).Decode(&page) != nil || len(page) != 1 || page[0].Name != "a.api.test.com" {
+		t.Errorf("expected the second page to hold a.api.test.com, got status %d and %v", res.Code, page)
+	}
+	if res.Header().Get("X-Next-Cursor") != "" {
+		t.Error("expected no cursor on the last page")
+	}
+
+	for _, query := range []string{"limit=-1", "label=env", "sort=ttl", "glob=%5B"} {
+		if res = serve(router, http.MethodGet, "/records?"+query, nil); res.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d for the query '%s', got %d", http.StatusBadRequest, query, res.Code)
+		}
+	}
+}
+
+func TestInvalidRecordBody(t *testing.T) {
+	router, _ := initRouter(t)
+
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		if res := serve(router, method, "/records", hookTypes.DNSRecord{Name: "api.test.com"}); res.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", method, http.StatusBadRequest, res.Code)
+		}
+		if res := serve(router, method, "/records", "invalid format"); res.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", method, http.StatusBadRequest, res.Code)
+		}
+	}
+}
+
+func TestStructuredDataBody(t *testing.T) {
+	router, _ := initRouter(t)
+
+	body := `{"name": "_sip._tcp.test.com", "type": "SRV", "data": {"priority": 10, "weight": 5, "port": 5060, "target": "sip.test.com"}}`
+	if res := serve(router, http.MethodPost, "/records", json.RawMessage(body)); res.Code != http.StatusNoContent {
+		t.Fatalf("Expecting the record without a value to be added from its data. Got status %d: %s", res.Code, res.Body)
+	}
+	res := serve(router, http.MethodGet, "/records/_sip._tcp.test.com/SRV", nil)
+	var record manager.Record
+	_ = json.NewDecoder(res.Body).Decode(&record)
+	if record.Value != "10 5 5060 sip.test.com." {
+		t.Errorf("Expecting the value to be rendered from the data. Got '%s'", record.Value)
+	}
+
+	body = `{"name": "_sip._tcp.test.com", "type": "SRV", "data": {"priority": 10, "target": "sip.test.com"}}`
+	if res := serve(router, http.MethodPut, "/records", json.RawMessage(body)); res.Code != http.StatusBadRequest {
+		t.Errorf("Expecting invalid data to be rejected. Got status %d", res.Code)
+	}
+}
+
+func TestPlanAndApply(t *testing.T) {
+	router, _ := initRouter(t)
+	_ = serve(router, http.MethodPost, "/records", hookTypes.DNSRecord{Name: "old.test.com", Value: "0.0.0.1", Type: "A"})
+
+	state := manager.DesiredState{Scope: "test.com", Records: []manager.Record{
+		{DNSRecord: hookTypes.DNSRecord{Name: "app.test.com", Value: "0.0.0.2", Type: "A"}},
+	}}
+	res := serve(router, http.MethodPost, "/plan", state)
+	var plan manager.Plan
+	if res.Code != http.StatusOK || json.NewDecoder(res.Body).Decode(&plan) != nil || plan.Adds != 1 || plan.Removals != 1 {
+		t.Fatalf("Expecting the plan to add app.test.com and remove old.test.com. Got status %d and %+v", res.Code, plan)
+	}
+
+	state.Plan = plan.ID
+	res = serve(router, http.MethodPost, "/apply", state)
+	var applied manager.Plan
+	if res.Code != http.StatusOK || json.NewDecoder(res.Body).Decode(&applied) != nil || applied.ID != plan.ID {
+		t.Fatalf("Expecting the plan to be applied. Got status %d: %s", res.Code, res.Body)
+	}
+	if res = serve(router, http.MethodGet, "/records/old.test.com/A", nil); res.Code != http.StatusNotFound {
+		t.Errorf("Expecting old.test.com to be removed. Got status %d", res.Code)
+	}
+	if res = serve(router, http.MethodPost, "/apply", state); res.Code != http.StatusConflict {
+		t.Errorf("Expecting the plan applied to be stale. Got status %d", res.Code)
+	}
+	if res = serve(router, http.MethodPost, "/plan", "invalid format"); res.Code != http.StatusBadRequest {
+		t.Errorf("Expecting an invalid desired state to be rejected. Got status %d", res.Code)
+	}
+}
+
+func TestFileSourceStatus(t *testing.T) {
+	router, _ := initRouter(t)
+	if res := serve(router, http.MethodGet, "/filesource", nil); res.Code != http.StatusNotFound {
+		t.Errorf("Expecting the status of a disabled file source not to be found. Got status %d", res.Code)
+	}
+}
+
+func TestClientDisconnectCancelsUpdate(t *testing.T) {
+	router, updater := initRouter(t)
+	updater.Block = true
+
+	var buf bytes.Buffer
+	_ = json.NewEncoder(&buf).Encode(hookTypes.DNSRecord{Name: "slow.test.com", Value: "0.0.0.0", Type: "A"})
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodPost, "/records", &buf).WithContext(ctx)
+	res := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		router.ServeHTTP(res, req)
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+		if res.Code != http.StatusInternalServerError {
+			t.Errorf("expected status %d, got %d", http.StatusInternalServerError, res.Code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the update to be interrupted when the client disconnects")
+	}
+}
+
+func TestAsyncMode(t *testing.T) {
+	router, _ := initRouterWithBuilder(t, &manager.Builder{TTL: time.Hour, RemovalDelay: time.Hour, Async: true, QueueSize: 10, QueueWorkers: 1, OperationRetention: time.Hour})
+	record := hookTypes.DNSRecord{Name: "async.test.com", Value: "0.0.0.0", Type: "A"}
+
+	res := serve(router, http.MethodPost, "/records", record)
+	var op manager.Operation
+	if res.Code != http.StatusAccepted || json.NewDecoder(res.Body).Decode(&op) != nil {
+		t.Fatalf("expected status %d and an operation, got %d: %s", http.StatusAccepted, res.Code, res.Body.String())
+	}
+	if location := res.Header().Get("Location"); location != "/operations/"+op.ID {
+		t.Errorf("expected the Location header to point to the operation, got '%s'", location)
+	}
+
+	for i := 0; i < 100 && op.Status == manager.StatusPending; i++ {
+		time.Sleep(10 * time.Millisecond)
+		res = serve(router, http.MethodGet, "/operations/"+op.ID, nil)
+		if res.Code != http.StatusOK || json.NewDecoder(res.Body).Decode(&op) != nil {
+			t.Fatalf("expected status %d getting the operation, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+		}
+	}
+	if op.Status != manager.StatusApplied {
+		t.Errorf("expected the operation to be applied, got '%s'", op.Status)
+	}
+
+	if res = serve(router, http.MethodGet, "/operations/unknown", nil); res.Code != http.StatusNotFound {
+		t.Errorf("expected status %d getting an unknown operation, got %d", http.StatusNotFound, res.Code)
+	}
+}
+
+func initRouter(t *testing.T) (http.Handler, *mockDNSUpdater) {
+	return initRouterWithBuilder(t, &manager.Builder{TTL: time.Hour, RemovalDelay: time.Hour})
+}
+
+func initRouterWithBuilder(t *testing.T, builder *manager.Builder) (http.Handler, *mockDNSUpdater) {
+	updater := new(mockDNSUpdater)
+	_ = os.RemoveAll(basePath)
+	m, err := builder.New(updater, basePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.Router(prometheus), updater
+}
+
+func serve(router http.Handler, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(method, path, &buf))
+	return res
+}
+
+// mockDNSUpdater defines a mock NSUpdate for unit testing the API; when Block is set, calls wait for the context to be done
+type mockDNSUpdater struct {
+	Block bool
+}
+
+func (m *mockDNSUpdater) wait(ctx context.Context) error {
+	if m.Block {
+		<-ctx.Done()
+	}
+	return ctx.Err()
+}
+
+func (m *mockDNSUpdater) AddRR(ctx context.Context, _ hookTypes.DNSRecord, _ time.Duration) error {
+	return m.wait(ctx)
+}
+
+func (m *mockDNSUpdater) RemoveRR(ctx context.Context, _, _ string) error {
+	return m.wait(ctx)
+}
+
+func (m *mockDNSUpdater) UpdateRR(ctx context.Context, _ hookTypes.DNSRecord, _ time.Duration) error {
+	return m.wait(ctx)
+}
+
+func (m *mockDNSUpdater) ApplyChanges(ctx context.Context, _ []nsupdate.Change, _ time.Duration) error {
+	return m.wait(ctx)
+}
+
+func TestEventsStream(t *testing.T) {
+	router, _ := initRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	for _, name := range []string{"a.other.com", "b.test.com"} {
+		if res := serve(router, http.MethodPost, "/records", hookTypes.DNSRecord{Name: name, Value: "0.0.0.0", Type: "A"}); res.Code != http.StatusNoContent {
+			t.Fatalf("expected status %d adding '%s', got %d: %s", http.StatusNoContent, name, res.Code, res.Body.String())
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/events?suffix=test.com", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d with '%s'", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	if res := serve(router, http.MethodDelete, "/records/b.test.com/A", nil); res.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d removing the record, got %d: %s", http.StatusNoContent, res.Code, res.Body.String())
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	expected := []string{"id: 2", "event: add", "", "", "id: 3", "event: remove-scheduled", "", ""}
+	for i, want := range expected {
+		if !scanner.Scan() {
+			t.Fatalf("expected the line '%s', got the end of the stream: %v", want, scanner.Err())
+		}
+		if line := scanner.Text(); want != "" && line != want {
+			t.Errorf("expected the line %d to be '%s', got '%s'", i, want, line)
+		} else if i%4 == 2 && !strings.Contains(line, `"name":"b.test.com"`) {
+			t.Errorf("expected the data of the b.test.com record, got '%s'", line)
+		}
+	}
+}
+
+func TestEventsResume(t *testing.T) {
+	router, _ := initRouter(t)
+	tests := []struct {
+		since    string
+		expected int
+	}{
+		{"abc", http.StatusBadRequest},
+		{"99", http.StatusGone},
+	}
+
+	for _, test := range tests {
+		t.Run(test.since, func(t *testing.T) {
+			if res := serve(router, http.MethodGet, "/events?since="+test.since, nil); res.Code != test.expected {
+				t.Errorf("expected status %d, got %d: %s", test.expected, res.Code, res.Body.String())
+			}
+		})
+	}
+}
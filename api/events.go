@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labbsr0x/bindman-dns-bind9/manager"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+// keepAliveInterval how often a comment is sent on an idle change stream, so proxies do not close it
+const keepAliveInterval = 15 * time.Second
+
+// GetEvents streams the changes to the records as Server-Sent Events, each with the sequence number as its id, the change as its
+// event type and the JSON formatted manager.Event as its data. The stream resumes after the sequence number sent in the
+// Last-Event-ID header or the since query param; the suffix and type query params filter the records
+func (a *API) GetEvents(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+	logrus.Infof("GetEvents call. Http Request: %v", r)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		hookTypes.PanicIfError(hookTypes.InternalServerError("Streaming is not supported", nil))
+	}
+
+	query := r.URL.Query()
+	filter := manager.EventFilter{Type: query.Get("type"), NameSuffix: query.Get("suffix")}
+	since := r.Header.Get("Last-Event-ID")
+	if since == "" {
+		since = query.Get("since")
+	}
+	var seq uint64
+	if since != "" {
+		var err error
+		if seq, err = strconv.ParseUint(since, 10, 64); err != nil {
+			hookTypes.PanicIfError(hookTypes.BadRequestError("Invalid sequence number. It must be a non-negative integer", err))
+		}
+	}
+
+	sub, err := a.Manager.SubscribeEvents(filter, seq)
+	hookTypes.PanicIfError(err)
+	defer a.Manager.UnsubscribeEvents(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	for _, event := range sub.Replay {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes the event in the Server-Sent Events format
+func writeEvent(w http.ResponseWriter, event manager.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data)
+	return err
+}
@@ -0,0 +1,17 @@
+package api
+
+import (
+	"net/http"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+// GetFileSourceStatus gets the status of the last convergence of the records to the record files of the file source, along with the problems of each file
+func (a *API) GetFileSourceStatus(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+	logrus.Infof("GetFileSourceStatus call. Http Request: %v", r)
+	resp, err := a.Manager.GetFileSourceStatus()
+	hookTypes.PanicIfError(err)
+	writeJSONResponse(resp, http.StatusOK, w)
+}
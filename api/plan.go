@@ -0,0 +1,42 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/labbsr0x/bindman-dns-bind9/manager"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+// PlanChanges computes the changes turning the records of a scope into the desired ones, leaving the records untouched.
+// Expects a DesiredState object as a body payload
+func (a *API) PlanChanges(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+	logrus.Infof("PlanChanges call. Http Request: %v", r)
+	resp, err := a.Manager.PlanChanges(r.Context(), decodeDesiredState(r))
+	hookTypes.PanicIfError(err)
+	writeJSONResponse(resp, http.StatusOK, w)
+}
+
+// ApplyChanges applies at once the changes turning the records of a scope into the desired ones, answering with the changes applied.
+// Expects a DesiredState object as a body payload
+func (a *API) ApplyChanges(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+	logrus.Infof("ApplyChanges call. Http Request: %v", r)
+	ctx, verification := manager.WithVerification(r.Context())
+	resp, err := a.Manager.ApplyChanges(ctx, decodeDesiredState(r))
+	if outcome := verification(); outcome != "" {
+		w.Header().Set(manager.VerificationHeader, outcome)
+	}
+	hookTypes.PanicIfError(err)
+	writeJSONResponse(resp, http.StatusOK, w)
+}
+
+// decodeDesiredState reads the desired state sent as the request body payload; it panics with a bad request error if the payload is not valid
+func decodeDesiredState(r *http.Request) (state manager.DesiredState) {
+	if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+		hookTypes.PanicIfError(hookTypes.BadRequestError("Invalid request body. You must pass a JSON formatted desired state on request body", err))
+	}
+	return
+}
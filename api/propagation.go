@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPropagationTimeout = 30 * time.Second
+	maxPropagationTimeout     = 5 * time.Minute
+)
+
+// GetPropagation gets the propagation of the last change to a record to the secondary nameservers, or of the change whose
+// event has the sequence number of the seq query param. With the wait query param set to true, it answers once the change is propagated or the timeout query param is exceeded, answering with the propagation as it is then
+func (a *API) GetPropagation(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+	logrus.Infof("GetPropagation call. Http Request: %v", r)
+	vars := mux.Vars(r)
+	wait, timeout := decodeWait(r)
+	var seq uint64
+	if value := r.URL.Query().Get("seq"); value != "" {
+		var err error
+		if seq, err = strconv.ParseUint(value, 10, 64); err != nil || seq == 0 {
+			hookTypes.PanicIfError(hookTypes.BadRequestError(fmt.Sprintf("Invalid seq '%s'. Expecting a positive integer", value), err))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	resp, err := a.Manager.GetPropagation(ctx, vars["name"], vars["type"], seq, wait)
+	hookTypes.PanicIfError(err)
+	writeJSONResponse(resp, http.StatusOK, w)
+}
+
+// decodeWait reads the wait and timeout query params; it panics with a bad request error if they are not valid
+func decodeWait(r *http.Request) (wait bool, timeout time.Duration) {
+	var err error
+	query := r.URL.Query()
+	if value := query.Get("wait"); value != "" {
+		if wait, err = strconv.ParseBool(value); err != nil {
+			hookTypes.PanicIfError(hookTypes.BadRequestError(fmt.Sprintf("Invalid wait '%s'. Expecting true or false", value), err))
+		}
+	}
+	timeout = defaultPropagationTimeout
+	if value := query.Get("timeout"); value != "" {
+		if timeout, err = time.ParseDuration(value); err != nil || timeout <= 0 || timeout > maxPropagationTimeout {
+			hookTypes.PanicIfError(hookTypes.BadRequestError(fmt.Sprintf("Invalid timeout '%s'. Expecting a positive duration up to %v, such as 30s", value, maxPropagationTimeout), err))
+		}
+	}
+	return
+}
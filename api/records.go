@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/labbsr0x/bindman-dns-bind9/manager"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+// GetDNSRecords lists the registered DNS Records selected by the query params.
+// When there are more records than the limit, the cursor of the next page is sent in the X-Next-Cursor header
+func (a *API) GetDNSRecords(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+	logrus.Infof("GetDNSRecords call. Http Request: %v", r)
+	resp, next, err := a.Manager.ListDNSRecords(decodeRecordFilter(r))
+	hookTypes.PanicIfError(err)
+	if resp == nil {
+		resp = []manager.Record{}
+	}
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+	writeJSONResponse(resp, http.StatusOK, w)
+}
+
+// GetDNSRecord gets a specific DNS Record. DNS Record name and type comes from url params
+func (a *API) GetDNSRecord(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+	logrus.Infof("GetDNSRecord call. Http Request: %v", r)
+	vars := mux.Vars(r)
+	resp, err := a.Manager.GetRecord(vars["name"], vars["type"])
+	hookTypes.PanicIfError(err)
+	writeJSONResponse(resp, http.StatusOK, w)
+}
+
+// LookupDNSRecord compares the dns record identified by its name and type with the answer the nameserver actually serves
+func (a *API) LookupDNSRecord(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+	logrus.Infof("LookupDNSRecord call. Http Request: %v", r)
+	vars := mux.Vars(r)
+	resp, err := a.Manager.LookupRecord(r.Context(), vars["name"], vars["type"])
+	hookTypes.PanicIfError(err)
+	writeJSONResponse(resp, http.StatusOK, w)
+}
+
+// RemoveDNSRecord removes a dns record identified by its name
+func (a *API) RemoveDNSRecord(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+	logrus.Infof("RemoveDNSRecord call. Http Request: %v", r)
+	vars := mux.Vars(r)
+	record := manager.Record{DNSRecord: hookTypes.DNSRecord{Name: vars["name"], Type: vars["type"]}}
+	a.mutate(w, r, manager.OperationRemove, record, func(ctx context.Context) error {
+		return a.Manager.RemoveDNSRecord(ctx, record.Name, record.Type)
+	})
+}
+
+// AddDNSRecord handles a POST request
+// Expects a DNSRecord object as a body payload
+func (a *API) AddDNSRecord(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+	logrus.Infof("AddDNSRecord call. Http Request: %v", r)
+	record := decodeDNSRecord(r)
+	a.mutate(w, r, manager.OperationAdd, record, func(ctx context.Context) error {
+		return a.Manager.AddRecord(ctx, record)
+	})
+}
+
+// UpdateDNSRecord updates a dns record
+// Expects a DNSRecord object as a body payload
+func (a *API) UpdateDNSRecord(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+	logrus.Infof("UpdateDNSRecord call. Http Request: %v", r)
+	record := decodeDNSRecord(r)
+	a.mutate(w, r, manager.OperationUpdate, record, func(ctx context.Context) error {
+		return a.Manager.UpdateRecord(ctx, record)
+	})
+}
+
+// GetOperation gets the status of an operation submitted to the write queue. The operation id comes from url params
+func (a *API) GetOperation(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+	logrus.Infof("GetOperation call. Http Request: %v", r)
+	if a.Manager.Queue == nil {
+		hookTypes.PanicIfError(hookTypes.NotFoundError("The asynchronous mode is not enabled", nil))
+	}
+	resp, err := a.Manager.Queue.GetOperation(mux.Vars(r)["id"])
+	hookTypes.PanicIfError(err)
+	writeJSONResponse(resp, http.StatusOK, w)
+}
+
+// mutate submits the mutation to the write queue when the asynchronous mode is enabled, answering with the queued operation.
+// Otherwise, the mutation is applied right away, telling the outcome of its verification, if any
+func (a *API) mutate(w http.ResponseWriter, r *http.Request, operationType string, record manager.Record, apply func(ctx context.Context) error) {
+	if a.Manager.Queue == nil {
+		ctx, verification := manager.WithVerification(r.Context())
+		err := apply(ctx)
+		if outcome := verification(); outcome != "" {
+			w.Header().Set(manager.VerificationHeader, outcome)
+		}
+		hookTypes.PanicIfError(err)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	op, err := a.Manager.Queue.Submit(operationType, record)
+	hookTypes.PanicIfError(err)
+	w.Header().Set("Location", "/operations/"+op.ID)
+	writeJSONResponse(op, http.StatusAccepted, w)
+}
+
+// decodeDNSRecord reads and checks the record sent as the request body payload; it panics with a bad request error if the payload is not valid
+func decodeDNSRecord(r *http.Request) (record manager.Record) {
+	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+		hookTypes.PanicIfError(hookTypes.BadRequestError("Invalid request body. You must pass a JSON formatted record on request body", err))
+	}
+	hookTypes.PanicIfError(record.Render())
+	if errs := record.Check(); errs != nil {
+		hookTypes.PanicIfError(hookTypes.BadRequestError("Invalid request body. You must pass a JSON formatted record on request body", nil, errs...))
+	}
+	return
+}
+
+// decodeRecordFilter reads the filter of a listing from the query params; it panics with a bad request error if they are not valid
+func decodeRecordFilter(r *http.Request) (filter manager.RecordFilter) {
+	query := r.URL.Query()
+	filter.Type = query.Get("type")
+	filter.NameSuffix = query.Get("suffix")
+	filter.Glob = query.Get("glob")
+	filter.Sort = query.Get("sort")
+	filter.Cursor = query.Get("cursor")
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+			hookTypes.PanicIfError(hookTypes.BadRequestError(fmt.Sprintf("Invalid limit '%s'. It must be a non-negative integer", limit), err))
+		}
+	}
+	for _, label := range query["label"] {
+		i := strings.Index(label, "=")
+		if i < 1 {
+			hookTypes.PanicIfError(hookTypes.BadRequestError(fmt.Sprintf("Invalid label '%s'. It must be formatted as key=value", label), nil))
+		}
+		if filter.Labels == nil {
+			filter.Labels = make(map[string]string)
+		}
+		filter.Labels[label[:i]] = label[i+1:]
+	}
+	return
+}
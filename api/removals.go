@@ -0,0 +1,21 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labbsr0x/bindman-dns-bind9/manager"
+	"github.com/sirupsen/logrus"
+)
+
+// removalsResponse describes the state of the delayed removals
+type removalsResponse struct {
+	Pending []manager.Removal `json:"pending"`
+	Running int               `json:"running"`
+}
+
+// GetRemovals lists the removals waiting for their removal delay to be over and the number of removals being executed
+func (a *API) GetRemovals(w http.ResponseWriter, r *http.Request) {
+	defer handleError(w)
+	logrus.Infof("GetRemovals call. Http Request: %v", r)
+	writeJSONResponse(removalsResponse{Pending: a.Manager.PendingRemovals(), Running: a.Manager.RunningRemovals()}, http.StatusOK, w)
+}
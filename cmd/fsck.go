@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/labbsr0x/bindman-dns-bind9/manager"
+	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	fsckRepair  = "repair"
+	fsckRebuild = "rebuild"
+	fsckStore   = "store"
+)
+
+// fsckCmd represents the fsck command
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "Checks the stored records, looking for corrupt, invalid and duplicate record files",
+	Example: `  bindman-dns-bind9 fsck --repair
+
+  Reports the record files that cannot be parsed, that miss their name, value or type, or that hold the same record as another file.
+  With --repair, they are moved to the quarantine directory inside the data directory. The server does the same on startup.
+
+  bindman-dns-bind9 fsck --rebuild -n 172.17.0.2 -z test.com -k Ktest.com.+157+50086.key
+
+  Also stores the records served by the nameserver that are missing from the store, read through a zone transfer.
+`,
+	RunE: runFsck,
+}
+
+func runFsck(cmd *cobra.Command, _ []string) error {
+	// a viper of its own, so the flags of the serve command stay bound to the global one
+	v := viper.New()
+	v.SetEnvPrefix("BINDMAN")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_", ".", "_"))
+	v.AutomaticEnv()
+	if err := v.BindPFlags(cmd.Flags()); err != nil {
+		return err
+	}
+
+	repair, rebuild := v.GetBool(fsckRepair), v.GetBool(fsckRebuild)
+	store, err := manager.OpenRecordStore(v.GetString(fsckStore), basePath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	cmd.SilenceUsage = true
+	report, err := manager.Fsck(store, basePath, repair)
+	if err != nil {
+		return err
+	}
+	for _, problem := range report.Problems {
+		fmt.Printf("%s: %s: %s\n", problem.Key, strings.ToUpper(problem.Problem), problem.Detail)
+		if problem.QuarantinedTo != "" {
+			fmt.Printf("%s: moved to %s\n", problem.Key, problem.QuarantinedTo)
+		}
+	}
+	fmt.Printf("Checked %d records, %d problems found\n", report.Checked, len(report.Problems))
+
+	if rebuild {
+		nsu, err := new(nsupdate.Builder).InitFromViper(v).New(basePath)
+		if err != nil {
+			return err
+		}
+		served, err := nsu.TransferZone(context.Background())
+		if err != nil {
+			return err
+		}
+		missing, err := manager.RebuildRecords(store, served, false)
+		if err != nil {
+			return err
+		}
+		for _, record := range missing {
+			fmt.Printf("%s %s: rebuilt with the value '%s'\n", record.Name, record.Type, record.Value)
+		}
+		fmt.Printf("Rebuilt %d of the %d records served\n", len(missing), len(served))
+	}
+
+	if len(report.Problems) > 0 && !repair {
+		return fmt.Errorf("%d problems found; run with --%s to quarantine them", len(report.Problems), fsckRepair)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(fsckCmd)
+
+	fsckCmd.Flags().Bool(fsckRepair, false, "Move the problematic record files to the quarantine directory")
+	fsckCmd.Flags().Bool(fsckRebuild, false, "Store the records served by the nameserver that are missing from the store, read through a zone transfer")
+	fsckCmd.Flags().String(fsckStore, manager.StoreDiskv, "Backend of the record store")
+	nsupdate.AddFlags(fsckCmd.Flags())
+}
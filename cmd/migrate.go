@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/labbsr0x/bindman-dns-bind9/manager"
+	"github.com/spf13/cobra"
+)
+
+const (
+	migrateDryRun = "dry-run"
+	migrateStore  = "store"
+)
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrades the stored records to the current schema version",
+	Example: `  bindman-dns-bind9 migrate --dry-run
+
+  Prints, for each record to be migrated, the schema migrations applied and the new storage key, if it moves.
+  The server applies the same migrations on startup; this command lets them be reviewed beforehand.
+`,
+	RunE: runMigrate,
+}
+
+func runMigrate(cmd *cobra.Command, _ []string) error {
+	dryRun, _ := cmd.Flags().GetBool(migrateDryRun)
+	backend, _ := cmd.Flags().GetString(migrateStore)
+
+	store, err := manager.OpenRecordStore(backend, basePath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	cmd.SilenceUsage = true
+	report, err := manager.MigrateRecords(store, dryRun)
+	if err != nil {
+		return err
+	}
+
+	action, failed := "Migrated", 0
+	if dryRun {
+		action = "Would migrate"
+	}
+	for _, migration := range report {
+		if migration.Error != "" {
+			failed++
+			fmt.Printf("%s: ERROR %s\n", migration.Key, migration.Error)
+			continue
+		}
+		var changes []string
+		changes = append(changes, migration.Steps...)
+		if migration.NewKey != "" {
+			changes = append(changes, "move to "+migration.NewKey)
+		}
+		fmt.Printf("%s: %s\n", migration.Key, strings.Join(changes, "; "))
+	}
+	fmt.Printf("%s %d records to the schema version %d\n", action, len(report)-failed, manager.SchemaVersion)
+
+	if failed > 0 {
+		return fmt.Errorf("%d records cannot be migrated", failed)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+
+	migrateCmd.Flags().Bool(migrateDryRun, false, "Only report the changes, leaving the records untouched")
+	migrateCmd.Flags().String(migrateStore, manager.StoreDiskv, "Backend of the record store")
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/labbsr0x/bindman-dns-bind9/manager"
+	"github.com/spf13/cobra"
+)
+
+const (
+	migrateFrom = "from"
+	migrateTo   = "to"
+)
+
+// migrateStoreCmd represents the migrate-store command
+var migrateStoreCmd = &cobra.Command{
+	Use:   "migrate-store",
+	Short: "Copies the records from one record store backend to another",
+	Example: `  bindman-dns-bind9 migrate-store --from=diskv --to=bolt
+
+  The server must be stopped while migrating. The source store is left untouched; start the server
+  with --store set to the destination backend once the migration succeeds.
+`,
+	RunE: runMigrateStore,
+}
+
+func runMigrateStore(cmd *cobra.Command, _ []string) error {
+	from, _ := cmd.Flags().GetString(migrateFrom)
+	to, _ := cmd.Flags().GetString(migrateTo)
+	if from == to {
+		return fmt.Errorf("the source and destination stores must be different, both are '%s'", from)
+	}
+
+	source, err := manager.OpenRecordStore(from, basePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	destination, err := manager.OpenRecordStore(to, basePath)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	cmd.SilenceUsage = true
+	count, err := manager.MigrateStore(source, destination)
+	if err != nil {
+		return fmt.Errorf("not possible to migrate the records from '%s' to '%s': %v", from, to, err)
+	}
+	fmt.Printf("Migrated %d records from '%s' to '%s'\n", count, from, to)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(migrateStoreCmd)
+
+	migrateStoreCmd.Flags().String(migrateFrom, manager.StoreDiskv, "Backend to read the records from")
+	migrateStoreCmd.Flags().String(migrateTo, manager.StoreBolt, "Backend to write the records to")
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/labbsr0x/bindman-dns-bind9/manager"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/spf13/cobra"
+)
+
+const (
+	planURL   = "url"
+	planFile  = "file"
+	planScope = "scope"
+	planID    = "plan"
+)
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Shows the changes turning the records of a scope into the desired ones",
+	Example: `  bindman-dns-bind9 plan --file records.json --scope test.com
+
+  Sends the desired records to a running server, which answers with the records to be added, updated and removed
+  within the scope, leaving them untouched. The file holds either a list of records or a desired state, with its scope,
+  and is read from the standard input when set to "-".
+`,
+	RunE: runPlan,
+}
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Applies at once the changes turning the records of a scope into the desired ones",
+	Example: `  bindman-dns-bind9 apply --file records.json --scope test.com --plan 3f2a9c0d51e8b7a4
+
+  Sends the desired records to a running server, which applies the changes in a single update of the nameserver.
+  With --plan, the changes are only applied if they are still the ones shown by the plan command.
+`,
+	RunE: runPlan,
+}
+
+func runPlan(cmd *cobra.Command, _ []string) error {
+	url, _ := cmd.Flags().GetString(planURL)
+	file, _ := cmd.Flags().GetString(planFile)
+	scope, _ := cmd.Flags().GetString(planScope)
+
+	state, err := readDesiredState(file)
+	if err != nil {
+		return err
+	}
+	if scope != "" {
+		state.Scope = scope
+	}
+	if cmd.Flags().Lookup(planID) != nil {
+		state.Plan, _ = cmd.Flags().GetString(planID)
+	}
+
+	cmd.SilenceUsage = true
+	plan, err := postDesiredState(strings.TrimSuffix(url, "/")+"/"+cmd.Name(), state)
+	if err != nil {
+		return err
+	}
+	printPlan(plan, cmd.Name() == "apply")
+	return nil
+}
+
+// readDesiredState reads the desired state from the file, or from the standard input when it is "-"
+func readDesiredState(file string) (state manager.DesiredState, err error) {
+	if file == "" {
+		return state, fmt.Errorf("the --%s flag is required", planFile)
+	}
+	var b []byte
+	if file == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(b)), "[") {
+		err = json.Unmarshal(b, &state.Records)
+	} else {
+		err = json.Unmarshal(b, &state)
+	}
+	if err != nil {
+		err = fmt.Errorf("not possible to parse the desired records of '%s': %v", file, err)
+	}
+	return
+}
+
+// postDesiredState sends the desired state to the endpoint, returning the plan answered or the error, along with its details
+func postDesiredState(url string, state manager.DesiredState) (*manager.Plan, error) {
+	body, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 5 * time.Minute}
+	res, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var e hookTypes.Error
+		if err := json.NewDecoder(res.Body).Decode(&e); err != nil || e.Message == "" {
+			return nil, fmt.Errorf("the server answered with the status %d", res.StatusCode)
+		}
+		for _, detail := range e.Details {
+			fmt.Fprintf(os.Stderr, "  %s\n", detail)
+		}
+		return nil, fmt.Errorf("%s (status %d)", e.Message, res.StatusCode)
+	}
+	plan := new(manager.Plan)
+	if err := json.NewDecoder(res.Body).Decode(plan); err != nil {
+		return nil, fmt.Errorf("not possible to parse the answer of the server: %v", err)
+	}
+	return plan, nil
+}
+
+// printPlan prints the changes of the plan, then its summary
+func printPlan(plan *manager.Plan, applied bool) {
+	for _, c := range plan.Changes {
+		switch c.Type {
+		case manager.OperationAdd:
+			fmt.Printf("+ %s %s %s\n", c.Record.Name, c.Record.Type, c.Record.Value)
+		case manager.OperationUpdate:
+			fmt.Printf("~ %s %s %s -> %s\n", c.Record.Name, c.Record.Type, c.Previous.Value, c.Record.Value)
+		case manager.OperationRemove:
+			fmt.Printf("- %s %s %s\n", c.Record.Name, c.Record.Type, c.Record.Value)
+		}
+	}
+	action := "Plan"
+	if applied {
+		action = "Applied plan"
+	}
+	fmt.Printf("%s %s for '%s': %d to add, %d to update, %d to remove, %d unchanged\n", action, plan.ID, plan.Scope, plan.Adds, plan.Updates, plan.Removals, plan.Unchanged)
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+	rootCmd.AddCommand(applyCmd)
+
+	for _, c := range []*cobra.Command{planCmd, applyCmd} {
+		c.Flags().String(planURL, "http://localhost:7070", "URL of the running server")
+		c.Flags().StringP(planFile, "f", "", "JSON file holding the desired records, or - for the standard input")
+		c.Flags().String(planScope, "", "Zone or domain within it covered by the desired records, overriding the scope of the file")
+	}
+	applyCmd.Flags().String(planID, "", "Id of the plan to apply; the changes are refused if they are not the planned ones anymore")
+}
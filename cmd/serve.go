@@ -1,11 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/labbsr0x/bindman-dns-bind9/api"
 	"github.com/labbsr0x/bindman-dns-bind9/manager"
 	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
 	"github.com/labbsr0x/bindman-dns-bind9/version"
-	"github.com/labbsr0x/bindman-dns-webhook/src/hook"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -27,28 +34,83 @@ var serveCmd = &cobra.Command{
         ------------------------------------------------------------------
         --dns-removal-delay                 BINDMAN_DNS_REMOVAL_DELAY
         --nameserver.key-file               BINDMAN_NAMESERVER_KEY_FILE
+
+  On SIGTERM or SIGINT the server stops accepting requests and waits up to --shutdown.timeout for the
+  running updates to finish. It exits with a non-zero status when they could not all be drained.
 `,
 	RunE: runE,
 }
 
-func runE(_ *cobra.Command, _ []string) error {
+func runE(cmd *cobra.Command, _ []string) error {
 	nsupdateBuilder := new(nsupdate.Builder).InitFromViper(viper.GetViper())
 	managerBuilder := new(manager.Builder).InitFromViper(viper.GetViper())
 	nsu, err := nsupdateBuilder.New(basePath)
 	if err != nil {
 		return fmt.Errorf("\n  Error occurred while setting up the DNS Manager.\n  %v", err)
 	}
+	reverse, err := nsupdateBuilder.NewReverse(basePath)
+	if err != nil {
+		return fmt.Errorf("\n  Error occurred while setting up the reverse zone of the DNS Manager.\n  %v", err)
+	}
+	if reverse != nil {
+		managerBuilder.ReverseUpdater = reverse
+	}
 	bind9Manager, err := managerBuilder.New(nsu, basePath)
 	if err != nil {
 		return err
 	}
+	server, err := api.New(bind9Manager)
+	if err != nil {
+		return err
+	}
 
 	logrus.New().WithFields(logrus.Fields{
 		"Version":   version.Version,
 		"GitCommit": version.GitCommit,
 		"BuildTime": version.BuildTime,
 	}).Info("Bindman-DNS Bind9 version")
-	hook.Initialize(bind9Manager, version.Version)
+	// from now on errors are not about the command usage
+	cmd.SilenceUsage = true
+
+	httpServer := server.Server(version.Version)
+	errs := make(chan error, 1)
+	go func() {
+		logrus.Info("Initialized DNS Manager Webhook")
+		errs <- httpServer.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-errs:
+		logrus.Errorf("Error initializing the DNS Manager Webhook: %v", err)
+		return nil
+	case sig := <-signals:
+		logrus.Infof("Received %v, shutting down", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), managerBuilder.ShutdownTimeout)
+	defer cancel()
+
+	drained := true
+	if err := httpServer.Shutdown(ctx); err != nil {
+		logrus.Errorf("Not possible to finish the running requests: %v", err)
+		drained = false
+	}
+	if err := <-errs; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logrus.Errorf("Error serving the DNS Manager Webhook: %v", err)
+	}
+	if err := bind9Manager.Shutdown(ctx); err != nil {
+		logrus.Errorf("Not possible to drain the DNS Manager: %v", err)
+		drained = false
+	}
+
+	if !drained {
+		return errors.New("the shutdown did not drain cleanly")
+	}
+	logrus.Info("Shut down cleanly")
 	return nil
 }
 
@@ -3,12 +3,18 @@ module github.com/labbsr0x/bindman-dns-bind9
 go 1.13
 
 require (
+	github.com/ghodss/yaml v1.0.0
 	github.com/google/uuid v1.1.1
+	github.com/gorilla/mux v1.7.3
 	github.com/labbsr0x/bindman-dns-webhook v1.0.2
+	github.com/miekg/dns v1.1.27
 	github.com/peterbourgon/diskv v2.0.1+incompatible
+	github.com/prometheus/client_golang v1.1.0
 	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.6.1
 	github.com/stretchr/testify v1.4.0
+	go.etcd.io/bbolt v1.3.5
+	golang.org/x/net v0.0.0-20200202094626-16171245cfb2
 )
@@ -0,0 +1,222 @@
+package manager
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// operationNone identifies a coalesced change whose net effect is to leave the record untouched
+const operationNone = "none"
+
+// change describes a mutation of a record
+type change struct {
+	Type   string
+	Record Record
+}
+
+// pendingChange holds the net effect of the changes to a record received within a coalescing window
+type pendingChange struct {
+	change
+	count   int
+	waiters []func(outcome string, err error)
+}
+
+// coalescerEntry holds the state of the coalescing of one record
+type coalescerEntry struct {
+	// pending the change whose window is still open
+	pending *pendingChange
+	// ready the changes whose window is closed, waiting to be applied in order
+	ready    []*pendingChange
+	flushing bool
+}
+
+// coalescer collapses the changes to the same record received within a time window into their net effect,
+// so flapping clients do not generate one DNS update per change
+type coalescer struct {
+	window time.Duration
+	apply  func(ctx context.Context, c change) error
+	// stored tells whether the record is stored
+	stored func(r Record) bool
+	// slots bounds the number of net changes applied at the same time; nil means no bound
+	slots   chan struct{}
+	lock    sync.Mutex
+	entries map[string]*coalescerEntry
+}
+
+// newCoalescer creates a coalescer applying the net changes with the apply function
+func newCoalescer(window time.Duration, apply func(ctx context.Context, c change) error, stored func(r Record) bool) *coalescer {
+	return &coalescer{window: window, apply: apply, stored: stored, entries: make(map[string]*coalescerEntry)}
+}
+
+// limit bounds the number of net changes applied at the same time. It must be called before any change is submitted
+func (c *coalescer) limit(n int) {
+	c.slots = make(chan struct{}, n)
+}
+
+// do submits the change and waits for its net effect to be applied or the context to be done, recording the outcome of
+// its verification in the context. The net effect is applied even if the context is done before
+func (c *coalescer) do(ctx context.Context, ch change) error {
+	result := make(chan error, 1)
+	c.submit(ch, func(outcome string, err error) {
+		recordVerification(ctx, outcome)
+		result <- err
+	})
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// submit merges the change into the pending change to the same record; done is called once its net effect is applied, with
+// the outcome of its verification, empty when nothing was verified. A change that cannot be merged closes the window of the pending one and opens a new window
+func (c *coalescer) submit(ch change, done func(outcome string, err error)) {
+	key := recordKey(ch.Record.Name, ch.Record.Type)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = new(coalescerEntry)
+		c.entries[key] = entry
+	}
+
+	if entry.pending != nil {
+		if merged, ok := c.merge(entry, ch); ok {
+			entry.pending.change = merged
+			entry.pending.count++
+			entry.pending.waiters = append(entry.pending.waiters, done)
+			return
+		}
+		c.close(key, entry)
+	}
+
+	pending := &pendingChange{change: ch, count: 1, waiters: []func(outcome string, err error){done}}
+	entry.pending = pending
+	time.AfterFunc(c.window, func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		if entry.pending == pending {
+			c.close(key, entry)
+		}
+	})
+}
+
+// drain closes the window of every pending change and waits for all of them to be applied or the context to be done
+func (c *coalescer) drain(ctx context.Context) error {
+	c.lock.Lock()
+	for key, entry := range c.entries {
+		if entry.pending != nil {
+			c.close(key, entry)
+		}
+	}
+	c.lock.Unlock()
+
+	return waitUntil(ctx, func() bool {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		return len(c.entries) == 0
+	})
+}
+
+// close closes the window of the pending change of the entry and makes sure it gets applied. It expects the lock to be held
+func (c *coalescer) close(key string, entry *coalescerEntry) {
+	entry.ready = append(entry.ready, entry.pending)
+	entry.pending = nil
+	if !entry.flushing {
+		entry.flushing = true
+		go c.flush(key, entry)
+	}
+}
+
+// flush applies the ready changes of an entry in order, until there is none left
+func (c *coalescer) flush(key string, entry *coalescerEntry) {
+	for {
+		c.lock.Lock()
+		if len(entry.ready) == 0 {
+			entry.flushing = false
+			if entry.pending == nil {
+				delete(c.entries, key)
+			}
+			c.lock.Unlock()
+			return
+		}
+		pending := entry.ready[0]
+		entry.ready = entry.ready[1:]
+		c.lock.Unlock()
+
+		var err error
+		var outcome string
+		saved := pending.count
+		if pending.Type != operationNone {
+			saved--
+			ctx, verification := WithVerification(context.Background())
+			if c.slots != nil {
+				c.slots <- struct{}{}
+			}
+			err = c.apply(ctx, pending.change)
+			if c.slots != nil {
+				<-c.slots
+			}
+			outcome = verification()
+		}
+		if saved > 0 {
+			logrus.Infof("Coalesced %d changes to the record '%s' with type '%s' into '%s'", pending.count, pending.Record.Name, pending.Record.Type, pending.Type)
+			savedUpdates.Add(float64(saved))
+		}
+		for _, done := range pending.waiters {
+			done(outcome, err)
+		}
+	}
+}
+
+// merge merges the change into the pending change of the entry. An addition followed by a removal only cancels out when the
+// addition creates the record; when it replaces a stored one, the removal is kept. Whether the record is stored is not known
+// while earlier changes to it are still to be applied, so both are not merged then
+func (c *coalescer) merge(entry *coalescerEntry, next change) (change, bool) {
+	if entry.pending.Type == OperationAdd && next.Type == OperationRemove {
+		if len(entry.ready) > 0 {
+			return change{}, false
+		}
+		if c.stored(next.Record) {
+			return next, true
+		}
+	}
+	return merge(entry.pending.change, next)
+}
+
+// merge computes the net effect of the change next applied after the change prev, an addition being taken as creating the
+// record. It returns false when both cannot be merged
+func merge(prev, next change) (change, bool) {
+	switch prev.Type {
+	case operationNone:
+		return next, true
+	case OperationAdd:
+		switch next.Type {
+		case OperationAdd:
+			return next, prev.Record.Value == next.Record.Value
+		case OperationUpdate:
+			return next, true
+		case OperationRemove:
+			return change{Type: operationNone, Record: prev.Record}, true
+		}
+	case OperationUpdate:
+		switch next.Type {
+		case OperationUpdate, OperationRemove:
+			return next, true
+		}
+	case OperationRemove:
+		switch next.Type {
+		case OperationAdd, OperationUpdate:
+			return change{Type: OperationUpdate, Record: next.Record}, true
+		case OperationRemove:
+			return next, true
+		}
+	}
+	return change{}, false
+}
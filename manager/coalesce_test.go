@@ -0,0 +1,191 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const coalesceBasePath = "./data-coalesce"
+
+func TestMerge(t *testing.T) {
+	v1 := Record{DNSRecord: hookTypes.DNSRecord{Name: "a.test.com", Value: "0.0.0.1", Type: "A"}}
+	v2 := Record{DNSRecord: hookTypes.DNSRecord{Name: "a.test.com", Value: "0.0.0.2", Type: "A"}}
+
+	tests := []struct {
+		name   string
+		prev   change
+		next   change
+		want   change
+		wantOk bool
+	}{
+		{"add then add same value", change{OperationAdd, v1}, change{OperationAdd, v1}, change{OperationAdd, v1}, true},
+		{"add then add another value", change{OperationAdd, v1}, change{OperationAdd, v2}, change{}, false},
+		{"add then update", change{OperationAdd, v1}, change{OperationUpdate, v2}, change{OperationUpdate, v2}, true},
+		{"add then remove", change{OperationAdd, v1}, change{OperationRemove, v1}, change{operationNone, v1}, true},
+		{"update then add", change{OperationUpdate, v1}, change{OperationAdd, v2}, change{}, false},
+		{"update then update", change{OperationUpdate, v1}, change{OperationUpdate, v2}, change{OperationUpdate, v2}, true},
+		{"update then remove", change{OperationUpdate, v1}, change{OperationRemove, v1}, change{OperationRemove, v1}, true},
+		{"remove then add", change{OperationRemove, v1}, change{OperationAdd, v2}, change{OperationUpdate, v2}, true},
+		{"remove then update", change{OperationRemove, v1}, change{OperationUpdate, v2}, change{OperationUpdate, v2}, true},
+		{"remove then remove", change{OperationRemove, v1}, change{OperationRemove, v1}, change{OperationRemove, v1}, true},
+		{"none then add", change{operationNone, v1}, change{OperationAdd, v2}, change{OperationAdd, v2}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := merge(test.prev, test.next)
+			if ok != test.wantOk || (ok && !reflect.DeepEqual(got, test.want)) {
+				t.Errorf("merge() = %v, %v; want %v, %v", got, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}
+
+func TestCoalesceAddThenRemove(t *testing.T) {
+	m, updater := initCoalescingManager(t)
+	defer os.RemoveAll(coalesceBasePath)
+	saved := testutil.ToFloat64(savedUpdates)
+	record := hookTypes.DNSRecord{Name: "flap.test.com", Value: "0.0.0.0", Type: "A"}
+
+	results := submitChanges(m, change{OperationAdd, Record{DNSRecord: record}}, change{OperationRemove, Record{DNSRecord: record}})
+	for i, err := range results {
+		if err != nil {
+			t.Errorf("Expecting change %d to succeed. Got err '%v'", i, err)
+		}
+	}
+
+	if atomic.LoadUint64(&updater.AddCount) != 0 || atomic.LoadUint64(&updater.RemovalCount) != 0 {
+		t.Errorf("Expecting the nameserver to not be touched. Got %d additions and %d removals", updater.AddCount, updater.RemovalCount)
+	}
+	if m.HasDNSRecord(record.Name, record.Type) {
+		t.Error("Expecting the record to not be stored")
+	}
+	if got := testutil.ToFloat64(savedUpdates) - saved; got != 2 {
+		t.Errorf("Expecting 2 saved updates to be reported. Got %v", got)
+	}
+}
+
+func TestCoalesceAddThenRemoveStoredRecord(t *testing.T) {
+	m, updater := initCoalescingManager(t)
+	defer os.RemoveAll(coalesceBasePath)
+	record := hookTypes.DNSRecord{Name: "stored.test.com", Value: "0.0.0.1", Type: "A"}
+	if err := m.apply(context.Background(), change{OperationAdd, Record{DNSRecord: record}}); err != nil {
+		t.Fatal(err)
+	}
+	another := record
+	another.Value = "0.0.0.2"
+
+	results := submitChanges(m, change{OperationAdd, Record{DNSRecord: another}}, change{OperationRemove, Record{DNSRecord: another}})
+	for i, err := range results {
+		if err != nil {
+			t.Errorf("Expecting change %d to succeed. Got err '%v'", i, err)
+		}
+	}
+
+	if atomic.LoadUint64(&updater.AddCount) != 1 {
+		t.Errorf("Expecting the addition to be coalesced into the removal. Got %d additions", updater.AddCount)
+	}
+	if pending := m.PendingRemovals(); len(pending) != 1 || pending[0].Name != record.Name {
+		t.Errorf("Expecting the removal of the stored record to be kept. Got %v", pending)
+	}
+}
+
+func TestCoalesceRemoveUnknownRecord(t *testing.T) {
+	m, _ := initCoalescingManager(t)
+	defer os.RemoveAll(coalesceBasePath)
+
+	err := m.RemoveDNSRecord(context.Background(), "unknown.test.com", "A")
+	if hookErr, ok := err.(*hookTypes.Error); !ok || hookErr.Code != http.StatusNotFound {
+		t.Errorf("Expecting the removal of an unknown record to be not found. Got '%v'", err)
+	}
+}
+
+func TestCoalesceSuccessiveUpdates(t *testing.T) {
+	m, updater := initCoalescingManager(t)
+	defer os.RemoveAll(coalesceBasePath)
+	saved := testutil.ToFloat64(savedUpdates)
+	record := hookTypes.DNSRecord{Name: "updated.test.com", Value: "0.0.0.1", Type: "A"}
+	last := record
+	last.Value = "0.0.0.3"
+
+	submitChanges(m,
+		change{OperationAdd, Record{DNSRecord: record}},
+		change{OperationUpdate, Record{DNSRecord: hookTypes.DNSRecord{Name: record.Name, Value: "0.0.0.2", Type: record.Type}}},
+		change{OperationUpdate, Record{DNSRecord: last}},
+	)
+
+	if atomic.LoadUint64(&updater.AddCount) != 0 || atomic.LoadUint64(&updater.UpdateCount) != 1 {
+		t.Errorf("Expecting a single update to be sent to the nameserver. Got %d additions and %d updates", updater.AddCount, updater.UpdateCount)
+	}
+	if r, err := m.GetDNSRecord(record.Name, record.Type); err != nil || *r != last {
+		t.Errorf("Expecting the last value to be stored. Got '%v' and err '%v'", r, err)
+	}
+	if got := testutil.ToFloat64(savedUpdates) - saved; got != 2 {
+		t.Errorf("Expecting 2 saved updates to be reported. Got %v", got)
+	}
+}
+
+func TestCoalesceNotMergeableChanges(t *testing.T) {
+	m, updater := initCoalescingManager(t)
+	defer os.RemoveAll(coalesceBasePath)
+	record := hookTypes.DNSRecord{Name: "multi.test.com", Value: "0.0.0.1", Type: "A"}
+	another := record
+	another.Value = "0.0.0.2"
+
+	submitChanges(m, change{OperationUpdate, Record{DNSRecord: record}}, change{OperationAdd, Record{DNSRecord: another}})
+
+	if atomic.LoadUint64(&updater.UpdateCount) != 1 || atomic.LoadUint64(&updater.AddCount) != 1 {
+		t.Errorf("Expecting both changes to be sent to the nameserver. Got %d updates and %d additions", updater.UpdateCount, updater.AddCount)
+	}
+}
+
+func TestCoalesceSyncCall(t *testing.T) {
+	m, updater := initCoalescingManager(t)
+	defer os.RemoveAll(coalesceBasePath)
+	record := hookTypes.DNSRecord{Name: "sync.test.com", Value: "0.0.0.1", Type: "A"}
+
+	start := time.Now()
+	if err := m.AddDNSRecord(context.Background(), record); err != nil {
+		t.Fatalf("Expecting the addition to succeed. Got err '%v'", err)
+	}
+	if time.Since(start) < m.CoalesceWindow {
+		t.Error("Expecting the call to wait for the coalescing window")
+	}
+	if atomic.LoadUint64(&updater.AddCount) != 1 {
+		t.Errorf("Expecting exactly one addition. Got %d", updater.AddCount)
+	}
+}
+
+func initCoalescingManager(t *testing.T) (*Bind9Manager, *MockDNSUpdater) {
+	_ = os.RemoveAll(coalesceBasePath)
+	updater := new(MockDNSUpdater)
+	m, err := (&Builder{TTL: time.Hour, RemovalDelay: time.Hour, CoalesceWindow: 100 * time.Millisecond}).New(updater, coalesceBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, updater
+}
+
+// submitChanges submits the changes in order and waits for all of them to be applied
+func submitChanges(m *Bind9Manager, changes ...change) []error {
+	results := make([]chan error, len(changes))
+	for i, c := range changes {
+		results[i] = make(chan error, 1)
+		ch := results[i]
+		m.coalescer.submit(c, func(_ string, err error) { ch <- err })
+	}
+
+	errs := make([]error, len(changes))
+	for i, ch := range results {
+		errs[i] = <-ch
+	}
+	return errs
+}
@@ -0,0 +1,97 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+// dnssecTypes the record types allowed along with a CNAME record, maintained by the nameserver for signed zones
+var dnssecTypes = map[string]bool{"RRSIG": true, "NSEC": true, "NSEC3": true}
+
+// conflicting tells whether records of the two types cannot share a name: a CNAME record allows no other data than DNSSEC records
+func conflicting(recordType, other string) bool {
+	if recordType == other || dnssecTypes[recordType] || dnssecTypes[other] {
+		return false
+	}
+	return recordType == "CNAME" || other == "CNAME"
+}
+
+// nameLockKey returns the key locking every record of the name, which never collides with a record key
+func nameLockKey(name string) string {
+	return "name:" + encodeKeyPart(canonicalName(name))
+}
+
+// checkConflicts checks no stored record, record waiting to be removed or record served by the nameserver conflicts with
+// the record to be added or updated: a CNAME record must be the only record of its name. It returns a conflict error
+// listing the conflicting records. The nameserver is only queried when the DNSUpdater implements nsupdate.NameLookup, and
+// failing to query it does not prevent the change.
+// When the change is part of a batch, the batch holds the records changed along with it by record key, nil for the removed
+// ones: they replace the records of the same key
+func (m *Bind9Manager) checkConflicts(ctx context.Context, record Record, batch map[string]*Record) error {
+	recordType := strings.ToUpper(record.Type)
+	var details []string
+	seen := make(map[string]bool)
+	add := func(r hookTypes.DNSRecord, source string) {
+		other := strings.ToUpper(r.Type)
+		key := other + " " + strings.ToLower(strings.TrimSuffix(r.Value, "."))
+		if !conflicting(recordType, other) || seen[key] {
+			return
+		}
+		seen[key] = true
+		details = append(details, fmt.Sprintf("%s %s %s (%s)", r.Name, other, r.Value, source))
+	}
+
+	// the records replaced or removed by the batch do not conflict anymore
+	replaced := func(r hookTypes.DNSRecord) bool {
+		_, ok := batch[m.getRecordFileName(r.Name, r.Type)]
+		return ok
+	}
+
+	for _, r := range m.index.byName(record.Name) {
+		if !replaced(r.DNSRecord) {
+			add(r.DNSRecord, "stored")
+		}
+	}
+	for _, r := range m.scheduler.Pending() {
+		if r.Name == record.Name && !replaced(hookTypes.DNSRecord{Name: r.Name, Type: r.Type}) {
+			add(hookTypes.DNSRecord{Name: r.Name, Value: r.Value, Type: r.Type}, "waiting to be removed")
+		}
+	}
+	keys := make([]string, 0, len(batch))
+	for key := range batch {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if r := batch[key]; r != nil && r.Name == record.Name {
+			add(r.DNSRecord, "planned")
+		}
+	}
+	if lookup, ok := m.DNSUpdater.(nsupdate.NameLookup); ok {
+		served, err := lookup.LookupName(ctx, record.Name)
+		if err != nil {
+			logrus.Warnf("Not possible to check the records served for '%s' before changing its %s record: %v", record.Name, recordType, err)
+		}
+		for _, r := range served {
+			if !replaced(r) {
+				add(r, "served")
+			}
+		}
+	}
+
+	if len(details) == 0 {
+		return nil
+	}
+	return &hookTypes.Error{
+		Message: fmt.Sprintf("The %s record '%s' conflicts with the other records of the name: a CNAME record must be the only record of its name", recordType, record.Name),
+		Code:    http.StatusConflict,
+		Details: details,
+	}
+}
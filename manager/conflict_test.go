@@ -0,0 +1,107 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const conflictBasePath = "./data-conflict"
+
+// mockNameLookup is a MockDNSUpdater also answering the lookups with the served records
+type mockNameLookup struct {
+	MockDNSUpdater
+	served []hookTypes.DNSRecord
+	err    error
+}
+
+func (m *mockNameLookup) LookupName(_ context.Context, name string) (records []hookTypes.DNSRecord, err error) {
+	for _, r := range m.served {
+		if r.Name == name {
+			records = append(records, r)
+		}
+	}
+	return records, m.err
+}
+
+func TestConflicting(t *testing.T) {
+	tests := []struct {
+		recordType string
+		other      string
+		expected   bool
+	}{
+		{"CNAME", "A", true},
+		{"A", "CNAME", true},
+		{"CNAME", "TXT", true},
+		{"CNAME", "CNAME", false},
+		{"CNAME", "RRSIG", false},
+		{"NSEC", "CNAME", false},
+		{"A", "AAAA", false},
+	}
+
+	for _, test := range tests {
+		if got := conflicting(test.recordType, test.other); got != test.expected {
+			t.Errorf("conflicting(%s, %s) = %v, want %v", test.recordType, test.other, got, test.expected)
+		}
+	}
+}
+
+func TestCNAMEConflicts(t *testing.T) {
+	_ = os.RemoveAll(conflictBasePath)
+	defer os.RemoveAll(conflictBasePath)
+	updater := &mockNameLookup{served: []hookTypes.DNSRecord{
+		{Name: "legacy.test.com", Value: "legacy.other.com.", Type: "CNAME"},
+		{Name: "signed.test.com", Value: "A 13 3 100 20200101000000 20190101000000 1 test.com. abc=", Type: "RRSIG"},
+	}}
+	m, err := (&Builder{RemovalDelay: time.Hour}).New(updater, conflictBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	_ = m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "app.test.com", Value: "0.0.0.1", Type: "A"})
+	_ = m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "old.test.com", Value: "0.0.0.2", Type: "A"})
+	_ = m.RemoveDNSRecord(ctx, "old.test.com", "A")
+
+	tests := []struct {
+		name     string
+		record   hookTypes.DNSRecord
+		conflict string
+	}{
+		{"cname on a stored record", hookTypes.DNSRecord{Name: "App.test.com", Value: "web.test.com", Type: "cname"}, "app.test.com A 0.0.0.1 (stored)"},
+		{"cname on a record waiting to be removed", hookTypes.DNSRecord{Name: "old.test.com", Value: "web.test.com", Type: "CNAME"}, "old.test.com A 0.0.0.2 (waiting to be removed)"},
+		{"record on a served cname", hookTypes.DNSRecord{Name: "legacy.test.com", Value: "v=spf1 -all", Type: "TXT"}, "legacy.test.com CNAME legacy.other.com. (served)"},
+		{"cname along with dnssec records", hookTypes.DNSRecord{Name: "signed.test.com", Value: "web.test.com", Type: "CNAME"}, ""},
+		{"record of another type", hookTypes.DNSRecord{Name: "app.test.com", Value: "::1", Type: "AAAA"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := m.AddDNSRecord(ctx, test.record)
+			if test.conflict == "" {
+				if err != nil {
+					t.Errorf("Expecting no conflict. Got '%v'", err)
+				}
+				return
+			}
+			hookErr, ok := err.(*hookTypes.Error)
+			if !ok || hookErr.Code != http.StatusConflict || strings.Join(hookErr.Details, "\n") != test.conflict {
+				t.Errorf("Expecting a conflict with '%s'. Got '%v'", test.conflict, err)
+			}
+		})
+	}
+	if count := updater.AddCount; count != 4 {
+		t.Errorf("Expecting the conflicting records not to be sent to the nameserver. Got %d additions", count)
+	}
+
+	// the nameserver not answering does not prevent the change
+	updater.err = errors.New("connection refused")
+	if err := m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "new.test.com", Value: "web.test.com", Type: "CNAME"}); err != nil {
+		t.Errorf("Expecting the record to be added when the nameserver cannot be queried. Got '%v'", err)
+	}
+}
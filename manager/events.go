@@ -0,0 +1,186 @@
+package manager
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const (
+	// EventAdd a record has been added
+	EventAdd = "add"
+	// EventUpdate a record has been updated
+	EventUpdate = "update"
+	// EventRemoveScheduled the removal of a record has been scheduled; it is removed from the nameserver once DueAt is reached
+	EventRemoveScheduled = "remove-scheduled"
+	// EventRemoved a record has been removed from the nameserver
+	EventRemoved = "removed"
+
+	defaultEventBuffer = 1000
+	// subscriptionBuffer the number of events a subscriber may lag behind before being dropped
+	subscriptionBuffer = 64
+)
+
+// Event describes a change to the records being managed
+type Event struct {
+	// Seq the sequence number of the event, increasing by one on every event since the startup
+	Seq    uint64    `json:"seq"`
+	Type   string    `json:"type"`
+	Record Record    `json:"record"`
+	Time   time.Time `json:"time"`
+	// DueAt when a scheduled removal is to be executed
+	DueAt *time.Time `json:"dueAt,omitempty"`
+}
+
+// EventFilter selects the events of the records matching all of its non-empty fields
+type EventFilter struct {
+	Type       string
+	NameSuffix string
+}
+
+// matches tells whether the event is selected by the filter
+func (filter EventFilter) matches(e Event) bool {
+	if filter.Type != "" && !strings.EqualFold(filter.Type, e.Record.Type) {
+		return false
+	}
+	return filter.NameSuffix == "" || strings.HasSuffix(strings.ToLower(e.Record.Name), strings.ToLower(filter.NameSuffix))
+}
+
+// Subscription receives the events selected by its filter
+type Subscription struct {
+	// Replay the past events selected by the filter, to be handled before the ones received from C
+	Replay []Event
+	// C receives the events as they happen. It is closed when the subscription is cancelled, when the manager stops
+	// publishing events, or when the subscriber lags too far behind; the subscriber may then resume from the last sequence number handled
+	C      <-chan Event
+	c      chan Event
+	filter EventFilter
+}
+
+// events keeps the recent events in a ring buffer and dispatches the new ones to the subscribers
+type events struct {
+	lock        sync.Mutex
+	seq         uint64
+	buffer      []Event
+	size        int
+	closed      bool
+	subscribers map[*Subscription]struct{}
+	// notify is called with every event, in order, returning the function completing the notification out of the lock
+	notify func(Event) func()
+}
+
+// newEvents creates an event dispatcher keeping the last size events
+func newEvents(size int) *events {
+	if size <= 0 {
+		size = defaultEventBuffer
+	}
+	return &events{size: size, subscribers: make(map[*Subscription]struct{})}
+}
+
+// publish records the event and dispatches it to the subscribers
+func (e *events) publish(eventType string, record Record, dueAt *time.Time) Event {
+	e.lock.Lock()
+	e.seq++
+	event := Event{Seq: e.seq, Type: eventType, Record: record, Time: time.Now(), DueAt: dueAt}
+	if len(e.buffer) == e.size {
+		e.buffer = e.buffer[1:]
+	}
+	e.buffer = append(e.buffer, event)
+	e.dispatch(event)
+	// the notification takes its place in order under the lock, but is persisted out of it
+	var persist func()
+	if e.notify != nil {
+		persist = e.notify(event)
+	}
+	e.lock.Unlock()
+
+	if persist != nil {
+		persist()
+	}
+	return event
+}
+
+// dispatch sends the event to the subscribers it is selected for. It expects the lock to be held
+func (e *events) dispatch(event Event) {
+	for sub := range e.subscribers {
+		if !sub.filter.matches(event) {
+			continue
+		}
+		select {
+		case sub.c <- event:
+		default: // too far behind; it has to resume
+			e.drop(sub)
+		}
+	}
+}
+
+// subscribe registers a subscriber of the events selected by the filter. Events following the sequence number since are
+// replayed; zero means only the new events. It fails with a 410 error if some of them are not kept anymore
+func (e *events) subscribe(filter EventFilter, since uint64) (*Subscription, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.closed {
+		return nil, &hookTypes.Error{Message: "The change stream is shutting down", Code: http.StatusServiceUnavailable}
+	}
+	if since > e.seq || (since > 0 && len(e.buffer) > 0 && since+1 < e.buffer[0].Seq) {
+		return nil, &hookTypes.Error{Message: fmt.Sprintf("The events following %d are not available anymore; the records have to be listed again", since), Code: http.StatusGone}
+	}
+
+	c := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{C: c, c: c, filter: filter}
+	if since > 0 {
+		for _, event := range e.buffer {
+			if event.Seq > since && filter.matches(event) {
+				sub.Replay = append(sub.Replay, event)
+			}
+		}
+	}
+	e.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+// unsubscribe cancels the subscription
+func (e *events) unsubscribe(sub *Subscription) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.drop(sub)
+}
+
+// drop closes the subscription; the lock must be held
+func (e *events) drop(sub *Subscription) {
+	if _, ok := e.subscribers[sub]; ok {
+		delete(e.subscribers, sub)
+		close(sub.c)
+	}
+}
+
+// close closes every subscription and refuses the new ones
+func (e *events) close() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.closed = true
+	for sub := range e.subscribers {
+		e.drop(sub)
+	}
+}
+
+// SubscribeEvents subscribes to the changes to the records selected by the filter, replaying the ones following the sequence number since.
+// The subscription must be cancelled by UnsubscribeEvents
+func (m *Bind9Manager) SubscribeEvents(filter EventFilter, since uint64) (*Subscription, error) {
+	return m.events.subscribe(filter, since)
+}
+
+// UnsubscribeEvents cancels the subscription
+func (m *Bind9Manager) UnsubscribeEvents(sub *Subscription) {
+	m.events.unsubscribe(sub)
+}
+
+// CloseEvents ends every subscription to the changes, so the streams can be closed before shutting down
+func (m *Bind9Manager) CloseEvents() {
+	m.events.close()
+}
@@ -0,0 +1,116 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const eventsBasePath = "./data-events"
+
+func TestEventsSubscribe(t *testing.T) {
+	e := newEvents(3)
+	for _, name := range []string{"a.test.com", "b.test.com", "c.other.com", "d.test.com", "e.test.com"} {
+		e.publish(EventAdd, Record{DNSRecord: hookTypes.DNSRecord{Name: name, Value: "0.0.0.0", Type: "A"}}, nil)
+	}
+
+	tests := []struct {
+		name     string
+		filter   EventFilter
+		since    uint64
+		expected []uint64
+		code     int
+	}{
+		{"new events only", EventFilter{}, 0, nil, 0},
+		{"replay", EventFilter{}, 3, []uint64{4, 5}, 0},
+		{"replay from the oldest kept", EventFilter{}, 2, []uint64{3, 4, 5}, 0},
+		{"replay filtered", EventFilter{NameSuffix: "TEST.com", Type: "a"}, 2, []uint64{4, 5}, 0},
+		{"up to date", EventFilter{}, 5, nil, 0},
+		{"evicted", EventFilter{}, 1, nil, http.StatusGone},
+		{"unknown", EventFilter{}, 6, nil, http.StatusGone},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sub, err := e.subscribe(test.filter, test.since)
+			if test.code != 0 {
+				if hookErr, ok := err.(*hookTypes.Error); !ok || hookErr.Code != test.code {
+					t.Fatalf("Expecting an error with the code %d. Got '%v'", test.code, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer e.unsubscribe(sub)
+			var got []uint64
+			for _, event := range sub.Replay {
+				got = append(got, event.Seq)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("Expecting the events %v to be replayed. Got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestEventsSlowSubscriber(t *testing.T) {
+	e := newEvents(0)
+	sub, _ := e.subscribe(EventFilter{}, 0)
+	for i := 0; i <= subscriptionBuffer; i++ {
+		e.publish(EventAdd, Record{DNSRecord: hookTypes.DNSRecord{Name: "a.test.com", Value: "0.0.0.0", Type: "A"}}, nil)
+	}
+
+	received := 0
+	for range sub.C {
+		received++
+	}
+	if received != subscriptionBuffer {
+		t.Errorf("Expecting the subscription to be closed once %d events are pending. Got %d events", subscriptionBuffer, received)
+	}
+	// the subscriber resumes from the last event received
+	if sub, err := e.subscribe(EventFilter{}, uint64(received)); err != nil || len(sub.Replay) != 1 {
+		t.Errorf("Expecting the missed event to be replayed. Got %+v and err '%v'", sub, err)
+	}
+}
+
+func TestManagerEvents(t *testing.T) {
+	_ = os.RemoveAll(eventsBasePath)
+	defer os.RemoveAll(eventsBasePath)
+	m, err := (&Builder{RemovalDelay: 10 * time.Millisecond}).New(new(MockDNSUpdater), eventsBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, _ := m.SubscribeEvents(EventFilter{}, 0)
+
+	record := hookTypes.DNSRecord{Name: "events.test.com", Value: "0.0.0.1", Type: "A"}
+	_ = m.AddDNSRecord(context.Background(), record)
+	record.Value = "0.0.0.2"
+	_ = m.UpdateDNSRecord(context.Background(), record)
+	_ = m.RemoveDNSRecord(context.Background(), record.Name, record.Type)
+
+	expected := []string{EventAdd, EventUpdate, EventRemoveScheduled, EventRemoved}
+	for i, eventType := range expected {
+		select {
+		case event := <-sub.C:
+			if event.Seq != uint64(i+1) || event.Type != eventType || event.Record.Name != record.Name {
+				t.Errorf("Expecting the event %d to be '%s' of '%s'. Got %+v", i+1, eventType, record.Name, event)
+			}
+			if eventType == EventRemoveScheduled && (event.DueAt == nil || event.Record.Value != "0.0.0.2") {
+				t.Errorf("Expecting the scheduled removal of the last value with its due time. Got %+v", event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expecting the event '%s'", eventType)
+		}
+	}
+
+	_ = m.Shutdown(context.Background())
+	if _, ok := <-sub.C; ok {
+		t.Error("Expecting the subscription to be closed on shutdown")
+	}
+}
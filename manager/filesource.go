@@ -0,0 +1,314 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultFileSourceInterval = 10 * time.Second
+
+// recordFileExtensions the extensions of the files read by the file source
+var recordFileExtensions = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+// FileSourceStatus describes the last convergence of the records of the scope to the record files of the directory
+type FileSourceStatus struct {
+	Dir   string `json:"dir"`
+	Scope string `json:"scope"`
+	// SyncedAt when the records were last converged, successfully or not; unset until then
+	SyncedAt  *time.Time `json:"syncedAt,omitempty"`
+	Converged bool       `json:"converged"`
+	// Plan the id of the changes of the last convergence, and their number
+	Plan    string       `json:"plan,omitempty"`
+	Changes int          `json:"changes"`
+	Error   string       `json:"error,omitempty"`
+	Details []string     `json:"details,omitempty"`
+	Files   []FileStatus `json:"files"`
+}
+
+// FileStatus describes a record file of the file source
+type FileStatus struct {
+	// Path the path of the file within the directory
+	Path    string   `json:"path"`
+	Records int      `json:"records"`
+	Errors  []string `json:"errors,omitempty"`
+	// Stale tells the file is not valid, so the records of its last valid version are used instead
+	Stale bool `json:"stale,omitempty"`
+}
+
+// fileSource converges the records of its scope to the ones of the YAML and JSON files of a directory, read again on every
+// interval. The records of an invalid file are the ones of its last valid version; until it has one, nothing is converged
+type fileSource struct {
+	manager  *Bind9Manager
+	dir      string
+	scope    string
+	interval time.Duration
+	// allowEmpty allows converging to no record file at all
+	allowEmpty bool
+	// syncing serializes the convergences, which own valid
+	syncing sync.Mutex
+	valid   map[string][]Record
+	lock    sync.Mutex
+	status  FileSourceStatus
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+// newFileSource starts converging the records of the scope to the record files of the directory. Unless allowEmpty is set,
+// nothing is converged while the directory holds no record file, as happens when it is not checked out yet
+func newFileSource(m *Bind9Manager, dir, scope string, interval time.Duration, allowEmpty bool) *fileSource {
+	if interval <= 0 {
+		interval = defaultFileSourceInterval
+	}
+	fs := &fileSource{
+		manager:    m,
+		dir:        dir,
+		scope:      scope,
+		interval:   interval,
+		allowEmpty: allowEmpty,
+		valid:      make(map[string][]Record),
+		status:     FileSourceStatus{Dir: dir, Scope: scope, Files: []FileStatus{}},
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go fs.run()
+	return fs
+}
+
+// run converges the records right away, then on every interval until stopped
+func (fs *fileSource) run() {
+	defer close(fs.done)
+	ticker := time.NewTicker(fs.interval)
+	defer ticker.Stop()
+	for {
+		fs.converge(context.Background())
+		select {
+		case <-fs.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// converge reads the record files and applies the changes turning the records of the scope into theirs
+func (fs *fileSource) converge(ctx context.Context) {
+	fs.syncing.Lock()
+	defer fs.syncing.Unlock()
+
+	now := time.Now()
+	status := FileSourceStatus{Dir: fs.dir, Scope: fs.scope, SyncedAt: &now}
+	files, records, err := fs.read()
+	status.Files = files
+	if err == nil {
+		var plan *Plan
+		if plan, err = fs.manager.applyChanges(ctx, DesiredState{Scope: fs.scope, Records: records}); err == nil {
+			status.Converged, status.Plan, status.Changes = true, plan.ID, len(plan.Changes)
+		}
+	}
+	if err != nil {
+		status.Error = err.Error()
+		if e, ok := err.(*hookTypes.Error); ok {
+			status.Error, status.Details = e.Message, e.Details
+		}
+	}
+
+	fs.lock.Lock()
+	previous := fs.status
+	fs.status = status
+	fs.lock.Unlock()
+	fs.log(previous, status)
+}
+
+// log reports the problems of the convergence, only when they differ from the ones of the previous convergence
+func (fs *fileSource) log(previous, status FileSourceStatus) {
+	if status.Changes > 0 {
+		logrus.Infof("Converged the records of '%s' to the files of '%s' with %d changes", fs.scope, fs.dir, status.Changes)
+	}
+	known := make(map[string][]string)
+	for _, file := range previous.Files {
+		known[file.Path] = file.Errors
+	}
+	for _, file := range status.Files {
+		if len(file.Errors) > 0 && !reflect.DeepEqual(file.Errors, known[file.Path]) {
+			logrus.Errorf("The record file '%s' is not valid: %s", file.Path, strings.Join(file.Errors, "; "))
+		}
+	}
+	if status.Error != "" && (status.Error != previous.Error || !reflect.DeepEqual(status.Details, previous.Details)) {
+		logrus.Errorf("Not possible to converge the records of '%s' to the files of '%s': %s %v", fs.scope, fs.dir, status.Error, status.Details)
+	}
+}
+
+// read reads every record file of the directory and its subdirectories, hidden ones excepted, returning the status of each
+// file and the records to converge to. It fails when the directory cannot be read, a file is invalid with no valid version, or
+// there is no record file while not allowed
+func (fs *fileSource) read() ([]FileStatus, []Record, error) {
+	var paths []string
+	err := filepath.Walk(fs.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		hidden := path != fs.dir && strings.HasPrefix(info.Name(), ".")
+		if info.IsDir() {
+			if hidden {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !hidden && recordFileExtensions[strings.ToLower(filepath.Ext(path))] {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return []FileStatus{}, nil, hookTypes.InternalServerError(fmt.Sprintf("Not possible to read the record files of '%s'", fs.dir), err)
+	}
+
+	files := make([]FileStatus, 0, len(paths))
+	var records []Record
+	var invalid []string
+	desired := make(map[string]string)
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		rel, _ := filepath.Rel(fs.dir, path)
+		seen[rel] = true
+		file := FileStatus{Path: rel}
+		recs, errs := fs.readFile(path)
+		for i, r := range recs {
+			key := fs.manager.getRecordFileName(r.Name, r.Type)
+			if other, ok := desired[key]; ok {
+				errs = append(errs, fmt.Sprintf("records[%d]: the %s record '%s' is already desired by '%s'", i, r.Type, r.Name, other))
+			}
+		}
+		file.Errors = errs
+		if len(errs) == 0 {
+			fs.valid[rel] = recs
+		} else if last, ok := fs.valid[rel]; ok {
+			file.Stale, recs = true, last
+		} else {
+			invalid = append(invalid, rel)
+			recs = nil
+		}
+		for _, r := range recs {
+			desired[fs.manager.getRecordFileName(r.Name, r.Type)] = rel
+		}
+		file.Records = len(recs)
+		records = append(records, recs...)
+		files = append(files, file)
+	}
+	for rel := range fs.valid {
+		if !seen[rel] {
+			delete(fs.valid, rel)
+		}
+	}
+
+	if len(invalid) > 0 {
+		return files, nil, hookTypes.BadRequestError("Not converged, as some record files are invalid and have no valid version", nil, invalid...)
+	}
+	if len(files) == 0 && !fs.allowEmpty {
+		return files, nil, hookTypes.BadRequestError(fmt.Sprintf("Not converged, as no record file was found in '%s'; allow an empty file source to remove every record of the scope", fs.dir), nil)
+	}
+	return files, records, nil
+}
+
+// readFile reads the records of the file, a list of records or an object holding them in its records field, returning
+// them in their canonical form or the problems found
+func (fs *fileSource) readFile(path string) ([]Record, []string) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+	var state DesiredState
+	if j, jErr := yaml.YAMLToJSON(b); jErr == nil && strings.HasPrefix(strings.TrimSpace(string(j)), "[") {
+		err = yaml.Unmarshal(b, &state.Records)
+	} else {
+		err = yaml.Unmarshal(b, &state)
+	}
+	if err != nil {
+		return nil, []string{fmt.Sprintf("not possible to parse the file: %v", err)}
+	}
+
+	_, records, err := fs.manager.desired(DesiredState{Scope: fs.scope, Records: state.Records})
+	if err != nil {
+		if e, ok := err.(*hookTypes.Error); ok && len(e.Details) > 0 {
+			return nil, e.Details
+		}
+		return nil, []string{err.Error()}
+	}
+	return records, nil
+}
+
+// get returns a copy of the status of the last convergence
+func (fs *fileSource) get() FileSourceStatus {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	status := fs.status
+	status.Files = append([]FileStatus{}, fs.status.Files...)
+	return status
+}
+
+// stop stops converging the records, waiting for the convergence in progress to finish or the context to be done
+func (fs *fileSource) stop(ctx context.Context) error {
+	fs.lock.Lock()
+	select {
+	case <-fs.quit:
+	default:
+		close(fs.quit)
+	}
+	fs.lock.Unlock()
+	select {
+	case <-fs.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// owns tells whether the records of the name are owned by the file source
+func (fs *fileSource) owns(name string) bool {
+	return inScope(name, fs.scope)
+}
+
+// checkOwner fails with a forbidden error when the records of the name are owned by the file source, so they can only be
+// changed through its files
+func (m *Bind9Manager) checkOwner(name string) error {
+	if m.files == nil || !m.files.owns(name) {
+		return nil
+	}
+	return &hookTypes.Error{
+		Message: fmt.Sprintf("The records of '%s' are owned by the file source of the scope '%s'; change them through its files instead", name, m.files.scope),
+		Code:    http.StatusForbidden,
+	}
+}
+
+// checkScopeOwner fails with a forbidden error when the scope overlaps the scope of the file source
+func (m *Bind9Manager) checkScopeOwner(scope string) error {
+	scope, err := nsupdate.NormalizeName(scope)
+	if err != nil || m.files == nil || !(m.files.owns(scope) || inScope(m.files.scope, scope)) {
+		return nil
+	}
+	return &hookTypes.Error{
+		Message: fmt.Sprintf("The scope '%s' overlaps the scope '%s' owned by the file source; change its records through its files instead", scope, m.files.scope),
+		Code:    http.StatusForbidden,
+	}
+}
+
+// GetFileSourceStatus retrieves the status of the last convergence of the records to the files of the file source
+func (m *Bind9Manager) GetFileSourceStatus() (*FileSourceStatus, error) {
+	if m.files == nil {
+		return nil, hookTypes.NotFoundError("The file source is not enabled", nil)
+	}
+	status := m.files.get()
+	return &status, nil
+}
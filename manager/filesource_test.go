@@ -0,0 +1,212 @@
+package manager
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const (
+	fileSourceBasePath = "./data-filesource"
+	fileSourceDirPath  = "./data-filesource-records"
+)
+
+// writeRecordFile writes the record file at the path within the file source directory
+func writeRecordFile(t *testing.T, path, content string) {
+	path = filepath.Join(fileSourceDirPath, path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// storedRecords lists the stored records as "name type value"
+func storedRecords(m *Bind9Manager) string {
+	records, _ := m.GetDNSRecords()
+	var result []string
+	for _, r := range records {
+		result = append(result, r.Name+" "+r.Type+" "+r.Value)
+	}
+	return strings.Join(result, "\n")
+}
+
+func TestFileSource(t *testing.T) {
+	_ = os.RemoveAll(fileSourceBasePath)
+	_ = os.RemoveAll(fileSourceDirPath)
+	defer os.RemoveAll(fileSourceBasePath)
+	defer os.RemoveAll(fileSourceDirPath)
+
+	writeRecordFile(t, "web.yaml", `
+- name: web.test.com
+  type: A
+  value: 0.0.0.1
+- name: www.test.com
+  type: CNAME
+  value: web.test.com.
+`)
+	writeRecordFile(t, "mail/mx.json", `{"records": [{"name": "test.com", "type": "MX", "data": {"priority": 10, "target": "mail.test.com"}}]}`)
+	writeRecordFile(t, ".git/ignored.json", `[{"name": "ignored.test.com", "type": "A", "value": "0.0.0.9"}]`)
+	writeRecordFile(t, "README.md", "not a record file")
+
+	updater := new(mockBatchUpdater)
+	m, err := (&Builder{RemovalDelay: time.Hour, FileSourceDir: fileSourceDirPath, FileSourceScope: "test.com", FileSourceInterval: time.Hour}).New(updater, fileSourceBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.files.stop(context.Background())
+	ctx := context.Background()
+	_ = waitUntil(ctx, func() bool { s, _ := m.GetFileSourceStatus(); return s.SyncedAt != nil })
+
+	status, _ := m.GetFileSourceStatus()
+	if !status.Converged || status.Changes != 3 || len(status.Files) != 2 {
+		t.Fatalf("Expecting the 3 records of the 2 files to be added. Got %+v", status)
+	}
+	expected := "test.com MX 10 mail.test.com.\nweb.test.com A 0.0.0.1\nwww.test.com CNAME web.test.com."
+	if got := storedRecords(m); got != expected {
+		t.Errorf("Expecting the records\n%s\nGot\n%s", expected, got)
+	}
+
+	// the records of the scope cannot be changed through the API
+	err = m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "api.test.com", Value: "0.0.0.2", Type: "A"})
+	if hookErr, ok := err.(*hookTypes.Error); !ok || hookErr.Code != http.StatusForbidden {
+		t.Errorf("Expecting the addition to be forbidden. Got '%v'", err)
+	}
+	err = m.RemoveDNSRecord(ctx, "web.test.com", "A")
+	if hookErr, ok := err.(*hookTypes.Error); !ok || hookErr.Code != http.StatusForbidden {
+		t.Errorf("Expecting the removal to be forbidden. Got '%v'", err)
+	}
+	_, err = m.ApplyChanges(ctx, DesiredState{Scope: "com"})
+	if hookErr, ok := err.(*hookTypes.Error); !ok || hookErr.Code != http.StatusForbidden {
+		t.Errorf("Expecting an apply overlapping the scope to be forbidden. Got '%v'", err)
+	}
+	if err := m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "app.other.com", Value: "0.0.0.3", Type: "A"}); err != nil {
+		t.Errorf("Expecting the records out of the scope to be changed through the API. Got '%v'", err)
+	}
+
+	// an invalid file keeps its last valid records, and a removed file has its records removed
+	writeRecordFile(t, "web.yaml", `
+- name: web.test.com
+  type: A
+  value: 0.0.0.5
+- name: web.other.com
+  type: A
+  value: 0.0.0.6
+`)
+	_ = os.RemoveAll(filepath.Join(fileSourceDirPath, "mail"))
+	writeRecordFile(t, "new.json", `[{"name": "new.test.com", "type": "A", "value": "0.0.0.7"}, {"name": "new.test.com", "type": "AAAA"}]`)
+	m.files.converge(ctx)
+
+	status, _ = m.GetFileSourceStatus()
+	if status.Converged || !strings.Contains(status.Error, "invalid") || len(status.Details) != 1 || status.Details[0] != "new.json" {
+		t.Errorf("Expecting the convergence to be held by new.json. Got %+v", status)
+	}
+	var web FileStatus
+	for _, file := range status.Files {
+		if file.Path == "web.yaml" {
+			web = file
+		}
+	}
+	if !web.Stale || web.Records != 2 || len(web.Errors) != 1 || !strings.Contains(web.Errors[0], "out of the scope") {
+		t.Errorf("Expecting web.yaml to be reported with its last valid records. Got %+v", web)
+	}
+
+	writeRecordFile(t, "new.json", `[{"name": "new.test.com", "type": "A", "value": "0.0.0.7"}]`)
+	m.files.converge(ctx)
+	status, _ = m.GetFileSourceStatus()
+	if !status.Converged || status.Changes != 2 {
+		t.Errorf("Expecting new.test.com to be added and the MX record removed. Got %+v", status)
+	}
+	expected = "app.other.com A 0.0.0.3\nnew.test.com A 0.0.0.7\nweb.test.com A 0.0.0.1\nwww.test.com CNAME web.test.com."
+	if got := storedRecords(m); got != expected {
+		t.Errorf("Expecting the records\n%s\nGot\n%s", expected, got)
+	}
+
+	// the records are converged again when changed by other means
+	m.removeRecord("new.test.com", "A")
+	m.files.converge(ctx)
+	if !m.HasDNSRecord("new.test.com", "A") {
+		t.Error("Expecting the missing record to be added again")
+	}
+}
+
+func TestFileSourceDuplicates(t *testing.T) {
+	_ = os.RemoveAll(fileSourceBasePath)
+	_ = os.RemoveAll(fileSourceDirPath)
+	defer os.RemoveAll(fileSourceBasePath)
+	defer os.RemoveAll(fileSourceDirPath)
+
+	writeRecordFile(t, "a.yaml", "records:\n  - {name: web.test.com, type: A, value: 0.0.0.1}\n")
+	writeRecordFile(t, "b.yml", "- {name: Web.test.com., type: a, value: 0.0.0.2}\n")
+
+	m, err := (&Builder{FileSourceDir: fileSourceDirPath, FileSourceScope: "test.com", FileSourceInterval: time.Hour}).New(new(mockBatchUpdater), fileSourceBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.files.stop(context.Background())
+	_ = waitUntil(context.Background(), func() bool { s, _ := m.GetFileSourceStatus(); return s.SyncedAt != nil })
+
+	status, _ := m.GetFileSourceStatus()
+	if status.Converged || len(status.Files) != 2 || len(status.Files[1].Errors) != 1 || status.Files[1].Errors[0] != "records[0]: the A record 'web.test.com' is already desired by 'a.yaml'" {
+		t.Errorf("Expecting b.yml to be reported as a duplicate of a.yaml. Got %+v", status)
+	}
+}
+
+func TestFileSourceEmpty(t *testing.T) {
+	_ = os.RemoveAll(fileSourceBasePath)
+	_ = os.RemoveAll(fileSourceDirPath)
+	defer os.RemoveAll(fileSourceBasePath)
+	defer os.RemoveAll(fileSourceDirPath)
+
+	updater := new(mockBatchUpdater)
+	m, err := (&Builder{RemovalDelay: time.Hour}).New(updater, fileSourceBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "web.test.com", Value: "0.0.0.1", Type: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	writeRecordFile(t, "README.md", "not a record file")
+
+	m, err = (&Builder{RemovalDelay: time.Hour, FileSourceDir: fileSourceDirPath, FileSourceScope: "test.com", FileSourceInterval: time.Hour}).New(updater, fileSourceBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.files.stop(ctx)
+	_ = waitUntil(ctx, func() bool { s, _ := m.GetFileSourceStatus(); return s.SyncedAt != nil })
+
+	status, _ := m.GetFileSourceStatus()
+	if status.Converged || !strings.Contains(status.Error, "no record file") {
+		t.Errorf("Expecting a directory with no record file not to be converged to. Got %+v", status)
+	}
+	if !m.HasDNSRecord("web.test.com", "A") {
+		t.Error("Expecting the records of the scope to be kept")
+	}
+
+	m.files.allowEmpty = true
+	m.files.converge(ctx)
+	if status, _ := m.GetFileSourceStatus(); !status.Converged || status.Changes != 1 || m.HasDNSRecord("web.test.com", "A") {
+		t.Errorf("Expecting the records of the scope to be removed when an empty file source is allowed. Got %+v", status)
+	}
+}
+
+func TestFileSourceNotSupported(t *testing.T) {
+	_ = os.RemoveAll(fileSourceBasePath)
+	defer os.RemoveAll(fileSourceBasePath)
+
+	if _, err := (&Builder{FileSourceDir: fileSourceDirPath, FileSourceScope: "test.com"}).New(new(MockDNSUpdater), fileSourceBasePath); err == nil {
+		t.Error("Expecting the file source to require a DNSUpdater applying several changes at once")
+	}
+	if _, err := (&Builder{FileSourceDir: fileSourceDirPath}).New(new(mockBatchUpdater), fileSourceBasePath); err == nil {
+		t.Error("Expecting the file source to require a scope")
+	}
+}
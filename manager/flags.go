@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
@@ -8,21 +9,103 @@ import (
 )
 
 const (
-	dnsTtl                 = "dns-ttl"
-	dnsRemovalDelay        = "dns-removal-delay"
-	defaultDnsTtl          = time.Hour
-	defaultDnsRemovalDelay = 10 * time.Minute
+	dnsTtl                    = "dns-ttl"
+	dnsRemovalDelay           = "dns-removal-delay"
+	dnsRemovalConcurrency     = "dns-removal-concurrency"
+	queuePrefix               = "queue."
+	queueEnabled              = queuePrefix + "enabled"
+	queueSize                 = queuePrefix + "size"
+	queueWorkers              = queuePrefix + "workers"
+	queueRetention            = queuePrefix + "retention"
+	coalesceWindow            = "coalesce-window"
+	store                     = "store"
+	shutdownPrefix            = "shutdown."
+	shutdownTimeout           = shutdownPrefix + "timeout"
+	shutdownPendingRemovals   = shutdownPrefix + "pending-removals"
+	eventsBuffer              = "events.buffer"
+	webhookPrefix             = "webhook."
+	webhookURLs               = webhookPrefix + "urls"
+	webhookSecret             = webhookPrefix + "secret"
+	webhookTimeout            = webhookPrefix + "timeout"
+	webhookMaxAttempts        = webhookPrefix + "max-attempts"
+	propagationPrefix         = "propagation."
+	propagationSecondaries    = propagationPrefix + "secondaries"
+	propagationInterval       = propagationPrefix + "interval"
+	fileSourcePrefix          = "filesource."
+	fileSourceDir             = fileSourcePrefix + "dir"
+	fileSourceScope           = fileSourcePrefix + "scope"
+	fileSourceInterval        = fileSourcePrefix + "interval"
+	fileSourceAllowEmpty      = fileSourcePrefix + "allow-empty"
+	defaultDnsTtl             = time.Hour
+	defaultDnsRemovalDelay    = 10 * time.Minute
+	defaultRemovalConcurrency = 4
+	defaultQueueSize          = 1000
+	defaultQueueWorkers       = 4
+	defaultOperationRetention = time.Hour
+	defaultShutdownTimeout    = 30 * time.Second
 )
 
 // AddFlags adds flags for Options.
 func AddFlags(flags *pflag.FlagSet) {
 	flags.Duration(dnsTtl, defaultDnsTtl, "DNS recording rule expiration time (or time-to-live). Valid time units are \"ns\", \"us\" (or \"µs\"), \"ms\", \"s\", \"m\", \"h\"")
 	flags.Duration(dnsRemovalDelay, defaultDnsRemovalDelay, "Delay in minutes to be applied to the removal of an DNS entry. This is to guarantee that in fact the removal should be processed. Valid time units are \"ns\", \"us\" (or \"µs\"), \"ms\", \"s\", \"m\", \"h\"")
+	flags.Int(dnsRemovalConcurrency, defaultRemovalConcurrency, "Maximum number of delayed removals sent to the nameserver at the same time")
+	flags.Bool(queueEnabled, false, "Enables the asynchronous mode: mutations are put on a persistent write queue and the API answers with the id of an operation whose status can be polled")
+	flags.Int(queueSize, defaultQueueSize, "Maximum number of pending operations in the write queue")
+	flags.Int(queueWorkers, defaultQueueWorkers, "Number of workers concurrently applying the operations of the write queue")
+	flags.Duration(queueRetention, defaultOperationRetention, "How long the status of a finished operation is kept available")
+	flags.Duration(coalesceWindow, 0, "Time window in which successive changes to the same record are collapsed into their net effect before being sent to the nameserver. Zero disables the coalescing")
+	flags.String(store, StoreDiskv, "Backend of the record store: \"diskv\" keeps each record in its own file, \"bolt\" keeps them in a single embedded database with transactions")
+	flags.Duration(shutdownTimeout, defaultShutdownTimeout, "Maximum time to wait for the running updates and removals to finish on shutdown")
+	flags.Int(eventsBuffer, defaultEventBuffer, "Number of recent record changes kept for the clients resuming the change stream")
+	flags.StringSlice(webhookURLs, nil, "Comma separated list of the URLs notified by a POST request of every change to the records. Empty disables the notifications")
+	flags.String(webhookSecret, "", "Secret keying the HMAC-SHA256 signature of the notifications, sent in the X-Bindman-Signature header. Required by the webhook URLs")
+	flags.Duration(webhookTimeout, defaultWebhookTimeout, "Maximum time a notification request may take")
+	flags.Int(webhookMaxAttempts, defaultWebhookMaxAttempts, "Maximum number of times a notification is sent before being dropped")
+	flags.StringSlice(propagationSecondaries, nil, "Comma separated list of the secondary nameservers, as host or host:port, whose propagation of the changes is tracked. Empty disables the tracking")
+	flags.Duration(propagationInterval, defaultPropagationInterval, "Interval between two queries of the serial of the zone served by the secondary nameservers")
+	flags.String(fileSourceDir, "", "Directory of YAML and JSON record files, such as a checked out Git repository, the records of the file source scope are continuously converged to. Empty disables the file source")
+	flags.String(fileSourceScope, "", "Zone or domain within it whose records are owned by the file source. Required with the file source")
+	flags.Duration(fileSourceInterval, defaultFileSourceInterval, "Interval between two readings of the record files of the file source")
+	flags.Bool(fileSourceAllowEmpty, false, "Converges the file source even when its directory holds no record file, removing every record of its scope. Otherwise nothing is converged then")
+	flags.String(shutdownPendingRemovals, ShutdownPersist, "What to do with the removals still waiting for their delay on shutdown: \"persist\" them to be scheduled again on the next startup, or \"execute\" them right away")
 }
 
 // InitFromViper initializes Options with properties retrieved from Viper.
 func (b *Builder) InitFromViper(v *viper.Viper) *Builder {
 	b.TTL = v.GetDuration(dnsTtl)
 	b.RemovalDelay = v.GetDuration(dnsRemovalDelay)
+	b.RemovalConcurrency = v.GetInt(dnsRemovalConcurrency)
+	b.Async = v.GetBool(queueEnabled)
+	b.QueueSize = v.GetInt(queueSize)
+	b.QueueWorkers = v.GetInt(queueWorkers)
+	b.OperationRetention = v.GetDuration(queueRetention)
+	b.CoalesceWindow = v.GetDuration(coalesceWindow)
+	b.Store = v.GetString(store)
+	b.ShutdownTimeout = v.GetDuration(shutdownTimeout)
+	b.PendingRemovalsOnShutdown = v.GetString(shutdownPendingRemovals)
+	b.EventBuffer = v.GetInt(eventsBuffer)
+	b.WebhookURLs = getList(v, webhookURLs)
+	b.WebhookSecret = v.GetString(webhookSecret)
+	b.WebhookTimeout = v.GetDuration(webhookTimeout)
+	b.WebhookMaxAttempts = v.GetInt(webhookMaxAttempts)
+	b.Secondaries = getList(v, propagationSecondaries)
+	b.PropagationInterval = v.GetDuration(propagationInterval)
+	b.FileSourceDir = v.GetString(fileSourceDir)
+	b.FileSourceScope = v.GetString(fileSourceScope)
+	b.FileSourceInterval = v.GetDuration(fileSourceInterval)
+	b.FileSourceAllowEmpty = v.GetBool(fileSourceAllowEmpty)
 	return b
 }
+
+// getList reads a list property, accepting comma separated values as the ones coming from environment variables
+func getList(v *viper.Viper, key string) (list []string) {
+	for _, item := range v.GetStringSlice(key) {
+		for _, value := range strings.Split(item, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				list = append(list, value)
+			}
+		}
+	}
+	return
+}
@@ -19,6 +19,25 @@ func TestBingFlags(t *testing.T) {
 	err := command.ParseFlags([]string{
 		fmt.Sprintf("--%s=10s", dnsTtl),
 		fmt.Sprintf("--%s=10s", dnsRemovalDelay),
+		fmt.Sprintf("--%s=2", dnsRemovalConcurrency),
+		fmt.Sprintf("--%s=true", queueEnabled),
+		fmt.Sprintf("--%s=10", queueSize),
+		fmt.Sprintf("--%s=2", queueWorkers),
+		fmt.Sprintf("--%s=10s", queueRetention),
+		fmt.Sprintf("--%s=1s", coalesceWindow),
+		fmt.Sprintf("--%s=%s", store, StoreBolt),
+		fmt.Sprintf("--%s=5s", shutdownTimeout),
+		fmt.Sprintf("--%s=%s", shutdownPendingRemovals, ShutdownExecute),
+		fmt.Sprintf("--%s=10", eventsBuffer),
+		fmt.Sprintf("--%s=http://a.test.com/hook,http://b.test.com/hook", webhookURLs),
+		fmt.Sprintf("--%s=secret", webhookSecret),
+		fmt.Sprintf("--%s=5s", webhookTimeout),
+		fmt.Sprintf("--%s=3", webhookMaxAttempts),
+		fmt.Sprintf("--%s=ns2.test.com,ns3.test.com:5353", propagationSecondaries),
+		fmt.Sprintf("--%s=5s", propagationInterval),
+		fmt.Sprintf("--%s=/records", fileSourceDir),
+		fmt.Sprintf("--%s=apps.test.com", fileSourceScope),
+		fmt.Sprintf("--%s=1m", fileSourceInterval),
 	})
 	require.NoError(t, err)
 
@@ -27,6 +46,25 @@ func TestBingFlags(t *testing.T) {
 
 	assert.Equal(t, time.Second*10, b.TTL)
 	assert.Equal(t, time.Second*10, b.RemovalDelay)
+	assert.Equal(t, 2, b.RemovalConcurrency)
+	assert.Equal(t, true, b.Async)
+	assert.Equal(t, 10, b.QueueSize)
+	assert.Equal(t, 2, b.QueueWorkers)
+	assert.Equal(t, time.Second*10, b.OperationRetention)
+	assert.Equal(t, time.Second, b.CoalesceWindow)
+	assert.Equal(t, StoreBolt, b.Store)
+	assert.Equal(t, time.Second*5, b.ShutdownTimeout)
+	assert.Equal(t, ShutdownExecute, b.PendingRemovalsOnShutdown)
+	assert.Equal(t, 10, b.EventBuffer)
+	assert.Equal(t, []string{"http://a.test.com/hook", "http://b.test.com/hook"}, b.WebhookURLs)
+	assert.Equal(t, "secret", b.WebhookSecret)
+	assert.Equal(t, time.Second*5, b.WebhookTimeout)
+	assert.Equal(t, 3, b.WebhookMaxAttempts)
+	assert.Equal(t, []string{"ns2.test.com", "ns3.test.com:5353"}, b.Secondaries)
+	assert.Equal(t, time.Second*5, b.PropagationInterval)
+	assert.Equal(t, "/records", b.FileSourceDir)
+	assert.Equal(t, "apps.test.com", b.FileSourceScope)
+	assert.Equal(t, time.Minute, b.FileSourceInterval)
 }
 
 func TestDefaultValues(t *testing.T) {
@@ -40,4 +78,31 @@ func TestDefaultValues(t *testing.T) {
 
 	assert.Equal(t, defaultDnsTtl, b.TTL)
 	assert.Equal(t, defaultDnsRemovalDelay, b.RemovalDelay)
+	assert.Equal(t, defaultRemovalConcurrency, b.RemovalConcurrency)
+	assert.Equal(t, false, b.Async)
+	assert.Equal(t, defaultQueueSize, b.QueueSize)
+	assert.Equal(t, defaultQueueWorkers, b.QueueWorkers)
+	assert.Equal(t, defaultOperationRetention, b.OperationRetention)
+	assert.Equal(t, time.Duration(0), b.CoalesceWindow)
+	assert.Equal(t, StoreDiskv, b.Store)
+	assert.Equal(t, defaultShutdownTimeout, b.ShutdownTimeout)
+	assert.Equal(t, ShutdownPersist, b.PendingRemovalsOnShutdown)
+	assert.Equal(t, defaultEventBuffer, b.EventBuffer)
+	assert.Empty(t, b.WebhookURLs)
+	assert.Equal(t, defaultWebhookTimeout, b.WebhookTimeout)
+	assert.Equal(t, defaultWebhookMaxAttempts, b.WebhookMaxAttempts)
+	assert.Empty(t, b.Secondaries)
+	assert.Equal(t, defaultPropagationInterval, b.PropagationInterval)
+	assert.Empty(t, b.FileSourceDir)
+	assert.Equal(t, defaultFileSourceInterval, b.FileSourceInterval)
+}
+
+func TestWebhookURLsFromEnvironment(t *testing.T) {
+	v := viper.New()
+	v.Set(webhookURLs, "http://a.test.com/hook, http://b.test.com/hook")
+
+	b := &Builder{}
+	b.InitFromViper(v)
+
+	assert.Equal(t, []string{"http://a.test.com/hook", "http://b.test.com/hook"}, b.WebhookURLs)
 }
@@ -0,0 +1,166 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// QuarantineDir the sub-directory of the data directory where the problematic record files are moved to
+	QuarantineDir = "quarantine"
+
+	// ProblemCorrupt the record cannot be parsed
+	ProblemCorrupt = "corrupt"
+	// ProblemInvalid the record is parsed but misses its name, value or type
+	ProblemInvalid = "invalid"
+	// ProblemDuplicate another record file holds the same record
+	ProblemDuplicate = "duplicate"
+)
+
+// FsckProblem describes a problematic record file
+type FsckProblem struct {
+	Key     string `json:"key"`
+	Problem string `json:"problem"`
+	Detail  string `json:"detail"`
+	// QuarantinedTo the file the record has been moved to, when repairing
+	QuarantinedTo string `json:"quarantinedTo,omitempty"`
+}
+
+// FsckReport describes the outcome of an integrity check of the stored records
+type FsckReport struct {
+	Checked  int           `json:"checked"`
+	Problems []FsckProblem `json:"problems"`
+}
+
+// Fsck checks every stored record, looking for corrupt, invalid and duplicate records. When repair is set, the problematic
+// records are moved out of the store to the quarantine directory inside basePath. Of a set of duplicates, the one stored at
+// the normalized key, or else the last updated one, is kept
+func Fsck(store RecordStore, basePath string, repair bool) (*FsckReport, error) {
+	keys, err := store.Keys("")
+	if err != nil {
+		return nil, err
+	}
+
+	report := &FsckReport{Checked: len(keys)}
+	type candidate struct {
+		key       string
+		updatedAt time.Time
+	}
+	kept := make(map[string]candidate)
+	for _, key := range keys {
+		b, err := store.Read(key)
+		if err != nil {
+			return nil, fmt.Errorf("not possible to read the record '%s': %v", key, err)
+		}
+		env, _, err := decodeRecord(b)
+		if err != nil {
+			report.Problems = append(report.Problems, FsckProblem{Key: key, Problem: ProblemCorrupt, Detail: err.Error()})
+			continue
+		}
+		if errs := env.Record.Check(); errs != nil {
+			report.Problems = append(report.Problems, FsckProblem{Key: key, Problem: ProblemInvalid, Detail: strings.Join(errs, "; ")})
+			continue
+		}
+
+		normalized := recordKey(env.Record.Name, env.Record.Type)
+		current := candidate{key: key, updatedAt: env.UpdatedAt}
+		previous, ok := kept[normalized]
+		if !ok {
+			kept[normalized] = current
+			continue
+		}
+		if previous.key == normalized || (current.key != normalized && !current.updatedAt.After(previous.updatedAt)) {
+			previous, current = current, previous
+		} else {
+			kept[normalized] = current
+		}
+		report.Problems = append(report.Problems, FsckProblem{Key: previous.key, Problem: ProblemDuplicate, Detail: fmt.Sprintf("holds the same record as '%s'", current.key)})
+	}
+
+	if repair {
+		for i := range report.Problems {
+			problem := &report.Problems[i]
+			if problem.QuarantinedTo, err = quarantine(store, basePath, problem.Key); err != nil {
+				return report, fmt.Errorf("not possible to quarantine the record '%s': %v", problem.Key, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+// quarantine moves the record out of the store to the quarantine directory, returning the path of the file it is moved to
+func quarantine(store RecordStore, basePath, key string) (string, error) {
+	b, err := store.Read(key)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(basePath, QuarantineDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	// the suffix keeps the quarantined file from being taken for a record
+	path := filepath.Join(dir, fmt.Sprintf("%s.%d", key, time.Now().UnixNano()))
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return "", err
+	}
+	return path, store.Erase(key)
+}
+
+// RebuildRecords stores the records served by the nameserver that are missing from the store, in their canonical form,
+// returning them. When dryRun is set, the missing records are only returned. The served records whose name is not valid
+// are left out
+func RebuildRecords(store RecordStore, served []hookTypes.DNSRecord, dryRun bool) ([]hookTypes.DNSRecord, error) {
+	var missing []hookTypes.DNSRecord
+	err := store.Update(func(tx RecordTx) error {
+		now := time.Now()
+		seen := make(map[string]bool)
+		for _, r := range served {
+			record := Record{DNSRecord: r}
+			if err := normalizeRecord(&record); err != nil {
+				logrus.Warnf("Not rebuilding the %s record '%s': %v", r.Type, r.Name, err)
+				continue
+			}
+			key := recordKey(record.Name, record.Type)
+			if seen[key] || tx.Has(key) {
+				continue
+			}
+			seen[key] = true
+			missing = append(missing, record.DNSRecord)
+			if dryRun {
+				continue
+			}
+			b, err := json.Marshal(newEnvelope(record, nil, now))
+			if err != nil {
+				return err
+			}
+			if err := tx.Write(key, b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// checkRecords quarantines the problematic records on startup, logging them
+func checkRecords(store RecordStore, basePath string) error {
+	report, err := Fsck(store, basePath, true)
+	if err != nil {
+		return err
+	}
+	for _, problem := range report.Problems {
+		logrus.Warnf("Quarantined the %s record '%s' to '%s': %s", problem.Problem, problem.Key, problem.QuarantinedTo, problem.Detail)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const fsckBasePath = "./data-fsck"
+
+func TestFsck(t *testing.T) {
+	_ = os.RemoveAll(fsckBasePath)
+	defer os.RemoveAll(fsckBasePath)
+
+	store := newDiskvStore(fsckBasePath)
+	stored := map[string]string{
+		"ok.test.com.A.bindman":     `{"version":1,"record":{"name":"ok.test.com","value":"0.0.0.1","type":"A"},"createdAt":"2020-01-01T00:00:00Z","updatedAt":"2020-01-01T00:00:00Z"}`,
+		"broken.test.com.A.bindman": `{"name":`,
+		"empty.test.com.A.bindman":  `{"version":1,"record":{"name":"empty.test.com","type":"A"}}`,
+		"dup.test.com.A.bindman":    `{"version":1,"record":{"name":"dup.test.com","value":"0.0.0.2","type":"A"},"createdAt":"2020-01-01T00:00:00Z","updatedAt":"2020-01-01T00:00:00Z"}`,
+		"Dup.test.com.A.bindman":    `{"version":1,"record":{"name":"Dup.test.com","value":"0.0.0.3","type":"A"},"createdAt":"2020-01-01T00:00:00Z","updatedAt":"2020-01-02T00:00:00Z"}`,
+		"Other.test.com.A.bindman":  `{"version":1,"record":{"name":"Other.test.com","value":"0.0.0.4","type":"A"},"createdAt":"2020-01-01T00:00:00Z","updatedAt":"2020-01-01T00:00:00Z"}`,
+		"OTHER.test.com.A.bindman":  `{"version":1,"record":{"name":"OTHER.test.com","value":"0.0.0.5","type":"A"},"createdAt":"2020-01-01T00:00:00Z","updatedAt":"2020-01-02T00:00:00Z"}`,
+	}
+	for key, value := range stored {
+		if err := store.Write(key, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := Fsck(store, fsckBasePath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != len(stored) {
+		t.Errorf("Expecting %d records to be checked. Got %d", len(stored), report.Checked)
+	}
+	expected := map[string]string{
+		"broken.test.com.A.bindman": ProblemCorrupt,
+		"empty.test.com.A.bindman":  ProblemInvalid,
+		// the record stored at the normalized key is kept, even if older
+		"Dup.test.com.A.bindman": ProblemDuplicate,
+		// otherwise the last updated one is kept
+		"Other.test.com.A.bindman": ProblemDuplicate,
+	}
+	if len(report.Problems) != len(expected) {
+		t.Fatalf("Expecting %d problems. Got %+v", len(expected), report.Problems)
+	}
+	for _, problem := range report.Problems {
+		if expected[problem.Key] != problem.Problem {
+			t.Errorf("Expecting '%s' to be %s. Got %+v", problem.Key, expected[problem.Key], problem)
+		}
+		if problem.QuarantinedTo != "" || !store.Has(problem.Key) {
+			t.Errorf("Expecting a check without repair to leave '%s' in place", problem.Key)
+		}
+	}
+
+	if report, err = Fsck(store, fsckBasePath, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range report.Problems {
+		if store.Has(problem.Key) {
+			t.Errorf("Expecting '%s' to be moved out of the store", problem.Key)
+		}
+		if b, err := ioutil.ReadFile(problem.QuarantinedTo); err != nil || string(b) != stored[problem.Key] {
+			t.Errorf("Expecting '%s' to be quarantined as is. Got '%s' and err '%v'", problem.Key, b, err)
+		}
+		if filepath.Dir(problem.QuarantinedTo) != filepath.Join(fsckBasePath, QuarantineDir) {
+			t.Errorf("Expecting '%s' to be quarantined inside the quarantine directory. Got %s", problem.Key, problem.QuarantinedTo)
+		}
+	}
+
+	if report, err = Fsck(store, fsckBasePath, false); err != nil || len(report.Problems) != 0 || report.Checked != 3 {
+		t.Errorf("Expecting the repaired store to be clean. Got %+v and err '%v'", report, err)
+	}
+}
+
+func TestRebuildRecords(t *testing.T) {
+	_ = os.RemoveAll(fsckBasePath)
+	defer os.RemoveAll(fsckBasePath)
+
+	store := newDiskvStore(fsckBasePath)
+	if err := store.Write("kept.test.com.A.bindman", []byte(`{"version":1,"record":{"name":"kept.test.com","value":"0.0.0.1","type":"A"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	served := []hookTypes.DNSRecord{
+		{Name: "kept.test.com", Value: "0.0.0.9", Type: "A"},
+		{Name: "lost.test.com", Value: "0.0.0.2", Type: "A"},
+		{Name: "Upper.Test.com", Value: "0.0.0.3", Type: "a"},
+		{Name: "invalid..test.com", Value: "0.0.0.4", Type: "A"},
+	}
+
+	missing, err := RebuildRecords(store, served, true)
+	if err != nil || len(missing) != 2 || missing[0].Name != "lost.test.com" || missing[1].Name != "upper.test.com" || missing[1].Type != "A" {
+		t.Fatalf("Expecting only the lost records to be missing, in their canonical form. Got %+v and err '%v'", missing, err)
+	}
+	if store.Has("lost.test.com.A.bindman") {
+		t.Fatal("Expecting a dry run to leave the store untouched")
+	}
+
+	if _, err = RebuildRecords(store, served, false); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := newIndex(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := idx.get("lost.test.com.A.bindman"); !ok || r.Value != "0.0.0.2" {
+		t.Errorf("Expecting the lost record to be rebuilt. Got %+v", r)
+	}
+	if r, ok := idx.get(recordKey("upper.test.com", "A")); !ok || r.Value != "0.0.0.3" {
+		t.Errorf("Expecting the lost record to be rebuilt under its canonical key. Got %+v", r)
+	}
+	if r, _ := idx.get("kept.test.com.A.bindman"); r.Value != "0.0.0.1" {
+		t.Errorf("Expecting the stored record to be kept. Got %+v", r)
+	}
+}
@@ -0,0 +1,265 @@
+package manager
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const (
+	// SortByName sorts the records by name, then type
+	SortByName = "name"
+	// SortByType sorts the records by type, then name
+	SortByType = "type"
+	// SortByValue sorts the records by value, then name and type
+	SortByValue = "value"
+)
+
+// Record is a DNS record along with the metadata labels attached to it
+type Record struct {
+	hookTypes.DNSRecord
+	Labels map[string]string `json:"labels,omitempty"`
+	// RequestedName the name as requested, when it differs from its canonical form held by Name
+	RequestedName string `json:"requestedName,omitempty"`
+	// Data the structured payload of MX, SRV, CAA and TXT records, from which the value is rendered
+	Data *nsupdate.RecordData `json:"data,omitempty"`
+	// CreatedAt and UpdatedAt are set when the record is stored
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+// RecordFilter selects and orders the records to be listed
+type RecordFilter struct {
+	Type string
+	// NameSuffix keeps the records whose name ends with it, regardless of the case
+	NameSuffix string
+	// Glob keeps the records whose name matches it, as defined by path.Match
+	Glob string
+	// Labels keeps the records having every one of these labels
+	Labels map[string]string
+	// Sort one of SortByName, SortByType and SortByValue, prefixed by "-" for the descending order
+	Sort string
+	// Cursor resumes the listing after the last record of the previous page
+	Cursor string
+	// Limit the maximum number of records listed; zero means no limit
+	Limit int
+}
+
+// cursor identifies the position of a record in a listing
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	Name  string `json:"n"`
+	Type  string `json:"t"`
+}
+
+// index keeps every stored record in memory, in sync with the store, so they can be listed without reading the store.
+// The keys of the records are also kept in the ascending order of every sort, so a page is listed without sorting them
+type index struct {
+	lock    sync.RWMutex
+	records map[string]Record
+	sorted  map[string][]string
+}
+
+// newIndex creates an index holding every record of the store
+func newIndex(store RecordStore) (*index, error) {
+	keys, err := store.Keys("")
+	if err != nil {
+		return nil, err
+	}
+	idx := &index{records: make(map[string]Record, len(keys)), sorted: make(map[string][]string)}
+	for _, key := range keys {
+		b, err := store.Read(key)
+		if err != nil {
+			return nil, fmt.Errorf("not possible to read the record '%s': %v", key, err)
+		}
+		env, _, err := decodeRecord(b)
+		if err != nil {
+			return nil, fmt.Errorf("not possible to parse the record '%s': %v", key, err)
+		}
+		idx.records[key] = env.record()
+	}
+	for _, sortBy := range []string{SortByName, SortByType, SortByValue} {
+		sorted := make([]string, 0, len(idx.records))
+		for key := range idx.records {
+			sorted = append(sorted, key)
+		}
+		sort.Slice(sorted, func(i, j int) bool {
+			return position(sortBy, idx.records[sorted[i]]).before(position(sortBy, idx.records[sorted[j]]))
+		})
+		idx.sorted[sortBy] = sorted
+	}
+	return idx, nil
+}
+
+func (idx *index) get(key string) (Record, bool) {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+	r, ok := idx.records[key]
+	return r, ok
+}
+
+func (idx *index) put(key string, r Record) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	idx.unsort(key)
+	idx.records[key] = r
+	for sortBy, sorted := range idx.sorted {
+		i := idx.search(sortBy, position(sortBy, r))
+		sorted = append(sorted, "")
+		copy(sorted[i+1:], sorted[i:])
+		sorted[i] = key
+		idx.sorted[sortBy] = sorted
+	}
+}
+
+func (idx *index) remove(key string) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	idx.unsort(key)
+	delete(idx.records, key)
+}
+
+// unsort removes the key of a record from the sorted keys. It expects the lock to be held
+func (idx *index) unsort(key string) {
+	r, ok := idx.records[key]
+	if !ok {
+		return
+	}
+	for sortBy, sorted := range idx.sorted {
+		if i := idx.search(sortBy, position(sortBy, r)); i < len(sorted) && sorted[i] == key {
+			idx.sorted[sortBy] = append(sorted[:i], sorted[i+1:]...)
+		}
+	}
+}
+
+// search returns the index of the first sorted key whose record is not before the position. It expects the lock to be held
+func (idx *index) search(sortBy string, p cursor) int {
+	sorted := idx.sorted[sortBy]
+	return sort.Search(len(sorted), func(i int) bool { return !position(sortBy, idx.records[sorted[i]]).before(p) })
+}
+
+// byName returns the records of the name, of any type
+func (idx *index) byName(name string) (records []Record) {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+	for _, r := range idx.records {
+		if r.Name == name {
+			records = append(records, r)
+		}
+	}
+	return
+}
+
+// list returns the page of records selected by the filter and the cursor of the next page, empty when it is the last one
+func (idx *index) list(filter RecordFilter) ([]Record, string, error) {
+	sortBy, desc := strings.TrimPrefix(filter.Sort, "-"), strings.HasPrefix(filter.Sort, "-")
+	if sortBy == "" {
+		sortBy = SortByName
+	}
+	if sortBy != SortByName && sortBy != SortByType && sortBy != SortByValue {
+		return nil, "", hookTypes.BadRequestError(fmt.Sprintf("Invalid sort '%s'. Expecting '%s', '%s' or '%s', optionally prefixed by '-'", filter.Sort, SortByName, SortByType, SortByValue), nil)
+	}
+	if filter.Glob != "" {
+		if _, err := path.Match(filter.Glob, ""); err != nil {
+			return nil, "", hookTypes.BadRequestError(fmt.Sprintf("Invalid glob '%s'", filter.Glob), err)
+		}
+	}
+	var after *cursor
+	if filter.Cursor != "" {
+		after = new(cursor)
+		b, err := base64.RawURLEncoding.DecodeString(filter.Cursor)
+		if err == nil {
+			err = json.Unmarshal(b, after)
+		}
+		if err != nil || after.Sort != filter.Sort {
+			return nil, "", hookTypes.BadRequestError("Invalid cursor. It must be taken from a listing with the same sort", err)
+		}
+		after.Sort = ""
+	}
+
+	idx.lock.RLock()
+	sorted := idx.sorted[sortBy]
+	// the keys are walked from the position of the cursor, backwards for the descending order
+	i, step := 0, 1
+	if desc {
+		i, step = len(sorted)-1, -1
+	}
+	if after != nil {
+		i = idx.search(sortBy, *after)
+		if desc {
+			i--
+		} else if i < len(sorted) && position(sortBy, idx.records[sorted[i]]) == *after {
+			i++
+		}
+	}
+	var result []Record
+	for ; i >= 0 && i < len(sorted) && (filter.Limit <= 0 || len(result) <= filter.Limit); i += step {
+		if r := idx.records[sorted[i]]; filter.matches(r) {
+			result = append(result, r)
+		}
+	}
+	idx.lock.RUnlock()
+
+	next := ""
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[:filter.Limit]
+		last := position(sortBy, result[len(result)-1])
+		last.Sort = filter.Sort
+		b, _ := json.Marshal(last)
+		next = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return result, next, nil
+}
+
+// position returns the position of the record in the ascending order of the sort
+func position(sortBy string, r Record) cursor {
+	c := cursor{Name: r.Name, Type: r.Type}
+	switch sortBy {
+	case SortByType:
+		c.Value = r.Type
+	case SortByValue:
+		c.Value = r.Value
+	}
+	return c
+}
+
+// before tells whether the position comes before the other one in the ascending order
+func (c cursor) before(other cursor) bool {
+	if c.Value != other.Value {
+		return c.Value < other.Value
+	}
+	if c.Name != other.Name {
+		return c.Name < other.Name
+	}
+	return c.Type < other.Type
+}
+
+// matches tells whether the record is selected by the filter
+func (filter RecordFilter) matches(r Record) bool {
+	if filter.Type != "" && !strings.EqualFold(r.Type, filter.Type) {
+		return false
+	}
+	if filter.NameSuffix != "" && !strings.HasSuffix(strings.ToLower(r.Name), strings.ToLower(filter.NameSuffix)) {
+		return false
+	}
+	if filter.Glob != "" {
+		if ok, _ := path.Match(filter.Glob, r.Name); !ok {
+			return false
+		}
+	}
+	for k, v := range filter.Labels {
+		if value, ok := r.Labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package manager
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const indexBasePath = "./data-index"
+
+func TestListDNSRecords(t *testing.T) {
+	m := initIndexedManager(t)
+	defer os.RemoveAll(indexBasePath)
+
+	tests := []struct {
+		name     string
+		filter   RecordFilter
+		expected []string
+	}{
+		{"all sorted by name", RecordFilter{}, []string{"a.prod.test.com.A", "b.prod.test.com.A", "b.prod.test.com.TXT", "c.dev.test.com.CNAME"}},
+		{"by type", RecordFilter{Type: "a"}, []string{"a.prod.test.com.A", "b.prod.test.com.A"}},
+		{"by name suffix", RecordFilter{NameSuffix: ".dev.test.com"}, []string{"c.dev.test.com.CNAME"}},
+		{"by name suffix of another case", RecordFilter{NameSuffix: ".PROD.Test.com"}, []string{"a.prod.test.com.A", "b.prod.test.com.A", "b.prod.test.com.TXT"}},
+		{"by glob", RecordFilter{Glob: "b.*.test.com"}, []string{"b.prod.test.com.A", "b.prod.test.com.TXT"}},
+		{"by labels", RecordFilter{Labels: map[string]string{"env": "prod", "team": "web"}}, []string{"b.prod.test.com.A"}},
+		{"descending", RecordFilter{Sort: "-name"}, []string{"c.dev.test.com.CNAME", "b.prod.test.com.TXT", "b.prod.test.com.A", "a.prod.test.com.A"}},
+		{"by type", RecordFilter{Sort: SortByType}, []string{"a.prod.test.com.A", "b.prod.test.com.A", "c.dev.test.com.CNAME", "b.prod.test.com.TXT"}},
+		{"by value", RecordFilter{Sort: SortByValue, Type: "A"}, []string{"b.prod.test.com.A", "a.prod.test.com.A"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records, next, err := m.ListDNSRecords(test.filter)
+			if err != nil || next != "" {
+				t.Fatalf("Expecting a single page. Got cursor '%s' and err '%v'", next, err)
+			}
+			if got := recordKeys(records); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("Expecting %v. Got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestListDNSRecordsPagination(t *testing.T) {
+	m := initIndexedManager(t)
+	defer os.RemoveAll(indexBasePath)
+
+	var got []string
+	filter := RecordFilter{Sort: "-name", Limit: 3}
+	for pages := 0; ; pages++ {
+		if pages > 2 {
+			t.Fatal("Expecting the pagination to end")
+		}
+		records, next, err := m.ListDNSRecords(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, recordKeys(records)...)
+		if next == "" {
+			break
+		}
+		filter.Cursor = next
+		if pages == 0 {
+			// a record added before the cursor position must not shift the next page
+			if err := m.AddDNSRecord(context.Background(), hookTypes.DNSRecord{Name: "d.test.com", Value: "0.0.0.0", Type: "A"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	expected := []string{"c.dev.test.com.CNAME", "b.prod.test.com.TXT", "b.prod.test.com.A", "a.prod.test.com.A"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expecting %v. Got %v", expected, got)
+	}
+
+	if _, _, err := m.ListDNSRecords(RecordFilter{Sort: SortByName, Cursor: filter.Cursor}); err == nil {
+		t.Error("Expecting an error when the cursor comes from a listing with another sort")
+	}
+}
+
+func TestListDNSRecordsAfterChanges(t *testing.T) {
+	m := initIndexedManager(t)
+	defer os.RemoveAll(indexBasePath)
+
+	if err := m.UpdateDNSRecord(context.Background(), hookTypes.DNSRecord{Name: "a.prod.test.com", Value: "0.0.0.0", Type: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	m.removeRecord("b.prod.test.com", "TXT")
+
+	for sortBy, expected := range map[string][]string{
+		SortByName:  {"a.prod.test.com.A", "b.prod.test.com.A", "c.dev.test.com.CNAME"},
+		SortByValue: {"a.prod.test.com.A", "b.prod.test.com.A", "c.dev.test.com.CNAME"},
+		"-value":    {"c.dev.test.com.CNAME", "b.prod.test.com.A", "a.prod.test.com.A"},
+	} {
+		records, _, err := m.ListDNSRecords(RecordFilter{Sort: sortBy})
+		if got := recordKeys(records); err != nil || !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expecting %v sorted by %s. Got %v and err '%v'", expected, sortBy, got, err)
+		}
+	}
+}
+
+func TestListDNSRecordsInvalidFilter(t *testing.T) {
+	m := initIndexedManager(t)
+	defer os.RemoveAll(indexBasePath)
+
+	for _, filter := range []RecordFilter{{Sort: "ttl"}, {Glob: "["}, {Cursor: "not a cursor"}} {
+		if _, _, err := m.ListDNSRecords(filter); err == nil {
+			t.Errorf("Expecting an error for the filter %+v", filter)
+		}
+	}
+}
+
+func TestIndexLoadedFromStore(t *testing.T) {
+	initIndexedManager(t)
+	defer os.RemoveAll(indexBasePath)
+
+	m, err := new(Builder).New(new(MockDNSUpdater), indexBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := m.GetRecord("b.prod.test.com", "A")
+	if err != nil || r.Labels["team"] != "web" {
+		t.Errorf("Expecting the labels to be loaded from the store. Got '%v' and err '%v'", r, err)
+	}
+	if records, _, _ := m.ListDNSRecords(RecordFilter{}); len(records) != 4 {
+		t.Errorf("Expecting 4 records to be loaded. Got %d", len(records))
+	}
+}
+
+// initIndexedManager creates a manager with a few labelled records
+func initIndexedManager(t *testing.T) *Bind9Manager {
+	_ = os.RemoveAll(indexBasePath)
+	m, err := new(Builder).New(new(MockDNSUpdater), indexBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []Record{
+		{DNSRecord: hookTypes.DNSRecord{Name: "b.prod.test.com", Value: "0.0.0.1", Type: "A"}, Labels: map[string]string{"env": "prod", "team": "web"}},
+		{DNSRecord: hookTypes.DNSRecord{Name: "a.prod.test.com", Value: "0.0.0.2", Type: "A"}, Labels: map[string]string{"env": "prod"}},
+		{DNSRecord: hookTypes.DNSRecord{Name: "c.dev.test.com", Value: "a.prod.test.com", Type: "CNAME"}, Labels: map[string]string{"env": "dev"}},
+		{DNSRecord: hookTypes.DNSRecord{Name: "b.prod.test.com", Value: "text", Type: "TXT"}},
+	}
+	for _, r := range records {
+		if err := m.AddRecord(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+// recordKeys returns the name and type of each record
+func recordKeys(records []Record) (keys []string) {
+	for _, r := range records {
+		keys = append(keys, r.Name+"."+r.Type)
+	}
+	return
+}
@@ -0,0 +1,283 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	intentsDir      = "intents"
+	intentExtension = "intent"
+
+	// operationBatch identifies the intent of several changes sent to the nameserver at once
+	operationBatch = "batch"
+)
+
+// intent records a change about to be sent to the nameserver, before it is sent.
+// It is erased once the nameserver and the store agree again, so any intent left behind means both may have diverged
+type intent struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Record Record `json:"record"`
+	// Previous the stored record before the change, used to compensate it
+	Previous *Record `json:"previous,omitempty"`
+	// Changes the changes of a batch, in the order they are sent to the nameserver
+	Changes   []PlannedChange `json:"changes,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// changes returns the intents of the changes of a batch, in order
+func (it *intent) changes() []*intent {
+	intents := make([]*intent, 0, len(it.Changes))
+	for _, c := range it.Changes {
+		intents = append(intents, &intent{ID: it.ID, Type: c.Type, Record: c.Record, Previous: c.Previous, CreatedAt: it.CreatedAt})
+	}
+	return intents
+}
+
+// transact applies a change to the nameserver with the update function and then to the store, guarded by a write-ahead intent.
+// A change accepted by the nameserver is stored whatever its verification, whose outcome is recorded in the context. When the
+// store cannot be written, the change is compensated in the nameserver. When the outcome is unknown, the intent is kept to be
+// recovered on the next startup
+func (m *Bind9Manager) transact(ctx context.Context, operationType string, record Record, update func() error) error {
+	it := &intent{ID: uuid.New().String(), Type: operationType, Record: record, CreatedAt: time.Now()}
+	if previous, err := m.GetRecord(record.Name, record.Type); err == nil {
+		it.Previous = previous
+	}
+	if err := m.intents.put(it.ID, it); err != nil {
+		return hookTypes.InternalServerError("Not possible to persist the intent of the change", err)
+	}
+
+	outcome, err := m.verified(update())
+	if err != nil && outcome == "" {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			logrus.Warnf("The outcome of the change '%s' is unknown; it will be recovered on the next startup: %v", it.ID, err)
+			return err
+		}
+		m.resolveIntent(it)
+		return err
+	}
+
+	if err := m.commitIntent(it); err != nil {
+		logrus.Errorf("Not possible to store the change '%s'; compensating it in the nameserver: %v", it.ID, err)
+		if cErr := m.compensateIntent(context.Background(), it); cErr != nil {
+			logrus.Errorf("Not possible to compensate the change '%s'; it will be recovered on the next startup: %v", it.ID, cErr)
+			return err
+		}
+		m.resolveIntent(it)
+		return err
+	}
+	m.resolveIntent(it)
+	recordVerification(ctx, outcome)
+	return err
+}
+
+// transactBatch applies several changes to the nameserver at once with the updater and then to the store, guarded by a
+// single write-ahead intent holding them in order, as transact does. The changes failing to be stored are compensated at once
+func (m *Bind9Manager) transactBatch(ctx context.Context, updater nsupdate.BatchUpdater, changes []PlannedChange) error {
+	it := &intent{ID: uuid.New().String(), Type: operationBatch, Changes: changes, CreatedAt: time.Now()}
+	if err := m.intents.put(it.ID, it); err != nil {
+		return hookTypes.InternalServerError("Not possible to persist the intent of the changes", err)
+	}
+
+	outcome, err := m.verified(updater.ApplyChanges(ctx, batchChanges(changes), m.TTL))
+	if err != nil && outcome == "" {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			logrus.Warnf("The outcome of the batch '%s' of %d changes is unknown; it will be recovered on the next startup: %v", it.ID, len(changes), err)
+			return err
+		}
+		m.resolveIntent(it)
+		return err
+	}
+
+	result := err
+	var failed []PlannedChange
+	for i, c := range it.changes() {
+		if err := m.commitIntent(c); err != nil {
+			logrus.Errorf("Not possible to store the change to the record '%s' with type '%s' of the batch '%s': %v", c.Record.Name, c.Record.Type, it.ID, err)
+			result = err
+			failed = append(failed, changes[i])
+		}
+	}
+	if len(failed) > 0 {
+		logrus.Errorf("Compensating in the nameserver the %d changes of the batch '%s' not stored", len(failed), it.ID)
+		if cErr := m.compensateIntent(context.Background(), &intent{ID: it.ID, Type: operationBatch, Changes: failed}); cErr != nil {
+			logrus.Errorf("Not possible to compensate the batch '%s'; it will be recovered on the next startup: %v", it.ID, cErr)
+			return result
+		}
+	}
+	m.resolveIntent(it)
+	recordVerification(ctx, outcome)
+	return result
+}
+
+// batchChanges returns the changes to send to the nameserver for the planned changes
+func batchChanges(changes []PlannedChange) []nsupdate.Change {
+	result := make([]nsupdate.Change, 0, len(changes))
+	for _, c := range changes {
+		result = append(result, nsupdate.Change{Type: c.Type, Record: c.Record.DNSRecord})
+	}
+	return result
+}
+
+// commitIntent applies the intent to the store, then syncs the PTR record of the change
+func (m *Bind9Manager) commitIntent(it *intent) error {
+	if it.Type == OperationRemove {
+		m.removeRecord(it.Record.Name, it.Record.Type)
+		m.trackPropagation(m.events.publish(EventRemoved, it.Record, nil))
+		m.syncPTR(it)
+		return nil
+	}
+	if err := m.saveRecord(it.Record); err != nil {
+		return err
+	}
+	eventType := EventUpdate
+	if it.Type == OperationAdd {
+		eventType = EventAdd
+	}
+	saved, _ := m.index.get(m.getRecordFileName(it.Record.Name, it.Record.Type))
+	m.trackPropagation(m.events.publish(eventType, saved, nil))
+	m.syncPTR(it)
+	return nil
+}
+
+// compensateIntent undoes in the nameserver the change described by the intent. The changes of a batch are undone at once,
+// in reverse order, along with the ones already stored
+func (m *Bind9Manager) compensateIntent(ctx context.Context, it *intent) error {
+	if it.Type == operationBatch {
+		return m.compensateBatch(ctx, it)
+	}
+	if it.Previous != nil {
+		return m.DNSUpdater.UpdateRR(ctx, it.Previous.DNSRecord, m.TTL)
+	}
+	if it.Type == OperationRemove {
+		return nil
+	}
+	return m.DNSUpdater.RemoveRR(ctx, it.Record.Name, it.Record.Type)
+}
+
+// compensateBatch undoes the changes of the batch in the nameserver, then in the store for the ones already stored
+func (m *Bind9Manager) compensateBatch(ctx context.Context, it *intent) error {
+	updater, ok := m.DNSUpdater.(nsupdate.BatchUpdater)
+	if !ok {
+		return errors.New("the DNSUpdater cannot apply several changes at once")
+	}
+	var undo []nsupdate.Change
+	for i := len(it.Changes) - 1; i >= 0; i-- {
+		c := it.Changes[i]
+		if c.Previous != nil {
+			undo = append(undo, nsupdate.Change{Type: nsupdate.ChangeUpdate, Record: c.Previous.DNSRecord})
+		} else if c.Type != OperationRemove {
+			undo = append(undo, nsupdate.Change{Type: nsupdate.ChangeRemove, Record: c.Record.DNSRecord})
+		}
+	}
+	if err := updater.ApplyChanges(ctx, undo, m.TTL); err != nil {
+		var verr *nsupdate.VerificationError
+		if !errors.As(err, &verr) {
+			return err
+		}
+		logrus.Warnf("The compensation of the batch '%s' is not served as expected: %v", it.ID, err)
+	}
+
+	for _, c := range it.Changes {
+		stored, ok := m.index.get(m.getRecordFileName(c.Record.Name, c.Record.Type))
+		switch {
+		case c.Previous == nil && ok:
+			m.removeRecord(c.Record.Name, c.Record.Type)
+		case c.Previous != nil && (!ok || stored.Value != c.Previous.Value):
+			if err := m.saveRecord(*c.Previous); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// replayIntent sends again to the nameserver the change described by the intent and applies it to the store
+func (m *Bind9Manager) replayIntent(ctx context.Context, it *intent) (err error) {
+	switch it.Type {
+	case OperationAdd:
+		err = m.DNSUpdater.AddRR(ctx, it.Record.DNSRecord, m.TTL)
+	case OperationUpdate:
+		err = m.DNSUpdater.UpdateRR(ctx, it.Record.DNSRecord, m.TTL)
+	case OperationRemove:
+		if it.Previous == nil && m.HasDNSRecord(it.Record.Name, it.Record.Type) {
+			// the record has been added again since the removal was intended
+			return nil
+		}
+		err = m.DNSUpdater.RemoveRR(ctx, it.Record.Name, it.Record.Type)
+	case operationBatch:
+		return m.replayBatch(ctx, it)
+	}
+	if err == nil {
+		err = m.commitIntent(it)
+	}
+	return
+}
+
+// replayBatch sends again to the nameserver the changes of the batch at once, in order, and applies them to the store
+func (m *Bind9Manager) replayBatch(ctx context.Context, it *intent) error {
+	updater, ok := m.DNSUpdater.(nsupdate.BatchUpdater)
+	if !ok {
+		return errors.New("the DNSUpdater cannot apply several changes at once")
+	}
+	if _, err := m.verified(updater.ApplyChanges(ctx, batchChanges(it.Changes), m.TTL)); err != nil {
+		var verr *nsupdate.VerificationError
+		if !errors.As(err, &verr) {
+			return err
+		}
+		logrus.Warnf("The replayed batch '%s' is not served as expected: %v", it.ID, err)
+	}
+	for _, c := range it.changes() {
+		if err := m.commitIntent(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveIntent erases the intent, given the nameserver and the store agree
+func (m *Bind9Manager) resolveIntent(it *intent) {
+	if err := m.intents.remove(it.ID); err != nil {
+		logrus.Errorf("Not possible to erase the intent of the change '%s': %v", it.ID, err)
+	}
+}
+
+// recoverIntents replays the changes left unresolved by a previous execution in the order they were made, compensating the
+// ones that cannot be replayed
+func (m *Bind9Manager) recoverIntents() {
+	var intents []*intent
+	for _, id := range m.intents.ids() {
+		it := new(intent)
+		if err := m.intents.get(id, it); err != nil {
+			logrus.Errorf("Not possible to read the intent of the change '%s': %v", id, err)
+			continue
+		}
+		intents = append(intents, it)
+	}
+	sort.SliceStable(intents, func(i, j int) bool { return intents[i].CreatedAt.Before(intents[j].CreatedAt) })
+
+	ctx := context.Background()
+	for _, it := range intents {
+		if it.Type == operationBatch {
+			logrus.Infof("Recovering the unresolved batch '%s' of %d changes", it.ID, len(it.Changes))
+		} else {
+			logrus.Infof("Recovering the unresolved change '%s' to %s the record '%s' with type '%s'", it.ID, it.Type, it.Record.Name, it.Record.Type)
+		}
+		if err := m.replayIntent(ctx, it); err != nil {
+			logrus.Errorf("Not possible to replay the change '%s'; compensating it: %v", it.ID, err)
+			if err := m.compensateIntent(ctx, it); err != nil {
+				logrus.Errorf("Not possible to compensate the change '%s'; it will be retried on the next startup: %v", it.ID, err)
+				continue
+			}
+		}
+		m.resolveIntent(it)
+	}
+}
@@ -0,0 +1,151 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const intentBasePath = "./data-intent"
+
+func TestTransactCompensatesWhenStoreFails(t *testing.T) {
+	m, updater := initIntentManager(t)
+	defer os.RemoveAll(intentBasePath)
+	record := hookTypes.DNSRecord{Name: "unwritable.test.com", Value: "0.0.0.0", Type: "A"}
+
+	// a directory in place of the record file makes the store write fail
+	if err := os.MkdirAll(filepath.Join(intentBasePath, m.getRecordFileName(record.Name, record.Type)), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.AddDNSRecord(context.Background(), record); err == nil {
+		t.Fatal("Expecting the addition to fail when the store cannot be written")
+	}
+	if atomic.LoadUint64(&updater.AddCount) != 1 || atomic.LoadUint64(&updater.RemovalCount) != 1 {
+		t.Errorf("Expecting the addition to be compensated by a removal. Got %d additions and %d removals", updater.AddCount, updater.RemovalCount)
+	}
+	if ids := m.intents.ids(); len(ids) != 0 {
+		t.Errorf("Expecting the intent to be resolved after the compensation. Got %v", ids)
+	}
+}
+
+func TestTransactResolvesIntentWhenUpdateFails(t *testing.T) {
+	m, updater := initIntentManager(t)
+	defer os.RemoveAll(intentBasePath)
+	updater.Error = errors.New("update failed: REFUSED")
+
+	if err := m.AddDNSRecord(context.Background(), hookTypes.DNSRecord{Name: "refused.test.com", Value: "0.0.0.0", Type: "A"}); err == nil {
+		t.Fatal("Expecting the addition to fail")
+	}
+	if ids := m.intents.ids(); len(ids) != 0 {
+		t.Errorf("Expecting no intent to be left when the nameserver refuses the change. Got %v", ids)
+	}
+}
+
+func TestTransactKeepsIntentWhenOutcomeIsUnknown(t *testing.T) {
+	m, updater := initIntentManager(t)
+	defer os.RemoveAll(intentBasePath)
+	updater.Error = context.DeadlineExceeded
+
+	if err := m.AddDNSRecord(context.Background(), hookTypes.DNSRecord{Name: "slow.test.com", Value: "0.0.0.0", Type: "A"}); err == nil {
+		t.Fatal("Expecting the addition to fail")
+	}
+	if ids := m.intents.ids(); len(ids) != 1 {
+		t.Errorf("Expecting the intent to be kept when the outcome of the change is unknown. Got %v", ids)
+	}
+}
+
+func TestRecoverIntents(t *testing.T) {
+	_ = os.RemoveAll(intentBasePath)
+	defer os.RemoveAll(intentBasePath)
+
+	record := hookTypes.DNSRecord{Name: "recovered.test.com", Value: "0.0.0.0", Type: "A"}
+	it := intent{ID: "unresolved", Type: OperationAdd, Record: Record{DNSRecord: record}, CreatedAt: time.Now()}
+	if err := newJournal(intentBasePath, intentsDir, intentExtension).put(it.ID, it); err != nil {
+		t.Fatal(err)
+	}
+
+	updater := new(MockDNSUpdater)
+	m, err := (&Builder{TTL: time.Hour, RemovalDelay: time.Hour}).New(updater, intentBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadUint64(&updater.AddCount) != 1 {
+		t.Errorf("Expecting the unresolved addition to be replayed. Got %d additions", updater.AddCount)
+	}
+	if r, err := m.GetDNSRecord(record.Name, record.Type); err != nil || *r != record {
+		t.Errorf("Expecting the replayed record to be stored. Got '%v' and err '%v'", r, err)
+	}
+	if ids := m.intents.ids(); len(ids) != 0 {
+		t.Errorf("Expecting the intent to be resolved after the recovery. Got %v", ids)
+	}
+}
+
+func TestRecoverIntentsInCreationOrder(t *testing.T) {
+	_ = os.RemoveAll(intentBasePath)
+	defer os.RemoveAll(intentBasePath)
+
+	record := hookTypes.DNSRecord{Name: "ordered.test.com", Value: "0.0.0.1", Type: "A"}
+	updated := record
+	updated.Value = "0.0.0.2"
+	now := time.Now()
+	// the ids sort the other way around
+	intents := []intent{
+		{ID: "b", Type: OperationAdd, Record: Record{DNSRecord: record}, CreatedAt: now},
+		{ID: "a", Type: OperationUpdate, Record: Record{DNSRecord: updated}, Previous: &Record{DNSRecord: record}, CreatedAt: now.Add(time.Millisecond)},
+	}
+	for _, it := range intents {
+		if err := newJournal(intentBasePath, intentsDir, intentExtension).put(it.ID, it); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := (&Builder{TTL: time.Hour, RemovalDelay: time.Hour}).New(new(MockDNSUpdater), intentBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err := m.GetDNSRecord(record.Name, record.Type); err != nil || *r != updated {
+		t.Errorf("Expecting the changes to be replayed in the order they were made. Got '%v' and err '%v'", r, err)
+	}
+}
+
+func TestRecoverIntentsCompensates(t *testing.T) {
+	_ = os.RemoveAll(intentBasePath)
+	defer os.RemoveAll(intentBasePath)
+
+	previous := Record{DNSRecord: hookTypes.DNSRecord{Name: "compensated.test.com", Value: "0.0.0.1", Type: "A"}}
+	it := intent{ID: "unresolved", Type: OperationUpdate, Record: Record{DNSRecord: hookTypes.DNSRecord{Name: previous.Name, Value: "0.0.0.2", Type: previous.Type}}, Previous: &previous}
+	if err := newJournal(intentBasePath, intentsDir, intentExtension).put(it.ID, it); err != nil {
+		t.Fatal(err)
+	}
+
+	updater := &MockDNSUpdater{Error: errors.New("update failed: SERVFAIL")}
+	m, err := (&Builder{TTL: time.Hour, RemovalDelay: time.Hour}).New(updater, intentBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadUint64(&updater.UpdateCount) != 2 {
+		t.Errorf("Expecting the replay and then the compensation to be tried. Got %d updates", updater.UpdateCount)
+	}
+	if ids := m.intents.ids(); len(ids) != 1 {
+		t.Errorf("Expecting the intent to be kept while it can neither be replayed nor compensated. Got %v", ids)
+	}
+}
+
+func initIntentManager(t *testing.T) (*Bind9Manager, *MockDNSUpdater) {
+	_ = os.RemoveAll(intentBasePath)
+	updater := new(MockDNSUpdater)
+	m, err := (&Builder{TTL: time.Hour, RemovalDelay: time.Hour}).New(updater, intentBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, updater
+}
@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/peterbourgon/diskv"
+)
+
+// journal persists JSON entries identified by an id in a sub-directory of the data directory
+type journal struct {
+	entries   *diskv.Diskv
+	extension string
+}
+
+// newJournal creates a journal storing its entries as files with the given extension inside basePath/dir
+func newJournal(basePath, dir, extension string) *journal {
+	return &journal{
+		entries: diskv.New(diskv.Options{
+			BasePath:  filepath.Join(basePath, dir),
+			Transform: func(s string) []string { return []string{} },
+		}),
+		extension: extension,
+	}
+}
+
+// put synchronously writes the entry identified by id
+func (j *journal) put(id string, entry interface{}) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return j.entries.WriteStream(j.key(id), bytes.NewReader(b), true)
+}
+
+// get reads the entry identified by id
+func (j *journal) get(id string, entry interface{}) error {
+	b, err := j.entries.Read(j.key(id))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, entry)
+}
+
+// remove erases the entry identified by id
+func (j *journal) remove(id string) error {
+	return j.entries.Erase(j.key(id))
+}
+
+// ids lists the ids of every entry in the journal, sorted
+func (j *journal) ids() (ids []string) {
+	suffix := "." + j.extension
+	for key := range j.entries.Keys(nil) {
+		if strings.HasSuffix(key, suffix) {
+			ids = append(ids, strings.TrimSuffix(key, suffix))
+		}
+	}
+	sort.Strings(ids)
+	return
+}
+
+// key returns the key of the file holding the entry identified by id
+func (j *journal) key(id string) string {
+	return id + "." + j.extension
+}
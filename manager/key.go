@@ -0,0 +1,72 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	// maxKeyLength the maximum length of a storage key, the usual limit of a file name
+	maxKeyLength = 255
+	// keyHashLength the length of the hash ending the keys too long to be kept whole
+	keyHashLength = 32
+)
+
+// recordKey returns the storage key of the record identified by name and type: "<name>.<type>.bindman".
+// The name is put in its canonical form, so it is lower cased, and the type upper cased. Every byte of the name other than
+// lower case letters, digits, '-', '_' and '.' is percent encoded, so the key is a valid file name that never escapes the
+// data directory, and a '.' starting the name or following another '.' is encoded too, so the key is never "." or "..".
+// A key longer than a file name can be is truncated and ended by a hash of the name and type, after a '~' that is always
+// encoded otherwise: "<truncated name and type>~<hash>.bindman"
+func recordKey(name, recordType string) string {
+	name, recordType = canonicalName(name), strings.ToUpper(recordType)
+	key := fmt.Sprintf("%v.%v.%v", encodeKeyPart(name), encodeKeyPart(recordType), Extension)
+	if len(key) <= maxKeyLength {
+		return key
+	}
+	sum := sha256.Sum256([]byte(name + " " + recordType))
+	hash := hex.EncodeToString(sum[:])[:keyHashLength]
+	return fmt.Sprintf("%v~%v.%v", key[:maxKeyLength-len(hash)-len(Extension)-2], hash, Extension)
+}
+
+// parseRecordKey returns the normalized name and type of the record from its storage key. The name and type of a key
+// ended by a hash cannot be told from it
+func parseRecordKey(key string) (string, string, error) {
+	subName := strings.TrimSuffix(key, "."+Extension)
+	i := strings.LastIndex(subName, ".")
+	if i < 0 || subName == key {
+		return "", "", fmt.Errorf("invalid record key '%s'", key)
+	}
+	if strings.Contains(subName, "~") {
+		return "", "", fmt.Errorf("the record key '%s' is truncated, so the name and type of its record are only in its file", key)
+	}
+	name, err := url.PathUnescape(subName[:i])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid record key '%s': %v", key, err)
+	}
+	recordType, err := url.PathUnescape(subName[i+1:])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid record key '%s': %v", key, err)
+	}
+	return name, recordType, nil
+}
+
+// encodeKeyPart percent encodes the bytes not allowed in a part of a storage key
+func encodeKeyPart(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_':
+			b.WriteByte(c)
+		case c == '.' && i > 0 && s[i-1] != '.':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
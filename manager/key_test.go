@@ -0,0 +1,137 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const keyBasePath = "./data-key"
+
+func TestRecordKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordType string
+		expected   string
+	}{
+		{"teste", "A", "teste.A.bindman"},
+		{"Mixed.Test.COM", "a", "mixed.test.com.A.bindman"},
+		{"*.test.com", "A", "%2A.test.com.A.bindman"},
+		{"*.apps.test.com", "A", "%2A.apps.test.com.A.bindman"},
+		{"test.com", "TXT", "test.com.TXT.bindman"},
+		{"a/b.test.com", "A", "a%2Fb.test.com.A.bindman"},
+		{"../../etc/passwd", "A", "%2E%2E%2F.%2E%2Fetc%2Fpasswd.A.bindman"},
+		{"..", "A", "%2E%2E.A.bindman"},
+		{"a..b.test.com", "A", "a.%2Eb.test.com.A.bindman"},
+		{"100%.test.com", "TXT", "100%25.test.com.TXT.bindman"},
+		{"_sip._tcp.test.com", "SRV", "_sip._tcp.test.com.SRV.bindman"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key := recordKey(test.name, test.recordType)
+			if key != test.expected {
+				t.Errorf("recordKey() = %v, want %v", key, test.expected)
+			}
+			if filepath.Base(key) != key {
+				t.Errorf("Expecting the key '%s' to be a plain file name", key)
+			}
+
+			name, recordType, err := parseRecordKey(key)
+			if err != nil || !strings.EqualFold(name, test.name) || !strings.EqualFold(recordType, test.recordType) {
+				t.Errorf("parseRecordKey() = %v, %v, %v; want the normalized %v and %v", name, recordType, err, test.name, test.recordType)
+			}
+		})
+	}
+
+	if _, _, err := parseRecordKey("invalid"); err == nil {
+		t.Error("Expecting an error when parsing a key without type and extension")
+	}
+}
+
+func TestLongRecordKey(t *testing.T) {
+	_ = os.RemoveAll(keyBasePath)
+	defer os.RemoveAll(keyBasePath)
+
+	label := strings.Repeat("a", 63)
+	// 253 bytes, the longest name
+	name := label + "." + label + "." + label + "." + strings.Repeat("b", 52) + ".test.com"
+	other := label + "." + label + "." + label + "." + strings.Repeat("b", 51) + "c.test.com"
+
+	key := recordKey(name, "TXT")
+	if len(key) > maxKeyLength || filepath.Base(key) != key || !strings.HasSuffix(key, "."+Extension) {
+		t.Errorf("Expecting a plain file name of at most %d bytes. Got '%s' (%d bytes)", maxKeyLength, key, len(key))
+	}
+	if recordKey(other, "TXT") == key || recordKey(name, "SPF") == key || recordKey(strings.ToUpper(name), "txt") != key {
+		t.Error("Expecting the truncated keys to differ by the hash of the name and type only")
+	}
+	if _, _, err := parseRecordKey(key); err == nil {
+		t.Error("Expecting the name and type of a truncated key not to be parsed")
+	}
+
+	m, err := new(Builder).New(new(MockDNSUpdater), keyBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddDNSRecord(context.Background(), hookTypes.DNSRecord{Name: name, Value: "text", Type: "TXT"}); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := m.GetDNSRecord(name, "TXT"); err != nil || r.Name != name {
+		t.Errorf("Expecting the record to be stored under its truncated key. Got '%v' and err '%v'", r, err)
+	}
+}
+
+func TestMigrateRecordKeys(t *testing.T) {
+	_ = os.RemoveAll(keyBasePath)
+	defer os.RemoveAll(keyBasePath)
+
+	// files written by previous versions, keyed by the raw name
+	store := newDiskvStore(keyBasePath)
+	legacy := map[string]hookTypes.DNSRecord{
+		"Mixed.Test.com.A.bindman": {Name: "Mixed.Test.com", Value: "0.0.0.1", Type: "A"},
+		"*.test.com.A.bindman":     {Name: "*.test.com", Value: "0.0.0.2", Type: "A"},
+		"plain.test.com.A.bindman": {Name: "plain.test.com", Value: "0.0.0.3", Type: "A"},
+		"upper.test.com.A.bindman": {Name: "Upper.Test.COM.", Value: "0.0.0.5", Type: "a"},
+		// collides with the first one once normalized
+		"mixed.test.com.A.bindman": {Name: "mixed.test.com", Value: "0.0.0.4", Type: "A"},
+	}
+	for key, r := range legacy {
+		b, _ := json.Marshal(r)
+		if err := store.Write(key, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := new(Builder).New(new(MockDNSUpdater), keyBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, err := m.GetDNSRecord("*.TEST.com", "a"); err != nil || r.Value != "0.0.0.2" {
+		t.Errorf("Expecting the wildcard record to be found by its normalized key. Got '%v' and err '%v'", r, err)
+	}
+	if !store.Has("%2A.test.com.A.bindman") || store.Has("*.test.com.A.bindman") {
+		t.Error("Expecting the wildcard record file to be moved")
+	}
+	if r, err := m.GetDNSRecord("plain.test.com", "A"); err != nil || r.Value != "0.0.0.3" {
+		t.Errorf("Expecting the already normalized record to be kept. Got '%v' and err '%v'", r, err)
+	}
+	if r, err := m.GetDNSRecord("MIXED.test.com", "A"); err != nil || r.Value != "0.0.0.4" {
+		t.Errorf("Expecting the record already at the normalized key to be kept. Got '%v' and err '%v'", r, err)
+	}
+	if r, err := m.GetRecord("upper.test.com", "A"); err != nil || r.Name != "upper.test.com" || r.Type != "A" || r.RequestedName != "Upper.Test.COM." {
+		t.Errorf("Expecting the stored name and type to be put in their canonical form. Got '%+v' and err '%v'", r, err)
+	}
+	if records, _, _ := m.ListDNSRecords(RecordFilter{NameSuffix: "upper.test.com"}); len(records) != 1 || records[0].Name != "upper.test.com" {
+		t.Errorf("Expecting the record to be listed by its canonical name. Got %v", records)
+	}
+	quarantined, _ := filepath.Glob(filepath.Join(keyBasePath, QuarantineDir, "Mixed.Test.com.A.bindman.*"))
+	if store.Has("Mixed.Test.com.A.bindman") || len(quarantined) != 1 {
+		t.Error("Expecting the colliding record to be quarantined")
+	}
+}
@@ -0,0 +1,52 @@
+package manager
+
+import "sync"
+
+// keyLock is a mutex shared by the operations on one record
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// keyLocks hands out one mutex per record key, so the operations on the same record are serialized end to end
+// while the operations on unrelated records run in parallel
+type keyLocks struct {
+	lock  sync.Mutex
+	locks map[string]*keyLock
+}
+
+// newKeyLocks creates an empty set of key locks
+func newKeyLocks() *keyLocks {
+	return &keyLocks{locks: make(map[string]*keyLock)}
+}
+
+// Lock waits for the key to be free and locks it; the returned function unlocks it
+func (k *keyLocks) Lock(key string) (unlock func()) {
+	k.lock.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = new(keyLock)
+		k.locks[key] = l
+	}
+	l.refs++
+	k.lock.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		k.lock.Lock()
+		defer k.lock.Unlock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+	}
+}
+
+// size returns the number of keys currently locked or waited for
+func (k *keyLocks) size() int {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return len(k.locks)
+}
@@ -0,0 +1,88 @@
+package manager
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const keyLockBasePath = "./data-keylock"
+
+func TestKeyLocks(t *testing.T) {
+	locks := newKeyLocks()
+
+	unlock := locks.Lock("a")
+	acquired := make(chan struct{})
+	go func() {
+		unlockAgain := locks.Lock("a")
+		close(acquired)
+		unlockAgain()
+	}()
+
+	unlockOther := locks.Lock("b") // must not block
+	unlockOther()
+
+	select {
+	case <-acquired:
+		t.Fatal("Expecting a locked key to not be acquired twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Expecting the key to be acquired once unlocked")
+	}
+
+	for i := 0; i < 100 && locks.size() > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if locks.size() != 0 {
+		t.Errorf("Expecting the released keys to be forgotten. Got %d keys", locks.size())
+	}
+}
+
+func TestOperationsOnTheSameRecordAreSerialized(t *testing.T) {
+	_ = os.RemoveAll(keyLockBasePath)
+	defer os.RemoveAll(keyLockBasePath)
+
+	updater := &MockDNSUpdater{Gate: make(chan struct{})}
+	m, err := (&Builder{TTL: time.Hour, RemovalDelay: time.Hour}).New(updater, keyLockBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := hookTypes.DNSRecord{Name: "locked.test.com", Value: "0.0.0.0", Type: "A"}
+
+	added := make(chan error)
+	go func() { added <- m.AddDNSRecord(context.Background(), record) }()
+	for i := 0; i < 100 && m.locks.size() == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the removal must wait for the addition to finish, so it finds the record
+	removed := make(chan error)
+	go func() { removed <- m.RemoveDNSRecord(context.Background(), record.Name, record.Type) }()
+
+	// unrelated records are not blocked
+	if err := m.UpdateDNSRecord(context.Background(), hookTypes.DNSRecord{Name: "unrelated.test.com", Value: "0.0.0.0", Type: "A"}); err != nil {
+		t.Errorf("Expecting the update of an unrelated record to succeed. Got err '%v'", err)
+	}
+
+	select {
+	case err := <-removed:
+		t.Fatalf("Expecting the removal to wait for the addition. Got err '%v'", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(updater.Gate)
+	if err := <-added; err != nil {
+		t.Errorf("Expecting the addition to succeed. Got err '%v'", err)
+	}
+	if err := <-removed; err != nil {
+		t.Errorf("Expecting the removal to succeed after the addition. Got err '%v'", err)
+	}
+}
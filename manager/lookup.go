@@ -0,0 +1,71 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+// Lookup compares the record stored for a name and type with the answer of the nameserver
+type Lookup struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Stored the record stored; unset when there is none
+	Stored *Record          `json:"stored,omitempty"`
+	Served *nsupdate.Answer `json:"served"`
+	// InSync tells whether the nameserver authoritatively serves the record stored, with the TTL set, and nothing else
+	InSync bool `json:"inSync"`
+	// Reasons why the record stored and the answer of the nameserver differ
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// LookupRecord queries the nameserver for the name and type, comparing its answer with the record stored
+func (m *Bind9Manager) LookupRecord(ctx context.Context, name, recordType string) (*Lookup, error) {
+	querier, ok := m.DNSUpdater.(nsupdate.RecordQuerier)
+	if !ok {
+		return nil, hookTypes.NotFoundError("The live lookup is not supported", nil)
+	}
+	record := Record{DNSRecord: hookTypes.DNSRecord{Name: name, Type: recordType}}
+	if err := normalizeRecord(&record); err != nil {
+		return nil, err
+	}
+	answer, err := querier.QueryRecord(ctx, record.Name, record.Type)
+	if err != nil {
+		if e, ok := err.(*hookTypes.Error); ok {
+			return nil, e
+		}
+		return nil, &hookTypes.Error{Message: "Not possible to query the nameserver", Code: http.StatusBadGateway, Err: err, Details: []string{err.Error()}}
+	}
+
+	lookup := &Lookup{Name: record.Name, Type: record.Type, Served: answer}
+	if stored, err := m.GetRecord(record.Name, record.Type); err == nil {
+		lookup.Stored = stored
+	}
+	if !answer.Authoritative {
+		lookup.Reasons = append(lookup.Reasons, "the nameserver is not authoritative for the name")
+	}
+	switch {
+	case lookup.Stored != nil:
+		if reason := answer.Check(record.Type, lookup.Stored.Value, m.TTL); reason != "" {
+			lookup.Reasons = append(lookup.Reasons, reason)
+		}
+	case len(answer.Records) > 0 && m.removalPending(record.Name, record.Type):
+		lookup.Reasons = append(lookup.Reasons, "the record is served until its removal delay is over")
+	case len(answer.Records) > 0:
+		lookup.Reasons = append(lookup.Reasons, "the record is served but not stored")
+	}
+	lookup.InSync = len(lookup.Reasons) == 0
+	return lookup, nil
+}
+
+// removalPending tells whether the removal of the record is waiting for its removal delay to be over
+func (m *Bind9Manager) removalPending(name, recordType string) bool {
+	for _, r := range m.scheduler.Pending() {
+		if r.Name == name && r.Type == recordType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package manager
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/miekg/dns"
+)
+
+const lookupBasePath = "./data-lookup"
+
+// queryingUpdater is a MockDNSUpdater querying the records from an actual nameserver
+type queryingUpdater struct {
+	MockDNSUpdater
+	nsu *nsupdate.NSUpdate
+}
+
+func (q *queryingUpdater) QueryRecord(ctx context.Context, name, recordType string) (*nsupdate.Answer, error) {
+	return q.nsu.QueryRecord(ctx, name, recordType)
+}
+
+func TestLookupRecord(t *testing.T) {
+	_ = os.RemoveAll(lookupBasePath)
+	defer os.RemoveAll(lookupBasePath)
+
+	var rrs []dns.RR
+	for _, record := range []string{
+		"test.com. 3600 IN SOA ns.test.com. admin.test.com. 42 3600 600 86400 3600",
+		"app.test.com. 3600 IN A 10.0.0.1",
+		"stale.test.com. 3600 IN A 10.0.0.1",
+		"short.test.com. 60 IN A 10.0.0.1",
+		"old.test.com. 3600 IN A 10.0.0.1",
+		"unknown.test.com. 3600 IN A 10.0.0.1",
+	} {
+		rr, _ := dns.NewRR(record)
+		rrs = append(rrs, rr)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{Listener: listener, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		answer := new(dns.Msg)
+		answer.SetReply(r)
+		answer.Authoritative = true
+		for _, rr := range rrs {
+			if rr.Header().Name == r.Question[0].Name && rr.Header().Rrtype == r.Question[0].Qtype {
+				answer.Answer = append(answer.Answer, rr)
+			}
+		}
+		_ = w.WriteMsg(answer)
+	})}
+	go func() { _ = server.ActivateAndServe() }()
+	defer server.Shutdown()
+
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	updater := &queryingUpdater{nsu: &nsupdate.NSUpdate{Builder: nsupdate.Builder{Server: "127.0.0.1", Port: port, Zone: "test.com", Timeout: time.Second}}}
+	m, err := (&Builder{TTL: time.Hour, RemovalDelay: time.Hour}).New(updater, lookupBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, name := range []string{"app.test.com", "stale.test.com", "short.test.com", "old.test.com", "missing.test.com"} {
+		_ = m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: name, Value: "10.0.0.1", Type: "A"})
+	}
+	_ = m.UpdateDNSRecord(ctx, hookTypes.DNSRecord{Name: "stale.test.com", Value: "10.0.0.2", Type: "A"})
+	_ = m.RemoveDNSRecord(ctx, "old.test.com", "A")
+
+	tests := []struct {
+		name    string
+		reasons []string
+	}{
+		{"App.test.com", nil},
+		{"stale.test.com", []string{"the record is not served"}},
+		{"short.test.com", []string{"the record is served with the TTL 60 instead of 3600"}},
+		{"old.test.com", []string{"the record is served until its removal delay is over"}},
+		{"unknown.test.com", []string{"the record is served but not stored"}},
+		{"missing.test.com", []string{"the record is not served"}},
+		{"never.test.com", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lookup, err := m.LookupRecord(ctx, test.name, "a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lookup.InSync != (test.reasons == nil) || !reflect.DeepEqual(lookup.Reasons, test.reasons) {
+				t.Errorf("Expecting the reasons %v. Got %v, in sync: %v", test.reasons, lookup.Reasons, lookup.InSync)
+			}
+			if !lookup.Served.Authoritative || lookup.Served.Serial == nil || *lookup.Served.Serial != 42 {
+				t.Errorf("Expecting the authoritative answer along with the serial. Got %+v", lookup.Served)
+			}
+		})
+	}
+
+	lookup, _ := m.LookupRecord(ctx, "app.test.com", "A")
+	if lookup.Stored == nil || !reflect.DeepEqual(lookup.Served.Records, []nsupdate.ServedRecord{{Value: "10.0.0.1", TTL: 3600}}) {
+		t.Errorf("Expecting both the stored record and the served one. Got %+v and %+v", lookup.Stored, lookup.Served.Records)
+	}
+	_, err = m.LookupRecord(ctx, "app.other.com", "A")
+	if hookErr, ok := err.(*hookTypes.Error); !ok || hookErr.Code != http.StatusBadRequest {
+		t.Errorf("Expecting a name out of the zone to be rejected as a bad request. Got '%v'", err)
+	}
+}
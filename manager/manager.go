@@ -1,32 +1,74 @@
 package manager
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
 	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
-	"github.com/peterbourgon/diskv"
 	"github.com/sirupsen/logrus"
 )
 
 type Builder struct {
-	TTL          time.Duration
-	RemovalDelay time.Duration
+	TTL                time.Duration
+	RemovalDelay       time.Duration
+	RemovalConcurrency int
+	Async              bool
+	QueueSize          int
+	QueueWorkers       int
+	OperationRetention time.Duration
+	CoalesceWindow     time.Duration
+	// Store the backend of the record store: StoreDiskv or StoreBolt
+	Store string
+	// PendingRemovalsOnShutdown what to do with the pending removals on shutdown: ShutdownPersist or ShutdownExecute
+	PendingRemovalsOnShutdown string
+	ShutdownTimeout           time.Duration
+	// EventBuffer the number of recent events kept for the subscribers resuming the change stream
+	EventBuffer int
+	// WebhookURLs the URLs notified of every change to the records; none disables the notifications
+	WebhookURLs []string
+	// WebhookSecret the secret keying the signature of the notifications, required by the WebhookURLs
+	WebhookSecret      string
+	WebhookTimeout     time.Duration
+	WebhookMaxAttempts int
+	// Secondaries the secondary nameservers, as host or host:port, whose propagation of the changes is tracked; none disables the tracking
+	Secondaries         []string
+	PropagationInterval time.Duration
+	// FileSourceDir the directory whose YAML and JSON record files the records of the FileSourceScope are converged to; empty disables the file source
+	FileSourceDir string
+	// FileSourceScope the zone or domain within it whose records are owned by the file source; required with a FileSourceDir
+	FileSourceScope    string
+	FileSourceInterval time.Duration
+	// FileSourceAllowEmpty allows converging to a directory with no record file, which removes every record of the scope
+	FileSourceAllowEmpty bool
+	// ReverseUpdater maintains the PTR records of the A and AAAA records; nil disables the PTR records
+	ReverseUpdater nsupdate.ReverseUpdater
 }
 
 // Bind9Manager holds the information for managing a bind9 dns server
 type Bind9Manager struct {
 	*Builder
-	DNSRecords *diskv.Diskv
+	DNSRecords RecordStore
 	Door       *sync.RWMutex
 	DNSUpdater nsupdate.DNSUpdater
+	// Queue holds the mutations to be applied asynchronously; nil unless the asynchronous mode is enabled
+	Queue     *Queue
+	coalescer *coalescer
+	intents   *journal
+	removals  *journal
+	index     *index
+	locks     *keyLocks
+	scheduler *scheduler
+	events    *events
+	notifier  *notifier
+	// propagation tracks the propagation of the changes to the secondaries; nil unless enabled
+	propagation *propagation
+	// files converges the records of its scope to the record files of a directory; nil unless enabled
+	files *fileSource
 }
 
 // New creates a new Bind9Manager
@@ -39,87 +81,232 @@ func (b *Builder) New(dnsupdater nsupdate.DNSUpdater, basePath string) (*Bind9Ma
 		return nil, errors.New("not possible to start the Bind9Manager; Bind9Manager expects a non-empty basePath")
 	}
 
+	switch b.PendingRemovalsOnShutdown {
+	case "", ShutdownPersist, ShutdownExecute:
+	default:
+		return nil, fmt.Errorf("not possible to start the Bind9Manager; unknown pending removals shutdown mode '%s', expecting '%s' or '%s'", b.PendingRemovalsOnShutdown, ShutdownPersist, ShutdownExecute)
+	}
+
+	if len(b.WebhookURLs) > 0 && b.WebhookSecret == "" {
+		return nil, errors.New("not possible to start the Bind9Manager; the webhook secret must be set to sign the notifications")
+	}
+
+	querier, ok := dnsupdater.(nsupdate.SerialQuerier)
+	if len(b.Secondaries) > 0 && !ok {
+		return nil, errors.New("not possible to start the Bind9Manager; the DNSUpdater cannot query the serial of the zone to track the propagation to the secondaries")
+	}
+
+	var fileSourceScope string
+	if b.FileSourceDir != "" {
+		if strings.TrimSpace(b.FileSourceScope) == "" {
+			return nil, errors.New("not possible to start the Bind9Manager; the scope of the file source must be set")
+		}
+		var err error
+		if fileSourceScope, err = nsupdate.NormalizeName(b.FileSourceScope); err != nil {
+			return nil, fmt.Errorf("not possible to start the Bind9Manager; invalid file source scope '%s': %v", b.FileSourceScope, err)
+		}
+		if _, ok := dnsupdater.(nsupdate.BatchUpdater); !ok {
+			return nil, errors.New("not possible to start the Bind9Manager; the DNSUpdater cannot apply several changes at once to converge to the file source")
+		}
+	}
+
+	store, err := OpenRecordStore(b.Store, basePath)
+	if err != nil {
+		return nil, fmt.Errorf("not possible to start the Bind9Manager; %v", err)
+	}
+	if err := checkRecords(store, basePath); err != nil {
+		return nil, fmt.Errorf("not possible to start the Bind9Manager; %v", err)
+	}
+	if err := migrateRecords(store); err != nil {
+		return nil, fmt.Errorf("not possible to start the Bind9Manager; %v", err)
+	}
+	idx, err := newIndex(store)
+	if err != nil {
+		return nil, fmt.Errorf("not possible to start the Bind9Manager; %v", err)
+	}
+
 	result := &Bind9Manager{
-		DNSRecords: diskv.New(diskv.Options{
-			BasePath:     basePath,
-			Transform:    func(s string) []string { return []string{} },
-			CacheSizeMax: 1024 * 1024,
-		}),
+		DNSRecords: store,
 		Builder:    b,
 		Door:       new(sync.RWMutex),
 		DNSUpdater: dnsupdater,
+		intents:    newJournal(basePath, intentsDir, intentExtension),
+		removals:   newJournal(basePath, removalsDir, removalsExtension),
+		locks:      newKeyLocks(),
+		index:      idx,
+		events:     newEvents(b.EventBuffer),
+	}
+	if len(b.WebhookURLs) > 0 {
+		result.notifier = newNotifier(b.WebhookURLs, b.WebhookSecret, b.WebhookTimeout, b.WebhookMaxAttempts, basePath)
+		result.events.notify = result.notifier.reserve
+	}
+	if len(b.Secondaries) > 0 {
+		result.propagation = newPropagation(querier, b.Secondaries, b.PropagationInterval, basePath)
+	}
+	result.scheduler = newScheduler(b.RemovalConcurrency, result.delayRemove)
+	result.recoverIntents()
+	result.loadRemovals()
+
+	if b.CoalesceWindow > 0 {
+		result.coalescer = newCoalescer(b.CoalesceWindow, result.apply, func(r Record) bool { return result.HasDNSRecord(r.Name, r.Type) })
+	}
+
+	if b.Async {
+		queue, err := newQueue(result, basePath)
+		if err != nil {
+			return nil, err
+		}
+		result.Queue = queue
+	}
+	if b.FileSourceDir != "" {
+		result.files = newFileSource(result, b.FileSourceDir, fileSourceScope, b.FileSourceInterval, b.FileSourceAllowEmpty)
 	}
 	return result, nil
 }
 
-// GetDNSRecords retrieves all the dns records being managed
+// GetDNSRecords retrieves all the dns records being managed, sorted by name and type
 func (m *Bind9Manager) GetDNSRecords() (records []hookTypes.DNSRecord, err error) {
-	m.Door.RLock()
-	defer m.Door.RUnlock()
-
-	err = filepath.Walk(m.DNSRecords.BasePath, func(path string, info os.FileInfo, errr error) error {
-		if strings.HasSuffix(path, Extension) {
-			r, err := m.GetDNSRecord(m.getRecordNameAndType(info.Name()))
-			if err != nil {
-				return err
-			}
-			if r != nil {
-				records = append(records, *r)
-			}
-		}
-		return nil
-	})
-
+	list, _, err := m.ListDNSRecords(RecordFilter{})
+	for _, r := range list {
+		records = append(records, r.DNSRecord)
+	}
 	return
 }
 
-// GetDNSRecord retrieves the dns record identified by name
+// ListDNSRecords retrieves the page of records selected by the filter, along with the cursor of the next page; it is empty on the last page
+func (m *Bind9Manager) ListDNSRecords(filter RecordFilter) ([]Record, string, error) {
+	return m.index.list(filter)
+}
+
+// HasDNSRecord tells whether the dns record identified by name and type exists
 func (m *Bind9Manager) HasDNSRecord(name, recordType string) bool {
-	key := m.getRecordFileName(name, recordType)
-	return m.DNSRecords.Has(key)
+	_, ok := m.index.get(m.getRecordFileName(name, recordType))
+	return ok
 }
 
 // GetDNSRecord retrieves the dns record identified by name
-func (m *Bind9Manager) GetDNSRecord(name, recordType string) (record *hookTypes.DNSRecord, err error) {
-	m.Door.RLock()
-	defer m.Door.RUnlock()
-
-	if !m.HasDNSRecord(name, recordType) {
-		return nil, hookTypes.NotFoundError(fmt.Sprintf("No record found with name '%s' and type '%s'", name, recordType), nil)
+func (m *Bind9Manager) GetDNSRecord(name, recordType string) (*hookTypes.DNSRecord, error) {
+	r, err := m.GetRecord(name, recordType)
+	if err != nil {
+		return nil, err
 	}
+	return &r.DNSRecord, nil
+}
 
-	var r []byte
-	r, err = m.DNSRecords.Read(m.getRecordFileName(name, recordType))
-	if err == nil {
-		err = json.Unmarshal(r, &record)
+// GetRecord retrieves the dns record identified by name along with its labels
+func (m *Bind9Manager) GetRecord(name, recordType string) (*Record, error) {
+	r, ok := m.index.get(m.getRecordFileName(name, recordType))
+	if !ok {
+		return nil, hookTypes.NotFoundError(fmt.Sprintf("No record found with name '%s' and type '%s'", name, recordType), nil)
 	}
-	return
+	return &r, nil
 }
 
 // AddDNSRecord adds a new DNS record
-func (m *Bind9Manager) AddDNSRecord(record hookTypes.DNSRecord) (err error) {
-	err = m.DNSUpdater.AddRR(record, m.TTL)
-	if err == nil {
-		err = m.saveRecord(record)
-	}
-	return
+func (m *Bind9Manager) AddDNSRecord(ctx context.Context, record hookTypes.DNSRecord) error {
+	return m.AddRecord(ctx, Record{DNSRecord: record})
+}
+
+// AddRecord adds a new DNS record along with its labels
+func (m *Bind9Manager) AddRecord(ctx context.Context, record Record) error {
+	return m.do(ctx, change{Type: OperationAdd, Record: record})
 }
 
 // UpdateDNSRecord updates an existing dns record
-func (m *Bind9Manager) UpdateDNSRecord(record hookTypes.DNSRecord) (err error) {
-	err = m.DNSUpdater.UpdateRR(record, m.TTL)
-	if err == nil {
-		err = m.saveRecord(record)
-	}
-	return
+func (m *Bind9Manager) UpdateDNSRecord(ctx context.Context, record hookTypes.DNSRecord) error {
+	return m.UpdateRecord(ctx, Record{DNSRecord: record})
+}
+
+// UpdateRecord updates an existing dns record, replacing its labels
+func (m *Bind9Manager) UpdateRecord(ctx context.Context, record Record) error {
+	return m.do(ctx, change{Type: OperationUpdate, Record: record})
 }
 
 // RemoveDNSRecord removes a DNS record
-func (m *Bind9Manager) RemoveDNSRecord(name, recordType string) error {
+func (m *Bind9Manager) RemoveDNSRecord(ctx context.Context, name, recordType string) error {
+	return m.do(ctx, change{Type: OperationRemove, Record: Record{DNSRecord: hookTypes.DNSRecord{Name: name, Type: recordType}}})
+}
+
+// do applies the change to the record in its canonical form, coalescing it with other changes to the same record when a coalescing window is set
+func (m *Bind9Manager) do(ctx context.Context, c change) error {
+	if err := normalizeRecord(&c.Record); err != nil {
+		return err
+	}
+	if err := m.checkOwner(c.Record.Name); err != nil {
+		return err
+	}
+	if m.coalescer != nil {
+		return m.coalescer.do(ctx, c)
+	}
+	return m.apply(ctx, c)
+}
+
+// apply applies the change right away, once every other operation on the same record is finished
+func (m *Bind9Manager) apply(ctx context.Context, c change) error {
+	// the records of other types of the name are checked for conflicts, and changed at once by the batches, so they must not
+	// change in the meantime
+	unlockName := m.locks.Lock(nameLockKey(c.Record.Name))
+	defer unlockName()
+	unlock := m.locks.Lock(m.getRecordFileName(c.Record.Name, c.Record.Type))
+	defer unlock()
+
+	var err error
+	switch c.Type {
+	case OperationAdd:
+		if err = m.checkConflicts(ctx, c.Record, nil); err == nil {
+			err = m.addDNSRecord(ctx, c.Record)
+		}
+	case OperationUpdate:
+		if err = m.checkConflicts(ctx, c.Record, nil); err == nil {
+			err = m.updateDNSRecord(ctx, c.Record)
+		}
+	case OperationRemove:
+		return m.removeDNSRecord(ctx, c.Record.Name, c.Record.Type)
+	default:
+		return fmt.Errorf("unknown operation type '%s'", c.Type)
+	}
+
+	// a record added again is not to be removed anymore
+	if err == nil && m.scheduler.cancel(m.getRecordFileName(c.Record.Name, c.Record.Type)) {
+		logrus.Infof("Cancelling delayed removal of '%s'", c.Record.Name)
+	}
+	return err
+}
+
+// addDNSRecord adds a new DNS record right away
+func (m *Bind9Manager) addDNSRecord(ctx context.Context, record Record) error {
+	return m.transact(ctx, OperationAdd, record, func() error {
+		return m.DNSUpdater.AddRR(ctx, record.DNSRecord, m.TTL)
+	})
+}
+
+// updateDNSRecord updates an existing dns record right away
+func (m *Bind9Manager) updateDNSRecord(ctx context.Context, record Record) error {
+	return m.transact(ctx, OperationUpdate, record, func() error {
+		return m.DNSUpdater.UpdateRR(ctx, record.DNSRecord, m.TTL)
+	})
+}
+
+// removeDNSRecord schedules the removal of a DNS record right away
+func (m *Bind9Manager) removeDNSRecord(_ context.Context, name, recordType string) error {
 	if !m.HasDNSRecord(name, recordType) {
 		return hookTypes.NotFoundError(fmt.Sprintf("No record found with name '%s' and type '%s", name, recordType), nil)
 	}
-	go m.delayRemove(name, recordType)
+	record, _ := m.index.get(m.getRecordFileName(name, recordType))
+	m.removeRecord(name, recordType) // marks its removal intent
+	dueAt := time.Now().Add(m.RemovalDelay)
+	m.scheduler.schedule(m.getRecordFileName(name, recordType), name, recordType, record.Value, dueAt)
+	m.events.publish(EventRemoveScheduled, record, &dueAt)
 	logrus.Infof("Record '%s' with type '%v' scheduled to be removed in %v", name, recordType, m.RemovalDelay)
 	return nil
 }
+
+// PendingRemovals lists the removals waiting for their removal delay to be over, sorted by due time
+func (m *Bind9Manager) PendingRemovals() []Removal {
+	return m.scheduler.Pending()
+}
+
+// RunningRemovals returns the number of removals being executed
+func (m *Bind9Manager) RunningRemovals() int {
+	return m.scheduler.Running()
+}
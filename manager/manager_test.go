@@ -1,20 +1,27 @@
 package manager
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
 	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
 )
 
-const basePath = "./data"
+const (
+	basePath      = "./data"
+	namesBasePath = "./data-names"
+)
 
 func TestMain(m *testing.M) {
 	exitCode := m.Run()
-	_ = os.Remove(basePath)
+	_ = os.RemoveAll(basePath)
 	os.Exit(exitCode)
 }
 
@@ -71,7 +78,7 @@ func TestUpdateDNSRecord(t *testing.T) {
 	record := rs[0]
 	record.Value = newValue
 
-	err := m.UpdateDNSRecord(record)
+	err := m.UpdateDNSRecord(context.Background(), record)
 	if err != nil {
 		t.Errorf("Expecting the update of the record '%v' to succeed. Got err '%v'", record, err)
 	}
@@ -108,7 +115,7 @@ func TestDelayRemove(t *testing.T) {
 
 	m.RemovalDelay = 2 * time.Second
 	// rest remove
-	err := m.RemoveDNSRecord("test0.test.com", "A")
+	err := m.RemoveDNSRecord(context.Background(), "test0.test.com", "A")
 	if err != nil {
 		t.Errorf("Expecting removal of the record '%v' to succeed. Got err '%v'", "test0.test.com", err)
 	}
@@ -132,7 +139,7 @@ func TestDelayRemove(t *testing.T) {
 	}
 
 	// remove nonexistent record
-	err = m.RemoveDNSRecord("test0.test.com", "A")
+	err = m.RemoveDNSRecord(context.Background(), "test0.test.com", "A")
 	if err == nil {
 		t.Errorf("Expecting removal of the record '%v' to fail. Got err nil", "test0.test.com")
 	}
@@ -151,6 +158,104 @@ func TestGetRecordFileName(t *testing.T) {
 	}
 }
 
+func TestApexAndWildcardRecords(t *testing.T) {
+	_ = os.RemoveAll(namesBasePath)
+	defer os.RemoveAll(namesBasePath)
+	m, err := new(Builder).New(new(MockDNSUpdater), namesBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []hookTypes.DNSRecord{
+		{Name: "test.com", Value: "v=spf1 -all", Type: "TXT"},
+		{Name: "*.apps.test.com", Value: "0.0.0.1", Type: "A"},
+		{Name: "a.apps.test.com", Value: "0.0.0.2", Type: "A"},
+	}
+	for _, r := range records {
+		if err := m.AddDNSRecord(context.Background(), r); err != nil {
+			t.Fatalf("Expecting the addition of '%s' to succeed. Got err '%v'", r.Name, err)
+		}
+	}
+
+	for _, r := range records {
+		got, err := m.GetDNSRecord(r.Name, r.Type)
+		if err != nil || got.Value != r.Value {
+			t.Errorf("Expecting '%s' to be stored on its own. Got '%v' and err '%v'", r.Name, got, err)
+		}
+	}
+	if m.HasDNSRecord("b.apps.test.com", "A") {
+		t.Error("Expecting the wildcard record to be stored under its literal name only")
+	}
+	if name, recordType := m.getRecordNameAndType(m.getRecordFileName("*.apps.test.com", "A")); name != "*.apps.test.com" || recordType != "A" {
+		t.Errorf("Expecting the wildcard name to be read back from its key. Got %v and %v", name, recordType)
+	}
+}
+
+func TestNormalizedNames(t *testing.T) {
+	_ = os.RemoveAll(namesBasePath)
+	defer os.RemoveAll(namesBasePath)
+	m, err := new(Builder).New(new(MockDNSUpdater), namesBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.AddDNSRecord(context.Background(), hookTypes.DNSRecord{Name: "Web.Bücher.Test.COM.", Value: "0.0.0.1", Type: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"web.xn--bcher-kva.test.com", "WEB.bücher.test.com", "web.xn--bcher-kva.test.com."} {
+		r, err := m.GetRecord(name, "A")
+		if err != nil {
+			t.Errorf("Expecting the record to be found as '%s'. Got err '%v'", name, err)
+			continue
+		}
+		if r.Name != "web.xn--bcher-kva.test.com" || r.Type != "A" || r.RequestedName != "Web.Bücher.Test.COM." {
+			t.Errorf("Expecting the canonical name to be stored along with the requested one. Got %+v", r)
+		}
+	}
+
+	invalid := []string{"a..test.com", strings.Repeat("a", 64) + ".test.com", "a b.test.com"}
+	for _, name := range invalid {
+		err := m.AddDNSRecord(context.Background(), hookTypes.DNSRecord{Name: name, Value: "0.0.0.1", Type: "A"})
+		if hookErr, ok := err.(*hookTypes.Error); !ok || hookErr.Code != http.StatusBadRequest {
+			t.Errorf("Expecting '%s' to be rejected as a bad request. Got '%v'", name, err)
+		}
+	}
+}
+
+func TestStructuredData(t *testing.T) {
+	_ = os.RemoveAll(namesBasePath)
+	defer os.RemoveAll(namesBasePath)
+	updater := new(MockDNSUpdater)
+	m, err := new(Builder).New(updater, namesBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	priority := 10
+	record := Record{DNSRecord: hookTypes.DNSRecord{Name: "test.com", Type: "mx"}, Data: &nsupdate.RecordData{Priority: &priority, Target: "Mail.test.com"}}
+	if err := m.AddRecord(context.Background(), record); err != nil {
+		t.Fatal(err)
+	}
+	r, err := m.GetRecord("test.com", "MX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Value != "10 mail.test.com." || r.Data == nil || *r.Data.Priority != priority {
+		t.Errorf("Expecting the value to be rendered from the data, and both to be stored. Got %+v", r)
+	}
+
+	// the record as stored can be sent again
+	r.Data.Target = "mail.test.com."
+	if err := m.UpdateRecord(context.Background(), *r); err != nil {
+		t.Errorf("Expecting the value matching the data to be accepted. Got '%v'", err)
+	}
+
+	r.Value = "20 other.test.com."
+	err = m.UpdateRecord(context.Background(), *r)
+	if hookErr, ok := err.(*hookTypes.Error); !ok || hookErr.Code != http.StatusBadRequest {
+		t.Errorf("Expecting a value not matching the data to be rejected as a bad request. Got '%v'", err)
+	}
+}
+
 func TestGetRecordName(t *testing.T) {
 	m, _, _ := initManagerWithNRecords(0, t)
 
@@ -173,7 +278,7 @@ func initManagerWithNRecords(numberOfRecords int, t *testing.T) (*Bind9Manager,
 
 	for i := 0; i < numberOfRecords; i++ {
 		record2Add := hookTypes.DNSRecord{Name: fmt.Sprintf("test%v.test.com", i), Value: "0.0.0.0", Type: "A"}
-		err := m.AddDNSRecord(record2Add)
+		err := m.AddDNSRecord(context.Background(), record2Add)
 		if err != nil {
 			t.Errorf("Expecting the addition of the record '%v' to succeed. Got err '%v'", record2Add, err)
 		}
@@ -188,17 +293,26 @@ type MockDNSUpdater struct {
 	Result       bool
 	Error        error
 	RemovalCount uint64
+	AddCount     uint64
+	UpdateCount  uint64
+	// Gate when set, makes AddRR wait for a value to be received
+	Gate chan struct{}
 }
 
-func (mnsu *MockDNSUpdater) AddRR(_ hookTypes.DNSRecord, _ time.Duration) error {
+func (mnsu *MockDNSUpdater) AddRR(_ context.Context, _ hookTypes.DNSRecord, _ time.Duration) error {
+	atomic.AddUint64(&mnsu.AddCount, 1)
+	if mnsu.Gate != nil {
+		<-mnsu.Gate
+	}
 	return mnsu.Error
 }
 
-func (mnsu *MockDNSUpdater) RemoveRR(_, _ string) error {
+func (mnsu *MockDNSUpdater) RemoveRR(_ context.Context, _, _ string) error {
 	atomic.AddUint64(&mnsu.RemovalCount, 1)
 	return mnsu.Error
 }
 
-func (mnsu *MockDNSUpdater) UpdateRR(_ hookTypes.DNSRecord, _ time.Duration) error {
+func (mnsu *MockDNSUpdater) UpdateRR(_ context.Context, _ hookTypes.DNSRecord, _ time.Duration) error {
+	atomic.AddUint64(&mnsu.UpdateCount, 1)
 	return mnsu.Error
 }
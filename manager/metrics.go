@@ -0,0 +1,12 @@
+package manager
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var savedUpdates = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "bindman_coalesced_updates_saved_total",
+	Help: "How many DNS updates were not sent to the nameserver because they were coalesced with other changes to the same record.",
+})
+
+func init() {
+	prometheus.MustRegister(savedUpdates)
+}
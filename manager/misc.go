@@ -1,9 +1,8 @@
 package manager
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"strings"
 	"time"
 
 	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
@@ -15,63 +14,67 @@ const (
 	Extension = "bindman"
 )
 
-// delayRemove schedules the removal of a DNS Resource Record
-// it cancels the operation when it identifies the name was read
-func (m *Bind9Manager) delayRemove(name, recordType string) {
-	if m.HasDNSRecord(name, recordType) {
-		go m.removeRecord(name, recordType) // marks its removal intent
-		ticker := time.NewTicker(m.RemovalDelay)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
+// delayRemove removes a DNS Resource Record from the nameserver once the removal delay is over
+// it cancels the operation when it identifies the record was added again in the meantime
+func (m *Bind9Manager) delayRemove(name, recordType, value string) {
+	// locked in the same order as apply, so the records of the name do not change in the meantime
+	unlockName := m.locks.Lock(nameLockKey(name))
+	defer unlockName()
+	unlock := m.locks.Lock(m.getRecordFileName(name, recordType))
+	defer unlock()
 
-				if _, err := m.DNSRecords.Read(m.getRecordFileName(name, recordType)); err == nil { // record has been read
-					logrus.Infof("Cancelling delayed removal of '%s'", name)
-					return
-				}
+	if m.HasDNSRecord(name, recordType) { // record has been added again
+		logrus.Infof("Cancelling delayed removal of '%s'", name)
+		return
+	}
 
-				// only remove in case the record has not been read
-				if err := m.DNSUpdater.RemoveRR(name, recordType); err != nil {
-					logrus.Infof("Error occurred while trying to remove '%s': %s", name, err)
-				}
-				return
-			}
-		}
-	} else {
-		logrus.Errorf("Service '%v' cannot be removed given it does not exist.", name)
+	// only remove in case the record has not been added again
+	record := Record{DNSRecord: hookTypes.DNSRecord{Name: name, Value: value, Type: recordType}}
+	if err := m.transact(context.Background(), OperationRemove, record, func() error {
+		return m.DNSUpdater.RemoveRR(context.Background(), name, recordType)
+	}); err != nil {
+		logrus.Infof("Error occurred while trying to remove '%s': %s", name, err)
 	}
 }
 
-// saveRecord saves a record to the local storage
-func (m *Bind9Manager) saveRecord(record hookTypes.DNSRecord) (err error) {
+// saveRecord saves a record to the local storage and the index
+func (m *Bind9Manager) saveRecord(record Record) (err error) {
+	m.Door.Lock()
+	defer m.Door.Unlock()
+
+	key := m.getRecordFileName(record.Name, record.Type)
+	var previous *Record
+	if r, ok := m.index.get(key); ok {
+		previous = &r
+	}
+	env := newEnvelope(record, previous, time.Now())
+
 	var r []byte
-	r, err = json.Marshal(record)
+	r, err = json.Marshal(env)
 	if err == nil {
-		m.Door.Lock()
-		defer m.Door.Unlock()
-
-		err = m.DNSRecords.Write(m.getRecordFileName(record.Name, record.Type), r)
+		if err = m.DNSRecords.Write(key, r); err == nil {
+			m.index.put(key, env.record())
+		}
 	}
 	return
 }
 
-// removeRecord removes the record
+// removeRecord removes the record from the local storage and the index
 func (m *Bind9Manager) removeRecord(recordName, recordType string) {
 	m.Door.Lock()
 	defer m.Door.Unlock()
-	_ = m.DNSRecords.Erase(m.getRecordFileName(recordName, recordType)) // marks its removal
+	key := m.getRecordFileName(recordName, recordType)
+	_ = m.DNSRecords.Erase(key) // marks its removal
+	m.index.remove(key)
 }
 
 // getRecordFileName return the name of the file holding the record information
 func (m *Bind9Manager) getRecordFileName(recordName, recordType string) string {
-	toReturn := fmt.Sprintf("%v.%v.%v", recordName, recordType, Extension)
-	return toReturn
+	return recordKey(recordName, recordType)
 }
 
-// getRecordName returns the name of a record from its fileName
+// getRecordName returns the normalized name and type of a record from its fileName
 func (m *Bind9Manager) getRecordNameAndType(fileName string) (string, string) {
-	subName := strings.TrimSuffix(fileName, "."+Extension)
-	i := strings.LastIndex(subName, ".")
-	return subName[:i], subName[i+1:]
+	name, recordType, _ := parseRecordKey(fileName)
+	return name, recordType
 }
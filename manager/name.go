@@ -0,0 +1,48 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+// normalizeRecord puts the name and type of the record in their canonical form, keeping the name as requested when it differs
+func normalizeRecord(record *Record) error {
+	canonical, err := nsupdate.NormalizeName(record.Name)
+	if err != nil {
+		return err
+	}
+	record.RequestedName = ""
+	if canonical != record.Name {
+		record.RequestedName = record.Name
+	}
+	record.Name = canonical
+	record.Type = strings.ToUpper(strings.TrimSpace(record.Type))
+	return record.Render()
+}
+
+// Render sets the value of the record from its structured data, if any. A value sent along with the data must match the one rendered
+func (r *Record) Render() error {
+	if r.Data == nil {
+		return nil
+	}
+	value, err := nsupdate.RenderRDATA(r.Type, r.Data)
+	if err != nil {
+		return err
+	}
+	if r.Value != "" && r.Value != value {
+		return hookTypes.BadRequestError(fmt.Sprintf("The value '%s' does not match the value '%s' rendered from the data", r.Value, value), nil)
+	}
+	r.Value = value
+	return nil
+}
+
+// canonicalName returns the canonical form of the name, or the name lower cased when it is not valid
+func canonicalName(name string) string {
+	if canonical, err := nsupdate.NormalizeName(name); err == nil {
+		return canonical
+	}
+	return strings.ToLower(name)
+}
@@ -0,0 +1,359 @@
+package manager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+// maxApplyAttempts how many times the changes of an apply are computed again when records of new names show up in the scope
+// while its names are being locked
+const maxApplyAttempts = 3
+
+// DesiredState is the complete set of records wanted within a scope
+type DesiredState struct {
+	// Scope the zone or the domain within it covered by the records: the stored records of the scope left out are removed
+	Scope   string   `json:"scope"`
+	Records []Record `json:"records"`
+	// Plan the id of a plan previously made; when set, the changes are only applied if they are still the ones planned
+	Plan string `json:"plan,omitempty"`
+}
+
+// PlannedChange is a change to a record needed to reach the desired state
+type PlannedChange struct {
+	// Type one of OperationAdd, OperationUpdate and OperationRemove
+	Type string `json:"type"`
+	// Record the desired record, or the record to be removed
+	Record Record `json:"record"`
+	// Previous the stored record replaced or removed by the change
+	Previous *Record `json:"previous,omitempty"`
+}
+
+// Plan is the set of changes turning the stored records of a scope into the desired ones
+type Plan struct {
+	// ID identifies the changes of the plan, so they can be applied only if they have not changed since
+	ID        string          `json:"id"`
+	Scope     string          `json:"scope"`
+	Changes   []PlannedChange `json:"changes"`
+	Adds      int             `json:"adds"`
+	Updates   int             `json:"updates"`
+	Removals  int             `json:"removals"`
+	Unchanged int             `json:"unchanged"`
+}
+
+// PlanChanges computes the changes turning the stored records of the scope into the desired ones. It fails with a bad request
+// error when the desired records are not valid, and with a conflict error when the changes would leave a CNAME record
+// along with other records of its name
+func (m *Bind9Manager) PlanChanges(ctx context.Context, state DesiredState) (*Plan, error) {
+	scope, desired, err := m.desired(state)
+	if err != nil {
+		return nil, err
+	}
+	plan := m.plan(scope, desired)
+	if err := m.checkPlan(ctx, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// ApplyChanges computes the changes turning the stored records of the scope into the desired ones and applies them at once:
+// the nameserver either applies every change or none. Every record of the scope is locked meanwhile. The removals are applied
+// right away, not waiting for the removal delay. It requires the DNSUpdater to implement nsupdate.BatchUpdater, and the
+// scope not to overlap the one of the file source
+func (m *Bind9Manager) ApplyChanges(ctx context.Context, state DesiredState) (*Plan, error) {
+	if err := m.checkScopeOwner(state.Scope); err != nil {
+		return nil, err
+	}
+	return m.applyChanges(ctx, state)
+}
+
+// applyChanges applies the changes turning the stored records of the scope into the desired ones, whoever owns them
+func (m *Bind9Manager) applyChanges(ctx context.Context, state DesiredState) (*Plan, error) {
+	updater, ok := m.DNSUpdater.(nsupdate.BatchUpdater)
+	if !ok {
+		return nil, &hookTypes.Error{Message: "The DNSUpdater cannot apply several changes at once", Code: http.StatusNotImplemented}
+	}
+	scope, desired, err := m.desired(state)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < maxApplyAttempts; attempt++ {
+		names := m.plan(scope, desired).names(desired)
+		unlock := m.lockNames(names)
+		plan := m.plan(scope, desired)
+		if !plan.within(names) {
+			// records of other names have been stored in the scope before their name could be locked
+			unlock()
+			continue
+		}
+		err := m.applyPlan(ctx, updater, plan, state.Plan)
+		unlock()
+		if err != nil {
+			return nil, err
+		}
+		return plan, nil
+	}
+	return nil, &hookTypes.Error{Message: fmt.Sprintf("The records of the scope '%s' keep changing, try again later", scope), Code: http.StatusConflict}
+}
+
+// applyPlan applies the changes of the plan, given the names of every record of the scope are locked
+func (m *Bind9Manager) applyPlan(ctx context.Context, updater nsupdate.BatchUpdater, plan *Plan, planID string) error {
+	if planID != "" && planID != plan.ID {
+		return &hookTypes.Error{Message: fmt.Sprintf("The records of the scope '%s' changed since the plan '%s' was made, plan again", plan.Scope, planID), Code: http.StatusConflict}
+	}
+	if len(plan.Changes) == 0 {
+		return nil
+	}
+	if err := m.checkPlan(ctx, plan); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(plan.Changes))
+	for _, c := range plan.Changes {
+		keys = append(keys, m.getRecordFileName(c.Record.Name, c.Record.Type))
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		unlock := m.locks.Lock(key)
+		defer unlock()
+	}
+
+	if err := m.transactBatch(ctx, updater, plan.Changes); err != nil {
+		return err
+	}
+	for _, c := range plan.Changes {
+		// a record added again is not to be removed anymore
+		if c.Type != OperationRemove && m.scheduler.cancel(m.getRecordFileName(c.Record.Name, c.Record.Type)) {
+			logrus.Infof("Cancelling delayed removal of '%s'", c.Record.Name)
+		}
+	}
+	logrus.Infof("Applied %d changes to the scope '%s': %d adds, %d updates and %d removals", len(plan.Changes), plan.Scope, plan.Adds, plan.Updates, plan.Removals)
+	return nil
+}
+
+// desired checks the desired state, returning its scope and records in their canonical form. It fails with a bad request
+// error listing every invalid record, out of the scope or desired more than once
+func (m *Bind9Manager) desired(state DesiredState) (string, []Record, error) {
+	if strings.TrimSpace(state.Scope) == "" {
+		return "", nil, hookTypes.BadRequestError("The scope of the desired records must be set", nil)
+	}
+	scope, err := nsupdate.NormalizeName(state.Scope)
+	if err != nil {
+		return "", nil, hookTypes.BadRequestError(fmt.Sprintf("Invalid scope '%s'", state.Scope), err)
+	}
+
+	var errs []string
+	records := make([]Record, 0, len(state.Records))
+	seen := make(map[string]int)
+	for i, record := range state.Records {
+		record.CreatedAt, record.UpdatedAt = nil, nil
+		if err := normalizeRecord(&record); err != nil {
+			errs = append(errs, recordErrors(i, err)...)
+			continue
+		}
+		for _, e := range record.Check() {
+			errs = append(errs, fmt.Sprintf("records[%d]: %s", i, e))
+		}
+		if !inScope(record.Name, scope) {
+			errs = append(errs, fmt.Sprintf("records[%d]: the name '%s' is out of the scope '%s'", i, record.Name, scope))
+		}
+		key := m.getRecordFileName(record.Name, record.Type)
+		if j, ok := seen[key]; ok {
+			errs = append(errs, fmt.Sprintf("records[%d]: the %s record '%s' is already desired by records[%d]", i, record.Type, record.Name, j))
+		}
+		seen[key] = i
+		records = append(records, record)
+	}
+	if len(errs) > 0 {
+		return "", nil, hookTypes.BadRequestError("Invalid desired records", nil, errs...)
+	}
+	return scope, records, nil
+}
+
+// recordErrors returns the problems of the record at the given position of the desired records
+func recordErrors(i int, err error) (errs []string) {
+	e, ok := err.(*hookTypes.Error)
+	if !ok {
+		return []string{fmt.Sprintf("records[%d]: %v", i, err)}
+	}
+	if len(e.Details) == 0 {
+		return []string{fmt.Sprintf("records[%d]: %s", i, e.Message)}
+	}
+	for _, detail := range e.Details {
+		errs = append(errs, fmt.Sprintf("records[%d]: %s: %s", i, e.Message, detail))
+	}
+	return
+}
+
+// inScope tells whether the name is the scope or a name within it
+func inScope(name, scope string) bool {
+	return name == scope || strings.HasSuffix(name, "."+scope)
+}
+
+// plan computes the changes turning the stored records of the scope into the desired records, given they are valid.
+// The removals come first, then the updates and the adds, so a record can replace the ones of other types of its name
+func (m *Bind9Manager) plan(scope string, desired []Record) *Plan {
+	stored := make(map[string]Record)
+	list, _, _ := m.index.list(RecordFilter{NameSuffix: scope})
+	for _, r := range list {
+		if inScope(r.Name, scope) {
+			stored[m.getRecordFileName(r.Name, r.Type)] = r
+		}
+	}
+
+	plan := &Plan{Scope: scope, Changes: []PlannedChange{}}
+	for _, record := range desired {
+		key := m.getRecordFileName(record.Name, record.Type)
+		previous, ok := stored[key]
+		delete(stored, key)
+		switch {
+		case !ok:
+			plan.Changes = append(plan.Changes, PlannedChange{Type: OperationAdd, Record: record})
+			plan.Adds++
+		case !sameRecord(record, previous):
+			previous := previous
+			plan.Changes = append(plan.Changes, PlannedChange{Type: OperationUpdate, Record: record, Previous: &previous})
+			plan.Updates++
+		default:
+			plan.Unchanged++
+		}
+	}
+	for _, r := range stored {
+		r := r
+		plan.Changes = append(plan.Changes, PlannedChange{Type: OperationRemove, Record: r, Previous: &r})
+		plan.Removals++
+	}
+
+	order := map[string]int{OperationRemove: 0, OperationUpdate: 1, OperationAdd: 2}
+	sort.Slice(plan.Changes, func(i, j int) bool {
+		a, b := plan.Changes[i], plan.Changes[j]
+		if a.Type != b.Type {
+			return order[a.Type] < order[b.Type]
+		}
+		if a.Record.Name != b.Record.Name {
+			return a.Record.Name < b.Record.Name
+		}
+		return a.Record.Type < b.Record.Type
+	})
+	plan.ID = plan.digest()
+	return plan
+}
+
+// sameRecord tells whether the desired record is the same as the stored one: its value, labels and data are the same
+func sameRecord(desired, stored Record) bool {
+	if desired.Value != stored.Value || !reflect.DeepEqual(desired.Data, stored.Data) {
+		return false
+	}
+	if len(desired.Labels) == 0 && len(stored.Labels) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(desired.Labels, stored.Labels)
+}
+
+// digest returns the id of the plan, derived from its scope and changes
+func (plan *Plan) digest() string {
+	type change struct {
+		Type, Name, RecordType, Value string
+		Labels                        map[string]string
+		Data                          *nsupdate.RecordData
+	}
+	changes := make([]change, 0, len(plan.Changes))
+	for _, c := range plan.Changes {
+		changes = append(changes, change{c.Type, c.Record.Name, c.Record.Type, c.Record.Value, c.Record.Labels, c.Record.Data})
+	}
+	b, _ := json.Marshal(struct {
+		Scope   string
+		Changes []change
+	}{plan.Scope, changes})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// names returns the names of the changes of the plan and of the desired records, sorted
+func (plan *Plan) names(desired []Record) []string {
+	set := make(map[string]bool)
+	for _, r := range desired {
+		set[r.Name] = true
+	}
+	for _, c := range plan.Changes {
+		set[c.Record.Name] = true
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// within tells whether every change of the plan is to a record of one of the names
+func (plan *Plan) within(names []string) bool {
+	for _, c := range plan.Changes {
+		i := sort.SearchStrings(names, c.Record.Name)
+		if i == len(names) || names[i] != c.Record.Name {
+			return false
+		}
+	}
+	return true
+}
+
+// lockNames locks every record of the names, in order so two batches never wait for each other; the returned function unlocks them
+func (m *Bind9Manager) lockNames(names []string) (unlock func()) {
+	unlocks := make([]func(), 0, len(names))
+	for _, name := range names {
+		unlocks = append(unlocks, m.locks.Lock(nameLockKey(name)))
+	}
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
+
+// checkPlan checks the records added and updated by the plan do not conflict with the other records of their name, once
+// the plan applied. It returns a conflict error listing every conflict found
+func (m *Bind9Manager) checkPlan(ctx context.Context, plan *Plan) error {
+	batch := make(map[string]*Record, len(plan.Changes))
+	for i, c := range plan.Changes {
+		var record *Record
+		if c.Type != OperationRemove {
+			record = &plan.Changes[i].Record
+		}
+		batch[m.getRecordFileName(c.Record.Name, c.Record.Type)] = record
+	}
+
+	var details []string
+	for _, c := range plan.Changes {
+		if c.Type == OperationRemove {
+			continue
+		}
+		if err := m.checkConflicts(ctx, c.Record, batch); err != nil {
+			e, ok := err.(*hookTypes.Error)
+			if !ok {
+				return err
+			}
+			for _, detail := range e.Details {
+				details = append(details, fmt.Sprintf("%s %s: %s", c.Record.Name, c.Record.Type, detail))
+			}
+		}
+	}
+	if len(details) == 0 {
+		return nil
+	}
+	return &hookTypes.Error{
+		Message: "The planned records conflict with the other records of their name: a CNAME record must be the only record of its name",
+		Code:    http.StatusConflict,
+		Details: details,
+	}
+}
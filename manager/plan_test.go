@@ -0,0 +1,277 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const planBasePath = "./data-plan"
+
+// mockBatchUpdater is a MockDNSUpdater also applying several changes at once
+type mockBatchUpdater struct {
+	MockDNSUpdater
+	batches [][]nsupdate.Change
+	err     error
+}
+
+func (m *mockBatchUpdater) ApplyChanges(_ context.Context, changes []nsupdate.Change, _ time.Duration) error {
+	m.batches = append(m.batches, changes)
+	return m.err
+}
+
+// newPlanManager creates a manager holding records in and out of the test.com scope
+func newPlanManager(t *testing.T, updater nsupdate.DNSUpdater) *Bind9Manager {
+	m, err := (&Builder{RemovalDelay: time.Hour}).New(updater, planBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, r := range []Record{
+		{DNSRecord: hookTypes.DNSRecord{Name: "app.test.com", Value: "0.0.0.1", Type: "A"}},
+		{DNSRecord: hookTypes.DNSRecord{Name: "www.test.com", Value: "app.test.com.", Type: "CNAME"}},
+		{DNSRecord: hookTypes.DNSRecord{Name: "old.test.com", Value: "0.0.0.2", Type: "A"}},
+		{DNSRecord: hookTypes.DNSRecord{Name: "api.test.com", Value: "0.0.0.3", Type: "A"}, Labels: map[string]string{"team": "a"}},
+		{DNSRecord: hookTypes.DNSRecord{Name: "mytest.com", Value: "0.0.0.4", Type: "A"}},
+	} {
+		if err := m.AddRecord(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+// desiredState the desired records of the test.com scope: app unchanged, www and api updated, new added and old removed
+func desiredState() DesiredState {
+	return DesiredState{Scope: "Test.com.", Records: []Record{
+		{DNSRecord: hookTypes.DNSRecord{Name: "app.test.com", Value: "0.0.0.1", Type: "A"}},
+		{DNSRecord: hookTypes.DNSRecord{Name: "WWW.test.com", Value: "web.test.com.", Type: "cname"}},
+		{DNSRecord: hookTypes.DNSRecord{Name: "api.test.com", Value: "0.0.0.3", Type: "A"}, Labels: map[string]string{"team": "b"}},
+		{DNSRecord: hookTypes.DNSRecord{Name: "new.test.com", Value: "0.0.0.5", Type: "A"}},
+	}}
+}
+
+func TestPlanChanges(t *testing.T) {
+	_ = os.RemoveAll(planBasePath)
+	defer os.RemoveAll(planBasePath)
+	m := newPlanManager(t, new(MockDNSUpdater))
+
+	plan, err := m.PlanChanges(context.Background(), desiredState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range plan.Changes {
+		got = append(got, c.Type+" "+c.Record.Name+" "+c.Record.Type+" "+c.Record.Value)
+	}
+	expected := []string{
+		"remove old.test.com A 0.0.0.2",
+		"update api.test.com A 0.0.0.3",
+		"update www.test.com CNAME web.test.com.",
+		"add new.test.com A 0.0.0.5",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expecting the changes %v. Got %v", expected, got)
+	}
+	if plan.Scope != "test.com" || plan.Adds != 1 || plan.Updates != 2 || plan.Removals != 1 || plan.Unchanged != 1 {
+		t.Errorf("Expecting the summary of the plan of test.com. Got %+v", plan)
+	}
+	if previous := plan.Changes[2].Previous; previous == nil || previous.Value != "app.test.com." {
+		t.Errorf("Expecting the update to hold the stored record. Got %v", previous)
+	}
+
+	again, _ := m.PlanChanges(context.Background(), desiredState())
+	if again.ID != plan.ID {
+		t.Errorf("Expecting the same changes to have the same id. Got '%s' and '%s'", plan.ID, again.ID)
+	}
+	if len(m.index.records) != 5 {
+		t.Errorf("Expecting planning to leave the records untouched. Got %d records", len(m.index.records))
+	}
+}
+
+func TestPlanChangesInvalid(t *testing.T) {
+	_ = os.RemoveAll(planBasePath)
+	defer os.RemoveAll(planBasePath)
+	m := newPlanManager(t, new(MockDNSUpdater))
+
+	tests := []struct {
+		name    string
+		state   DesiredState
+		code    int
+		details []string
+	}{
+		{
+			name:  "no scope",
+			state: DesiredState{},
+			code:  http.StatusBadRequest,
+		},
+		{
+			name: "invalid records",
+			state: DesiredState{Scope: "test.com", Records: []Record{
+				{DNSRecord: hookTypes.DNSRecord{Name: "app.test.com", Type: "A"}},
+				{DNSRecord: hookTypes.DNSRecord{Name: "app.other.com", Value: "0.0.0.1", Type: "A"}},
+				{DNSRecord: hookTypes.DNSRecord{Name: "new.test.com", Value: "0.0.0.1", Type: "A"}},
+				{DNSRecord: hookTypes.DNSRecord{Name: "New.test.com", Value: "0.0.0.2", Type: "a"}},
+			}},
+			code: http.StatusBadRequest,
+			details: []string{
+				"records[0]: the value of field 'value' cannot be empty",
+				"records[1]: the name 'app.other.com' is out of the scope 'test.com'",
+				"records[3]: the A record 'new.test.com' is already desired by records[2]",
+			},
+		},
+		{
+			name: "cname along with other records",
+			state: DesiredState{Scope: "test.com", Records: []Record{
+				{DNSRecord: hookTypes.DNSRecord{Name: "app.test.com", Value: "0.0.0.1", Type: "A"}},
+				{DNSRecord: hookTypes.DNSRecord{Name: "app.test.com", Value: "web.test.com.", Type: "CNAME"}},
+			}},
+			code: http.StatusConflict,
+			details: []string{
+				"app.test.com CNAME: app.test.com A 0.0.0.1 (stored)",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := m.PlanChanges(context.Background(), test.state)
+			hookErr, ok := err.(*hookTypes.Error)
+			if !ok || hookErr.Code != test.code {
+				t.Fatalf("Expecting an error with the code %d. Got '%v'", test.code, err)
+			}
+			if test.details != nil && !reflect.DeepEqual(hookErr.Details, test.details) {
+				t.Errorf("Expecting the details %q. Got %q", test.details, hookErr.Details)
+			}
+		})
+	}
+
+	// a CNAME record replacing the records of other types of its name does not conflict
+	_, err := m.PlanChanges(context.Background(), DesiredState{Scope: "app.test.com", Records: []Record{
+		{DNSRecord: hookTypes.DNSRecord{Name: "app.test.com", Value: "web.test.com.", Type: "CNAME"}},
+	}})
+	if err != nil {
+		t.Errorf("Expecting the CNAME record to replace the A record. Got '%v'", err)
+	}
+}
+
+func TestApplyChanges(t *testing.T) {
+	_ = os.RemoveAll(planBasePath)
+	defer os.RemoveAll(planBasePath)
+	updater := new(mockBatchUpdater)
+	m := newPlanManager(t, updater)
+	ctx := context.Background()
+
+	// a plan made before the records change is not applied
+	state := desiredState()
+	plan, _ := m.PlanChanges(ctx, state)
+	_ = m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "late.test.com", Value: "0.0.0.6", Type: "A"})
+	state.Plan = plan.ID
+	if _, err := m.ApplyChanges(ctx, state); err == nil || err.(*hookTypes.Error).Code != http.StatusConflict {
+		t.Errorf("Expecting a stale plan to be refused with a conflict. Got '%v'", err)
+	}
+
+	// the nameserver refusing the changes leaves the records untouched
+	updater.err = errors.New("update failed: REFUSED")
+	state.Plan = ""
+	if _, err := m.ApplyChanges(ctx, state); err == nil {
+		t.Error("Expecting the apply to fail")
+	}
+	if r, _ := m.GetRecord("www.test.com", "CNAME"); r.Value != "app.test.com." {
+		t.Errorf("Expecting the record not to be updated. Got %v", r)
+	}
+	if ids := m.intents.ids(); len(ids) != 0 {
+		t.Errorf("Expecting no intent left behind. Got %v", ids)
+	}
+
+	updater.err = nil
+	updater.batches = nil
+	plan, _ = m.PlanChanges(ctx, state)
+	state.Plan = plan.ID
+	applied, err := m.ApplyChanges(ctx, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updater.batches) != 1 || len(updater.batches[0]) != len(applied.Changes) || len(applied.Changes) != 5 {
+		t.Fatalf("Expecting the 5 changes to be sent at once. Got %v", updater.batches)
+	}
+	if updater.AddCount+updater.UpdateCount+updater.RemovalCount != 6 {
+		t.Errorf("Expecting the changes not to be sent one by one")
+	}
+
+	records, _ := m.GetDNSRecords()
+	var got []string
+	for _, r := range records {
+		got = append(got, r.Name+" "+r.Type+" "+r.Value)
+	}
+	expected := []string{"api.test.com A 0.0.0.3", "app.test.com A 0.0.0.1", "mytest.com A 0.0.0.4", "new.test.com A 0.0.0.5", "www.test.com CNAME web.test.com."}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expecting the records %v. Got %v", expected, got)
+	}
+	if r, _ := m.GetRecord("api.test.com", "A"); r.Labels["team"] != "b" {
+		t.Errorf("Expecting the labels to be updated. Got %v", r.Labels)
+	}
+	if pending := m.PendingRemovals(); len(pending) != 0 {
+		t.Errorf("Expecting the removals to be applied right away. Got %v", pending)
+	}
+
+	// applying the same state again changes nothing
+	again, err := m.ApplyChanges(ctx, DesiredState{Scope: state.Scope, Records: state.Records})
+	if err != nil || len(again.Changes) != 0 || len(updater.batches) != 1 {
+		t.Errorf("Expecting nothing to be applied. Got %v, '%v'", again, err)
+	}
+}
+
+func TestApplyChangesNotSupported(t *testing.T) {
+	_ = os.RemoveAll(planBasePath)
+	defer os.RemoveAll(planBasePath)
+	m := newPlanManager(t, new(MockDNSUpdater))
+
+	_, err := m.ApplyChanges(context.Background(), desiredState())
+	if hookErr, ok := err.(*hookTypes.Error); !ok || hookErr.Code != http.StatusNotImplemented {
+		t.Errorf("Expecting the apply not to be supported. Got '%v'", err)
+	}
+}
+
+func TestRecoverBatchIntent(t *testing.T) {
+	_ = os.RemoveAll(planBasePath)
+	defer os.RemoveAll(planBasePath)
+
+	previous := Record{DNSRecord: hookTypes.DNSRecord{Name: "app.test.com", Value: "0.0.0.1", Type: "A"}}
+	it := intent{ID: "unresolved", Type: operationBatch, CreatedAt: time.Now(), Changes: []PlannedChange{
+		{Type: OperationAdd, Record: Record{DNSRecord: hookTypes.DNSRecord{Name: "new.test.com", Value: "0.0.0.2", Type: "A"}}},
+		{Type: OperationUpdate, Record: Record{DNSRecord: hookTypes.DNSRecord{Name: "app.test.com", Value: "0.0.0.3", Type: "A"}}, Previous: &previous},
+	}}
+	if err := newJournal(planBasePath, intentsDir, intentExtension).put(it.ID, it); err != nil {
+		t.Fatal(err)
+	}
+
+	updater := new(mockBatchUpdater)
+	m, err := (&Builder{TTL: time.Hour, RemovalDelay: time.Hour}).New(updater, planBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updater.batches) != 1 || len(updater.batches[0]) != 2 || updater.batches[0][0].Record.Name != "new.test.com" {
+		t.Fatalf("Expecting the changes of the batch to be replayed at once and in order. Got %v", updater.batches)
+	}
+	if updater.AddCount+updater.UpdateCount != 0 {
+		t.Error("Expecting the changes of the batch not to be replayed one by one")
+	}
+	if r, err := m.GetRecord("app.test.com", "A"); err != nil || r.Value != "0.0.0.3" {
+		t.Errorf("Expecting the replayed update to be stored. Got '%v' and err '%v'", r, err)
+	}
+	if !m.HasDNSRecord("new.test.com", "A") {
+		t.Error("Expecting the replayed addition to be stored")
+	}
+	if ids := m.intents.ids(); len(ids) != 0 {
+		t.Errorf("Expecting the intent to be resolved after the recovery. Got %v", ids)
+	}
+}
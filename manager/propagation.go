@@ -0,0 +1,371 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPropagationInterval = 2 * time.Second
+	// propagationRetention how long the propagation of a change is kept once propagated
+	propagationRetention = time.Hour
+	defaultSecondaryPort = "53"
+
+	propagationDir       = "propagation"
+	propagationExtension = "propagation"
+)
+
+// Propagation describes how far a change to a record has propagated to the secondary nameservers of the zone
+type Propagation struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Change the type of the event of the change, as sent by the change stream
+	Change string `json:"change"`
+	Seq    uint64 `json:"seq"`
+	// Serial the SOA serial of the zone on the primary nameserver once changed; unset until known
+	Serial       *uint32           `json:"serial,omitempty"`
+	Propagated   bool              `json:"propagated"`
+	ChangedAt    time.Time         `json:"changedAt"`
+	PropagatedAt *time.Time        `json:"propagatedAt,omitempty"`
+	Secondaries  []SecondaryStatus `json:"secondaries"`
+}
+
+// SecondaryStatus describes the propagation of a change to a secondary nameserver
+type SecondaryStatus struct {
+	Server string `json:"server"`
+	// Serial the last SOA serial of the zone served by the secondary
+	Serial     *uint32 `json:"serial,omitempty"`
+	Propagated bool    `json:"propagated"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// id returns the id of the change, made of its time and the sequence number of its event, since the sequence numbers
+// start over on every startup
+func (c *Propagation) id() string {
+	return fmt.Sprintf("%019d-%d", c.ChangedAt.UnixNano(), c.Seq)
+}
+
+// propagation tracks the propagation of every change: the serial of the zone on the primary nameserver is read by the poll
+// following the change, then the secondaries are polled until they serve this serial or a later one. The changes are kept in a journal until
+// propagated long ago, so their tracking survives restarts
+type propagation struct {
+	querier     nsupdate.SerialQuerier
+	secondaries []string
+	interval    time.Duration
+	journal     *journal
+	lock        sync.Mutex
+	// changes the tracked changes by id
+	changes map[string]*Propagation
+	// seqs the ids of the changes tracked since the startup, by sequence number of their event
+	seqs map[uint64]string
+	// latest the id of the last change to each record
+	latest map[string]string
+	wake   chan struct{}
+	quit   chan struct{}
+	done   chan struct{}
+}
+
+// newPropagation starts tracking the propagation to the secondaries, given as host or host:port, resuming the tracking of
+// the changes left in the data directory
+func newPropagation(querier nsupdate.SerialQuerier, secondaries []string, interval time.Duration, basePath string) *propagation {
+	if interval <= 0 {
+		interval = defaultPropagationInterval
+	}
+	p := &propagation{
+		querier:  querier,
+		interval: interval,
+		journal:  newJournal(basePath, propagationDir, propagationExtension),
+		changes:  make(map[string]*Propagation),
+		seqs:     make(map[uint64]string),
+		latest:   make(map[string]string),
+		wake:     make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, secondary := range secondaries {
+		if _, _, err := net.SplitHostPort(secondary); err != nil {
+			secondary = net.JoinHostPort(secondary, defaultSecondaryPort)
+		}
+		p.secondaries = append(p.secondaries, secondary)
+	}
+	// the ids sort by time, so the last change to each record is loaded last
+	for _, id := range p.journal.ids() {
+		change := new(Propagation)
+		if err := p.journal.get(id, change); err != nil {
+			logrus.Errorf("Not possible to read the propagation of the change '%s'; dropping it: %v", id, err)
+			_ = p.journal.remove(id)
+			continue
+		}
+		p.changes[id] = change
+		p.latest[recordKey(change.Name, change.Type)] = id
+	}
+	go p.run()
+	p.signal()
+	return p
+}
+
+// serial reads the serial of the zone on the primary nameserver, or returns nil when it cannot be read
+func (p *propagation) serial() *uint32 {
+	ctx, cancel := context.WithTimeout(context.Background(), p.interval)
+	defer cancel()
+	serial, err := p.querier.Serial(ctx, "")
+	if err != nil {
+		logrus.Warnf("Not possible to read the serial of the zone on the primary nameserver: %v", err)
+		return nil
+	}
+	return &serial
+}
+
+// track starts tracking the change published by the event, waking the polling up to read the serial of the zone on the
+// primary nameserver once changed
+func (p *propagation) track(key string, event Event) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	change := &Propagation{Name: event.Record.Name, Type: event.Record.Type, Change: event.Type, Seq: event.Seq, ChangedAt: event.Time}
+	for _, secondary := range p.secondaries {
+		change.Secondaries = append(change.Secondaries, SecondaryStatus{Server: secondary})
+	}
+	id := change.id()
+	p.changes[id] = change
+	p.seqs[change.Seq] = id
+	p.latest[key] = id
+	p.persist(id, change)
+	p.signal()
+}
+
+// signal wakes the polling up
+func (p *propagation) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// persist writes the change to the journal. It expects the lock to be held, so the changes are written in order
+func (p *propagation) persist(id string, change *Propagation) {
+	if err := p.journal.put(id, change); err != nil {
+		logrus.Errorf("Not possible to persist the propagation of the change %d to the record '%s' with type '%s': %v", change.Seq, change.Name, change.Type, err)
+	}
+}
+
+// find returns the id of the change to the record with the sequence number, or of its last change when zero
+func (p *propagation) find(key string, seq uint64) (string, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	id := p.latest[key]
+	if seq != 0 {
+		id = p.seqs[seq]
+	}
+	change, ok := p.changes[id]
+	return id, ok && recordKey(change.Name, change.Type) == key
+}
+
+// get returns a copy of the propagation of the change identified by id
+func (p *propagation) get(id string) (Propagation, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	change, ok := p.changes[id]
+	if !ok {
+		return Propagation{}, false
+	}
+	result := *change
+	result.Secondaries = append([]SecondaryStatus(nil), change.Secondaries...)
+	return result, true
+}
+
+// run polls the nameservers on every interval, or as soon as a change is tracked, until stopped
+func (p *propagation) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.quit:
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+		p.poll()
+	}
+}
+
+// poll reads the serial of the primary for the changes lacking it, then the serials of the secondaries for the changes
+// not propagated yet, and prunes the changes propagated long ago
+func (p *propagation) poll() {
+	unknown, pending := p.pending()
+	if unknown {
+		// the changes made before this read are served with its serial or a later one, not the ones tracked meanwhile
+		read := time.Now()
+		if serial := p.serial(); serial != nil {
+			p.update(func(change *Propagation) bool {
+				if change.Serial != nil || change.ChangedAt.After(read) {
+					return false
+				}
+				change.Serial = serial
+				return true
+			})
+		}
+	}
+	if !pending {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.interval)
+	defer cancel()
+	serials := make(map[string]uint32)
+	errs := make(map[string]error)
+	for _, secondary := range p.secondaries {
+		if serial, err := p.querier.Serial(ctx, secondary); err != nil {
+			errs[secondary] = err
+		} else {
+			serials[secondary] = serial
+		}
+	}
+	now := time.Now()
+	p.update(func(change *Propagation) bool {
+		if change.Serial == nil || change.Propagated {
+			return false
+		}
+		propagated := true
+		for i := range change.Secondaries {
+			status := &change.Secondaries[i]
+			if err, ok := errs[status.Server]; ok {
+				status.Error = err.Error()
+			} else {
+				serial := serials[status.Server]
+				status.Serial, status.Error = &serial, ""
+				status.Propagated = status.Propagated || serialAtLeast(serial, *change.Serial)
+			}
+			propagated = propagated && status.Propagated
+		}
+		if propagated {
+			change.Propagated, change.PropagatedAt = true, &now
+		}
+		return true
+	})
+}
+
+// pending prunes the changes propagated long ago, then tells whether a change lacks the serial of the primary and whether
+// a change is not propagated yet
+func (p *propagation) pending() (unknown, pending bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for id, change := range p.changes {
+		if change.Propagated && time.Since(*change.PropagatedAt) > propagationRetention {
+			p.prune(id, change)
+			continue
+		}
+		unknown = unknown || change.Serial == nil
+		pending = pending || !change.Propagated
+	}
+	return
+}
+
+// prune stops tracking the change. It expects the lock to be held
+func (p *propagation) prune(id string, change *Propagation) {
+	delete(p.changes, id)
+	if p.seqs[change.Seq] == id {
+		delete(p.seqs, change.Seq)
+	}
+	if key := recordKey(change.Name, change.Type); p.latest[key] == id {
+		delete(p.latest, key)
+	}
+	if err := p.journal.remove(id); err != nil {
+		logrus.Errorf("Not possible to erase the propagation of the change %d to the record '%s' with type '%s': %v", change.Seq, change.Name, change.Type, err)
+	}
+}
+
+// update applies the function to every tracked change, persisting the ones it tells were changed
+func (p *propagation) update(f func(change *Propagation) bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for id, change := range p.changes {
+		if f(change) {
+			p.persist(id, change)
+		}
+	}
+}
+
+// stopped tells whether the polling is stopped
+func (p *propagation) stopped() bool {
+	select {
+	case <-p.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// halt stops polling the nameservers, not waiting for the poll in progress to finish
+func (p *propagation) halt() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.stopped() {
+		close(p.quit)
+	}
+}
+
+// stop stops polling the nameservers, waiting for the poll in progress to finish or the context to be done
+func (p *propagation) stop(ctx context.Context) error {
+	p.halt()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// serialAtLeast tells whether the serial is the same as or later than the other one, in the serial number arithmetic of RFC 1982
+func serialAtLeast(serial, other uint32) bool {
+	return serial == other || int32(serial-other) > 0
+}
+
+// trackPropagation tracks the propagation to the secondaries of the change published by the event, when enabled. It is called
+// once the change is made, and does not query the primary, so it does not hold the locks of the change any longer
+func (m *Bind9Manager) trackPropagation(event Event) {
+	if m.propagation != nil {
+		m.propagation.track(m.getRecordFileName(event.Record.Name, event.Record.Type), event)
+	}
+}
+
+// GetPropagation retrieves the propagation to the secondary nameservers of the change to the record identified by the sequence
+// number of its event, or of the last change to the record when zero. When wait is set, it waits for the change to be
+// propagated or the context to be done, returning the propagation as it is then
+func (m *Bind9Manager) GetPropagation(ctx context.Context, name, recordType string, seq uint64, wait bool) (*Propagation, error) {
+	if m.propagation == nil {
+		return nil, hookTypes.NotFoundError("The propagation tracking is not enabled", nil)
+	}
+	id, ok := m.propagation.find(m.getRecordFileName(name, recordType), seq)
+	change, found := m.propagation.get(id)
+	if !ok || !found {
+		if seq != 0 {
+			return nil, hookTypes.NotFoundError(fmt.Sprintf("No change %d tracked for the record with name '%s' and type '%s'", seq, name, recordType), nil)
+		}
+		return nil, hookTypes.NotFoundError(fmt.Sprintf("No change tracked for the record with name '%s' and type '%s'", name, recordType), nil)
+	}
+	if wait {
+		// the change waited for stays the same even when the record changes again in the meantime
+		_ = waitUntil(ctx, func() bool {
+			if latest, ok := m.propagation.get(id); ok {
+				change = latest
+			}
+			return change.Propagated || m.propagation.stopped()
+		})
+	}
+	return &change, nil
+}
+
+// StopPropagation stops tracking the propagation of the changes, releasing the requests waiting for a change to be propagated
+func (m *Bind9Manager) StopPropagation() {
+	if m.propagation != nil {
+		m.propagation.halt()
+	}
+}
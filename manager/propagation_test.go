@@ -0,0 +1,177 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const propagationBasePath = "./data-propagation"
+
+// mockSerials is a MockDNSUpdater serving the serials of the zone by address, the primary being the empty one
+type mockSerials struct {
+	MockDNSUpdater
+	lock    sync.Mutex
+	serials map[string]uint32
+}
+
+func (m *mockSerials) set(address string, serial uint32) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.serials[address] = serial
+}
+
+func (m *mockSerials) Serial(_ context.Context, address string) (uint32, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	serial, ok := m.serials[address]
+	if !ok {
+		return 0, errors.New("connection refused")
+	}
+	return serial, nil
+}
+
+func TestPropagation(t *testing.T) {
+	_ = os.RemoveAll(propagationBasePath)
+	defer os.RemoveAll(propagationBasePath)
+	updater := &mockSerials{serials: map[string]uint32{"": 10, "ns2.test.com:53": 9}}
+	builder := &Builder{Secondaries: []string{"ns2.test.com", "ns3.test.com:5353"}, PropagationInterval: 10 * time.Millisecond}
+	m, err := builder.New(updater, propagationBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.propagation.stop(context.Background())
+
+	ctx := context.Background()
+	if _, err := m.GetPropagation(ctx, "app.test.com", "A", 0, false); err == nil {
+		t.Error("Expecting no propagation for a record never changed")
+	}
+	_ = m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "app.test.com", Value: "0.0.0.1", Type: "A"})
+
+	waitFor(func() bool {
+		p, _ := m.GetPropagation(ctx, "app.test.com", "A", 0, false)
+		return p.Secondaries[1].Error != ""
+	})
+	p, err := m.GetPropagation(ctx, "App.test.com", "a", 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Propagated || p.Serial == nil || *p.Serial != 10 || p.Change != EventAdd {
+		t.Errorf("Expecting the change with the serial of the primary not to be propagated yet. Got %+v", p)
+	}
+	if s := p.Secondaries[0]; s.Server != "ns2.test.com:53" || s.Propagated || s.Serial == nil || *s.Serial != 9 {
+		t.Errorf("Expecting the secondary behind not to have the change. Got %+v", s)
+	}
+	if s := p.Secondaries[1]; s.Server != "ns3.test.com:5353" || s.Propagated || s.Error != "connection refused" {
+		t.Errorf("Expecting the secondary not answering to report the error. Got %+v", s)
+	}
+
+	updater.set("ns2.test.com:53", 10)
+	updater.set("ns3.test.com:5353", 11)
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	p, err = m.GetPropagation(waitCtx, "app.test.com", "A", 0, true)
+	if err != nil || !p.Propagated || p.PropagatedAt == nil {
+		t.Errorf("Expecting to wait for the change to be propagated. Got %+v, err '%v'", p, err)
+	}
+}
+
+func TestPropagationOfEveryChange(t *testing.T) {
+	_ = os.RemoveAll(propagationBasePath)
+	defer os.RemoveAll(propagationBasePath)
+	updater := &mockSerials{serials: map[string]uint32{"": 10, "ns2.test.com:53": 9}}
+	builder := &Builder{Secondaries: []string{"ns2.test.com"}, PropagationInterval: 10 * time.Millisecond}
+	m, err := builder.New(updater, propagationBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	// the serial of the primary is read by the poll following the change
+	tracked := func() *Propagation {
+		var p *Propagation
+		waitFor(func() bool {
+			p, _ = m.GetPropagation(ctx, "app.test.com", "A", 0, false)
+			return p != nil && p.Serial != nil
+		})
+		return p
+	}
+	_ = m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "app.test.com", Value: "0.0.0.1", Type: "A"})
+	first := tracked()
+	updater.set("", 11)
+	_ = m.UpdateDNSRecord(ctx, hookTypes.DNSRecord{Name: "app.test.com", Value: "0.0.0.2", Type: "A"})
+	last := tracked()
+	if first == nil || first.Serial == nil || *first.Serial != 10 || last == nil || last.Serial == nil || *last.Serial != 11 || last.Seq == first.Seq {
+		t.Fatalf("Expecting each change to have the serial of the primary once changed. Got %+v and %+v", first, last)
+	}
+
+	updater.set("ns2.test.com:53", 10)
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	p, err := m.GetPropagation(waitCtx, "app.test.com", "A", first.Seq, true)
+	if err != nil || !p.Propagated || p.Seq != first.Seq {
+		t.Errorf("Expecting to wait for the first change to be propagated. Got %+v, err '%v'", p, err)
+	}
+	if p, _ := m.GetPropagation(ctx, "app.test.com", "A", 0, false); p.Propagated || p.Seq != last.Seq {
+		t.Errorf("Expecting the last change not to be propagated yet. Got %+v", p)
+	}
+	if _, err := m.GetPropagation(ctx, "other.test.com", "A", first.Seq, false); err == nil {
+		t.Error("Expecting no propagation for the change of another record")
+	}
+
+	// the tracking is resumed on restart
+	_ = m.propagation.stop(ctx)
+	m, err = builder.New(updater, propagationBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.propagation.stop(ctx)
+	p, err = m.GetPropagation(ctx, "app.test.com", "A", 0, false)
+	if err != nil || p.Propagated || p.Serial == nil || *p.Serial != 11 {
+		t.Fatalf("Expecting the tracking of the last change to survive a restart. Got %+v, err '%v'", p, err)
+	}
+	updater.set("ns2.test.com:53", 11)
+	waitCtx, cancel = context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if p, err := m.GetPropagation(waitCtx, "app.test.com", "A", 0, true); err != nil || !p.Propagated {
+		t.Errorf("Expecting the resumed change to be propagated. Got %+v, err '%v'", p, err)
+	}
+}
+
+func TestPropagationNotEnabled(t *testing.T) {
+	m, _, _ := initManagerWithNRecords(0, t)
+	_, err := m.GetPropagation(context.Background(), "app.test.com", "A", 0, false)
+	if hookErr, ok := err.(*hookTypes.Error); !ok || hookErr.Code != http.StatusNotFound {
+		t.Errorf("Expecting a not found error when the tracking is not enabled. Got '%v'", err)
+	}
+	if _, err := (&Builder{Secondaries: []string{"ns2.test.com"}}).New(new(MockDNSUpdater), propagationBasePath); err == nil {
+		t.Error("Expecting the tracking to require a DNSUpdater able to query the serial of the zone")
+	}
+	_ = os.RemoveAll(propagationBasePath)
+}
+
+func TestSerialAtLeast(t *testing.T) {
+	tests := []struct {
+		serial   uint32
+		other    uint32
+		expected bool
+	}{
+		{10, 10, true},
+		{11, 10, true},
+		{9, 10, false},
+		{1, 4294967295, true},
+		{4294967295, 1, false},
+	}
+
+	for _, test := range tests {
+		if got := serialAtLeast(test.serial, test.other); got != test.expected {
+			t.Errorf("serialAtLeast(%d, %d) = %v, want %v", test.serial, test.other, got, test.expected)
+		}
+	}
+}
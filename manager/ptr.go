@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"context"
+	"strings"
+
+	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var ptrFailures = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "bindman_ptr_sync_failures_total",
+	Help: "How many PTR records could not be added, updated or removed along with their A or AAAA record.",
+})
+
+func init() {
+	prometheus.MustRegister(ptrFailures)
+}
+
+// hasPTR tells whether the record is an address record whose PTR is maintained in the reverse zone
+func hasPTR(record *hookTypes.DNSRecord) bool {
+	if record == nil {
+		return false
+	}
+	recordType := strings.ToUpper(record.Type)
+	return recordType == "A" || recordType == "AAAA"
+}
+
+// syncPTR brings the PTR record in the reverse zone in line with the change committed: the PTR of the previous address is removed
+// when the address changes or the record is removed, and the PTR of the current address is pointed at the record name.
+// The forward record is already committed, so failures are only logged; the PTR is synced again on the next change to the record
+func (m *Bind9Manager) syncPTR(it *intent) {
+	if m.ReverseUpdater == nil || !hasPTR(&it.Record.DNSRecord) {
+		return
+	}
+	ctx := context.Background()
+
+	if it.Type == OperationRemove {
+		m.removePTR(ctx, it.Record.DNSRecord)
+		return
+	}
+	if it.Previous != nil && it.Previous.Value != it.Record.Value {
+		m.removePTR(ctx, it.Previous.DNSRecord)
+	}
+	name, ok := m.ptrName(it.Record.DNSRecord)
+	if !ok {
+		return
+	}
+	ptr := hookTypes.DNSRecord{Name: name, Value: strings.TrimSuffix(it.Record.Name, ".") + ".", Type: "PTR"}
+	if err := m.ReverseUpdater.UpdateRR(ctx, ptr, m.TTL); err != nil {
+		ptrFailures.Inc()
+		logrus.Errorf("Not possible to point the PTR record '%s' at '%s': %v", ptr.Name, ptr.Value, err)
+	}
+}
+
+// removePTR removes the PTR record of the address of the record
+func (m *Bind9Manager) removePTR(ctx context.Context, record hookTypes.DNSRecord) {
+	name, ok := m.ptrName(record)
+	if !ok {
+		return
+	}
+	if err := m.ReverseUpdater.RemoveRR(ctx, name, "PTR"); err != nil {
+		ptrFailures.Inc()
+		logrus.Errorf("Not possible to remove the PTR record '%s' of '%s': %v", name, record.Name, err)
+	}
+}
+
+// ptrName returns the name of the PTR record of the address of the record, if it belongs to the reverse zone
+func (m *Bind9Manager) ptrName(record hookTypes.DNSRecord) (string, bool) {
+	name, err := nsupdate.ReverseName(record.Value)
+	if err != nil {
+		logrus.Warnf("No PTR record for '%s' with type '%s': %v", record.Name, record.Type, err)
+		return "", false
+	}
+	if !m.ReverseUpdater.InZone(name) {
+		logrus.Infof("No PTR record for '%s': '%s' does not belong to the reverse zone", record.Name, name)
+		return "", false
+	}
+	return name, true
+}
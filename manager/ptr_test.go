@@ -0,0 +1,115 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const ptrBasePath = "./data-ptr"
+
+// mockReverseUpdater records the commands sent to the reverse zone 0.10.in-addr.arpa
+type mockReverseUpdater struct {
+	lock     sync.Mutex
+	commands []string
+}
+
+func (m *mockReverseUpdater) record(command string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.commands = append(m.commands, command)
+	return nil
+}
+
+func (m *mockReverseUpdater) sent() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]string(nil), m.commands...)
+}
+
+func (m *mockReverseUpdater) RemoveRR(_ context.Context, name, recordType string) error {
+	return m.record(fmt.Sprintf("remove %s %s", name, recordType))
+}
+
+func (m *mockReverseUpdater) AddRR(_ context.Context, record hookTypes.DNSRecord, _ time.Duration) error {
+	return m.record(fmt.Sprintf("add %s %s %s", record.Name, record.Type, record.Value))
+}
+
+func (m *mockReverseUpdater) UpdateRR(_ context.Context, record hookTypes.DNSRecord, _ time.Duration) error {
+	return m.record(fmt.Sprintf("update %s %s %s", record.Name, record.Type, record.Value))
+}
+
+func (m *mockReverseUpdater) InZone(name string) bool {
+	return strings.HasSuffix(name, ".0.10.in-addr.arpa")
+}
+
+func TestPTRRecords(t *testing.T) {
+	_ = os.RemoveAll(ptrBasePath)
+	defer os.RemoveAll(ptrBasePath)
+	reverse := new(mockReverseUpdater)
+	m, err := (&Builder{RemovalDelay: 10 * time.Millisecond, ReverseUpdater: reverse}).New(new(MockDNSUpdater), ptrBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	_ = m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "app.test.com", Value: "10.0.1.2", Type: "A"})
+	_ = m.UpdateDNSRecord(ctx, hookTypes.DNSRecord{Name: "app.test.com", Value: "10.0.1.3", Type: "A"})
+	// out of the reverse zone, and not an address record
+	_ = m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "other.test.com", Value: "10.1.0.1", Type: "A"})
+	_ = m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "alias.test.com", Value: "app.test.com", Type: "CNAME"})
+	_ = m.RemoveDNSRecord(ctx, "app.test.com", "A")
+
+	expected := []string{
+		"update 2.1.0.10.in-addr.arpa PTR app.test.com.",
+		"remove 2.1.0.10.in-addr.arpa PTR",
+		"update 3.1.0.10.in-addr.arpa PTR app.test.com.",
+	}
+	if sent := reverse.sent(); !reflect.DeepEqual(sent, expected) {
+		t.Errorf("Expecting the PTR to follow the address, and be kept until the removal is executed. Got %v", sent)
+	}
+
+	expected = append(expected, "remove 3.1.0.10.in-addr.arpa PTR")
+	waitFor(func() bool { return len(reverse.sent()) == len(expected) })
+	if sent := reverse.sent(); !reflect.DeepEqual(sent, expected) {
+		t.Errorf("Expecting the PTR to be removed along with the record. Got %v", sent)
+	}
+}
+
+func TestPTRRemovedAfterRestart(t *testing.T) {
+	_ = os.RemoveAll(ptrBasePath)
+	defer os.RemoveAll(ptrBasePath)
+	reverse := new(mockReverseUpdater)
+	b := &Builder{RemovalDelay: 500 * time.Millisecond, PendingRemovalsOnShutdown: ShutdownPersist, ReverseUpdater: reverse}
+	m, err := b.New(new(MockDNSUpdater), ptrBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	_ = m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "app.test.com", Value: "10.0.1.2", Type: "A"})
+	_ = m.RemoveDNSRecord(ctx, "app.test.com", "A")
+	if err := m.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = b.New(new(MockDNSUpdater), ptrBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := m.PendingRemovals(); len(pending) != 1 || pending[0].Value != "10.0.1.2" {
+		t.Fatalf("Expecting the persisted removal to keep the value of the record. Got %v", pending)
+	}
+	expected := []string{"update 2.1.0.10.in-addr.arpa PTR app.test.com.", "remove 2.1.0.10.in-addr.arpa PTR"}
+	waitFor(func() bool { return len(reverse.sent()) == len(expected) })
+	if sent := reverse.sent(); !reflect.DeepEqual(sent, expected) {
+		t.Errorf("Expecting the PTR to be removed along with the record after a restart. Got %v", sent)
+	}
+}
@@ -0,0 +1,285 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// OperationAdd identifies the addition of a record
+	OperationAdd = "add"
+	// OperationUpdate identifies the update of a record
+	OperationUpdate = "update"
+	// OperationRemove identifies the removal of a record
+	OperationRemove = "remove"
+
+	// StatusPending the operation is waiting to be applied
+	StatusPending = "pending"
+	// StatusApplied the operation has been successfully applied
+	StatusApplied = "applied"
+	// StatusFailed the operation has been applied with an error
+	StatusFailed = "failed"
+
+	queueDir       = "queue"
+	queueExtension = "op"
+)
+
+// Operation describes a mutation submitted to the asynchronous write queue and its current status
+type Operation struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Record Record `json:"record"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Details the details of the error, such as the conflicting records or the records served instead of the expected ones
+	Details []string `json:"details,omitempty"`
+	// Verification the outcome of the verification of the change, when verified: VerificationVerified, VerificationFailed or VerificationUnknown
+	Verification string    `json:"verification,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// Queue is a bounded and persistent queue of mutations drained by a pool of workers.
+// Operations on the same record are always handled by the same worker, so they are applied in submission order
+type Queue struct {
+	manager *Bind9Manager
+	journal *journal
+	workers []chan string
+	// recovered the operations left pending by a previous execution, by worker, applied before the ones submitted since
+	recovered  [][]string
+	retention  time.Duration
+	lock       sync.Mutex
+	operations map[string]*Operation
+	wg         sync.WaitGroup
+	quit       chan struct{}
+	stopped    bool
+}
+
+// newQueue creates the queue of the manager and starts its workers, resuming any operation left pending in the data directory
+func newQueue(m *Bind9Manager, basePath string) (*Queue, error) {
+	workers := m.QueueWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	capacity := m.QueueSize / workers
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	q := &Queue{
+		manager:    m,
+		journal:    newJournal(basePath, queueDir, queueExtension),
+		workers:    make([]chan string, workers),
+		recovered:  make([][]string, workers),
+		retention:  m.OperationRetention,
+		operations: make(map[string]*Operation),
+		quit:       make(chan struct{}),
+	}
+
+	var pending []*Operation
+	for _, id := range q.journal.ids() {
+		op := new(Operation)
+		if err := q.journal.get(id, op); err != nil {
+			return nil, fmt.Errorf("not possible to load the queued operation '%s': %v", id, err)
+		}
+		q.operations[op.ID] = op
+		if op.Status == StatusPending {
+			pending = append(pending, op)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].CreatedAt.Before(pending[j].CreatedAt) })
+
+	for i := range q.workers {
+		q.workers[i] = make(chan string, capacity)
+	}
+	for _, op := range pending {
+		i := q.worker(op.Record)
+		q.recovered[i] = append(q.recovered[i], op.ID)
+	}
+	if len(pending) > 0 {
+		logrus.Infof("Resuming %d pending operations", len(pending))
+	}
+
+	if m.coalescer != nil {
+		// the worker does not wait for the net change to be applied, so the number of updates sent at once is bounded there
+		m.coalescer.limit(workers)
+	}
+	for i := range q.workers {
+		q.wg.Add(1)
+		go q.work(i)
+	}
+	return q, nil
+}
+
+// Submit persists a new operation and puts it on the queue; it fails when the queue is full, the record name is not valid
+// or its records are owned by the file source
+func (q *Queue) Submit(operationType string, record Record) (*Operation, error) {
+	if err := normalizeRecord(&record); err != nil {
+		return nil, err
+	}
+	if err := q.manager.checkOwner(record.Name); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	op := &Operation{
+		ID:        uuid.New().String(),
+		Type:      operationType,
+		Record:    record,
+		Status:    StatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.stopped {
+		return nil, &hookTypes.Error{Message: "The write queue is shutting down", Code: http.StatusServiceUnavailable}
+	}
+	i := q.worker(record)
+	ch := q.workers[i]
+	// the recovered operations not applied yet count against the capacity
+	if len(ch)+len(q.recovered[i]) >= cap(ch) {
+		return nil, &hookTypes.Error{Message: "The write queue is full, try again later", Code: http.StatusServiceUnavailable}
+	}
+	if err := q.journal.put(op.ID, op); err != nil {
+		return nil, hookTypes.InternalServerError("Not possible to persist the operation", err)
+	}
+	q.operations[op.ID] = op
+	ch <- op.ID
+
+	result := *op
+	return &result, nil
+}
+
+// GetOperation retrieves the current state of the operation identified by id
+func (q *Queue) GetOperation(id string) (*Operation, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	op, ok := q.operations[id]
+	if !ok {
+		return nil, hookTypes.NotFoundError(fmt.Sprintf("No operation found with id '%s'", id), nil)
+	}
+	result := *op
+	return &result, nil
+}
+
+// worker returns the index of the worker responsible for the record
+func (q *Queue) worker(record Record) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(recordKey(record.Name, record.Type)))
+	return int(h.Sum32() % uint32(len(q.workers)))
+}
+
+// stop stops accepting operations and waits for the workers to finish the operation they are applying or the context to be done.
+// The operations not started yet are kept pending in the data directory, to be resumed on the next startup
+func (q *Queue) stop(ctx context.Context) error {
+	q.lock.Lock()
+	if !q.stopped {
+		q.stopped = true
+		close(q.quit)
+	}
+	q.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("the write queue workers did not finish in time: %w", ctx.Err())
+	}
+}
+
+// work applies the operations recovered for the worker, then the ones sent to its channel, until the queue is stopped
+func (q *Queue) work(i int) {
+	defer q.wg.Done()
+	for {
+		// checked first, since select picks randomly among the ready cases
+		select {
+		case <-q.quit:
+			return
+		default:
+		}
+
+		id, ok := q.nextRecovered(i)
+		if !ok {
+			select {
+			case <-q.quit:
+				return
+			case id = <-q.workers[i]:
+			}
+		}
+
+		q.lock.Lock()
+		op := *q.operations[id]
+		q.lock.Unlock()
+
+		c := change{Type: op.Type, Record: op.Record}
+		if q.manager.coalescer != nil {
+			// the worker does not wait for the coalescing window, so the next changes to the record can be merged
+			id := id
+			q.manager.coalescer.submit(c, func(outcome string, err error) { q.finish(id, outcome, err) })
+			continue
+		}
+		ctx, verification := WithVerification(context.Background())
+		err := q.manager.apply(ctx, c)
+		q.finish(id, verification(), err)
+	}
+}
+
+// nextRecovered takes the next operation recovered for the worker, if any is left
+func (q *Queue) nextRecovered(i int) (string, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.recovered[i]) == 0 {
+		return "", false
+	}
+	id := q.recovered[i][0]
+	q.recovered[i] = q.recovered[i][1:]
+	return id, true
+}
+
+// finish records the outcome of an operation, and of its verification, and prunes the finished operations older than the retention period
+func (q *Queue) finish(id, verification string, err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	now := time.Now()
+	op := q.operations[id]
+	op.UpdatedAt = now
+	op.Status = StatusApplied
+	op.Verification = verification
+	if err != nil {
+		op.Status = StatusFailed
+		op.Error = err.Error()
+		if e, ok := err.(*hookTypes.Error); ok {
+			op.Error = e.Message
+			op.Details = e.Details
+		}
+		logrus.Errorf("Operation '%s' failed to %s the record '%s' with type '%s': %v", op.ID, op.Type, op.Record.Name, op.Record.Type, err)
+	}
+	if err := q.journal.put(op.ID, op); err != nil {
+		logrus.Errorf("Not possible to persist the status of operation '%s': %v", op.ID, err)
+	}
+
+	for id, op := range q.operations {
+		if op.Status != StatusPending && now.Sub(op.UpdatedAt) > q.retention {
+			delete(q.operations, id)
+			_ = q.journal.remove(id)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const queueBasePath = "./data-queue"
+
+func TestQueueAppliesOperations(t *testing.T) {
+	m, _ := initAsyncManager(t, new(MockDNSUpdater), 10, 2)
+	defer os.RemoveAll(queueBasePath)
+	record := hookTypes.DNSRecord{Name: "queued.test.com", Value: "0.0.0.0", Type: "A"}
+
+	op, err := m.Queue.Submit(OperationAdd, Record{DNSRecord: record})
+	if err != nil {
+		t.Fatalf("Expecting the submission to succeed. Got err '%v'", err)
+	}
+	if op.Status != StatusPending {
+		t.Errorf("Expecting a submitted operation to be pending. Got '%v'", op.Status)
+	}
+
+	op = waitOperation(t, m.Queue, op.ID)
+	if op.Status != StatusApplied {
+		t.Fatalf("Expecting the operation to be applied. Got '%v' with error '%v'", op.Status, op.Error)
+	}
+	if r, err := m.GetDNSRecord(record.Name, record.Type); err != nil || *r != record {
+		t.Errorf("Expecting the queued record to be saved. Got '%v' and err '%v'", r, err)
+	}
+}
+
+func TestQueueFailedOperation(t *testing.T) {
+	m, _ := initAsyncManager(t, &MockDNSUpdater{Error: errors.New("update failed: REFUSED")}, 10, 1)
+	defer os.RemoveAll(queueBasePath)
+
+	op, err := m.Queue.Submit(OperationAdd, Record{DNSRecord: hookTypes.DNSRecord{Name: "refused.test.com", Value: "0.0.0.0", Type: "A"}})
+	if err != nil {
+		t.Fatalf("Expecting the submission to succeed. Got err '%v'", err)
+	}
+
+	op = waitOperation(t, m.Queue, op.ID)
+	if op.Status != StatusFailed || op.Error != "update failed: REFUSED" {
+		t.Errorf("Expecting the operation to fail with the updater error. Got status '%v' and error '%v'", op.Status, op.Error)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	updater := &MockDNSUpdater{Gate: make(chan struct{})}
+	m, _ := initAsyncManager(t, updater, 2, 1)
+	defer os.RemoveAll(queueBasePath)
+	// the worker is stopped before the data directory is removed
+	defer m.Queue.stop(context.Background())
+	defer close(updater.Gate)
+
+	var err error
+	accepted := 0
+	for ; accepted < 10 && err == nil; accepted++ {
+		_, err = m.Queue.Submit(OperationAdd, Record{DNSRecord: hookTypes.DNSRecord{Name: "full.test.com", Value: "0.0.0.0", Type: "A"}})
+	}
+	e, ok := err.(*hookTypes.Error)
+	if !ok || e.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expecting a service unavailable error once the queue is full. Got '%v'", err)
+	}
+	if accepted > 4 {
+		t.Errorf("Expecting the queue to accept at most 3 operations. Accepted %d", accepted-1)
+	}
+}
+
+func TestQueueResumesPendingOperations(t *testing.T) {
+	_ = os.RemoveAll(queueBasePath)
+	defer os.RemoveAll(queueBasePath)
+
+	op := Operation{
+		ID:        "resumed",
+		Type:      OperationAdd,
+		Record:    Record{DNSRecord: hookTypes.DNSRecord{Name: "resumed.test.com", Value: "0.0.0.0", Type: "A"}},
+		Status:    StatusPending,
+		CreatedAt: time.Now(),
+	}
+	if err := newJournal(queueBasePath, queueDir, queueExtension).put(op.ID, op); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := (&Builder{Async: true, QueueSize: 10, QueueWorkers: 1, OperationRetention: time.Hour}).New(new(MockDNSUpdater), queueBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := waitOperation(t, m.Queue, op.ID); got.Status != StatusApplied {
+		t.Errorf("Expecting the pending operation to be applied after a restart. Got '%v'", got.Status)
+	}
+}
+
+func TestQueueResumedOperationsWithinCapacity(t *testing.T) {
+	_ = os.RemoveAll(queueBasePath)
+	defer os.RemoveAll(queueBasePath)
+
+	journal := newJournal(queueBasePath, queueDir, queueExtension)
+	now := time.Now()
+	var ids []string
+	for i := 0; i < 3; i++ {
+		op := Operation{
+			ID:        fmt.Sprintf("resumed%d", i),
+			Type:      OperationAdd,
+			Record:    Record{DNSRecord: hookTypes.DNSRecord{Name: fmt.Sprintf("resumed%d.test.com", i), Value: "0.0.0.0", Type: "A"}},
+			Status:    StatusPending,
+			CreatedAt: now.Add(time.Duration(i) * time.Millisecond),
+		}
+		if err := journal.put(op.ID, op); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, op.ID)
+	}
+
+	updater := &MockDNSUpdater{Gate: make(chan struct{})}
+	m, err := (&Builder{Async: true, QueueSize: 2, QueueWorkers: 1, OperationRetention: time.Hour}).New(updater, queueBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Queue.stop(context.Background())
+
+	_, err = m.Queue.Submit(OperationAdd, Record{DNSRecord: hookTypes.DNSRecord{Name: "new.test.com", Value: "0.0.0.0", Type: "A"}})
+	if e, ok := err.(*hookTypes.Error); !ok || e.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expecting the resumed operations to count against the capacity of the queue. Got '%v'", err)
+	}
+	close(updater.Gate)
+	for _, id := range ids {
+		if got := waitOperation(t, m.Queue, id); got.Status != StatusApplied {
+			t.Errorf("Expecting the resumed operation '%s' to be applied. Got '%v'", id, got.Status)
+		}
+	}
+}
+
+func TestQueueBoundsCoalescedUpdates(t *testing.T) {
+	_ = os.RemoveAll(queueBasePath)
+	defer os.RemoveAll(queueBasePath)
+	updater := &MockDNSUpdater{Gate: make(chan struct{})}
+	m, err := (&Builder{TTL: time.Hour, RemovalDelay: time.Hour, Async: true, QueueSize: 10, QueueWorkers: 1, OperationRetention: time.Hour, CoalesceWindow: 10 * time.Millisecond}).New(updater, queueBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Queue.stop(context.Background())
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		op, err := m.Queue.Submit(OperationAdd, Record{DNSRecord: hookTypes.DNSRecord{Name: fmt.Sprintf("bounded%d.test.com", i), Value: "0.0.0.0", Type: "A"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, op.ID)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if adds := atomic.LoadUint64(&updater.AddCount); adds != 1 {
+		t.Errorf("Expecting a single worker to send a single update at once. Got %d", adds)
+	}
+	close(updater.Gate)
+	for _, id := range ids {
+		if got := waitOperation(t, m.Queue, id); got.Status != StatusApplied {
+			t.Errorf("Expecting the operation '%s' to be applied. Got '%v'", id, got.Status)
+		}
+	}
+}
+
+func TestGetUnknownOperation(t *testing.T) {
+	m, _ := initAsyncManager(t, new(MockDNSUpdater), 10, 1)
+	defer os.RemoveAll(queueBasePath)
+
+	if _, err := m.Queue.GetOperation("unknown"); err == nil {
+		t.Error("Expecting an error when getting an unknown operation")
+	}
+}
+
+func initAsyncManager(t *testing.T, updater *MockDNSUpdater, size, workers int) (*Bind9Manager, *MockDNSUpdater) {
+	_ = os.RemoveAll(queueBasePath)
+
+	m, err := (&Builder{TTL: time.Hour, RemovalDelay: time.Hour, Async: true, QueueSize: size, QueueWorkers: workers, OperationRetention: time.Hour}).New(updater, queueBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, updater
+}
+
+func waitOperation(t *testing.T, q *Queue, id string) *Operation {
+	for i := 0; i < 100; i++ {
+		op, err := q.GetOperation(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op.Status != StatusPending {
+			return op
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for operation '%s' to finish", id)
+	return nil
+}
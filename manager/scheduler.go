@@ -0,0 +1,261 @@
+package manager
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Removal describes a removal of a record from the nameserver waiting for its removal delay to be over
+type Removal struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Value the value of the record when its removal was scheduled
+	Value string    `json:"value,omitempty"`
+	Due   time.Time `json:"due"`
+	key   string
+	// index the position of the removal in the heap
+	index int
+}
+
+// removalHeap orders the pending removals by due time
+type removalHeap []*Removal
+
+func (h removalHeap) Len() int           { return len(h) }
+func (h removalHeap) Less(i, j int) bool { return h[i].Due.Before(h[j].Due) }
+func (h removalHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *removalHeap) Push(x interface{}) {
+	r := x.(*Removal)
+	r.index = len(*h)
+	*h = append(*h, r)
+}
+
+func (h *removalHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	r := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	r.index = -1
+	return r
+}
+
+// scheduler owns every pending removal. A single goroutine waits for the next one to be due,
+// and at most a fixed number of removals are executed at the same time
+type scheduler struct {
+	lock    sync.Mutex
+	pending removalHeap
+	byKey   map[string]*Removal
+	running int
+	wake    chan struct{}
+	slots   chan struct{}
+	quit    chan struct{}
+	stopped bool
+	remove  func(name, recordType, value string)
+}
+
+// newScheduler creates a scheduler executing at most concurrency removals at the same time with the remove function, and starts it
+func newScheduler(concurrency int, remove func(name, recordType, value string)) *scheduler {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	s := &scheduler{
+		byKey:  make(map[string]*Removal),
+		wake:   make(chan struct{}, 1),
+		slots:  make(chan struct{}, concurrency),
+		quit:   make(chan struct{}),
+		remove: remove,
+	}
+	go s.run()
+	return s
+}
+
+// schedule registers the removal of the record identified by key to be executed at due; a removal already pending for the record is rescheduled
+func (s *scheduler) schedule(key, name, recordType, value string, due time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if r, ok := s.byKey[key]; ok {
+		r.Due = due
+		r.Value = value
+		heap.Fix(&s.pending, r.index)
+	} else {
+		r = &Removal{Name: name, Type: recordType, Value: value, Due: due, key: key}
+		heap.Push(&s.pending, r)
+		s.byKey[key] = r
+	}
+	s.notify()
+}
+
+// cancel drops the pending removal of the record identified by key, if any
+func (s *scheduler) cancel(key string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r, ok := s.byKey[key]
+	if ok {
+		heap.Remove(&s.pending, r.index)
+		delete(s.byKey, key)
+		s.notify()
+	}
+	return ok
+}
+
+// Pending returns a snapshot of the pending removals, sorted by due time
+func (s *scheduler) Pending() []Removal {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result := make([]Removal, 0, len(s.pending))
+	for _, r := range s.pending {
+		result = append(result, Removal{Name: r.Name, Type: r.Type, Value: r.Value, Due: r.Due})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Due.Before(result[j].Due) })
+	return result
+}
+
+// expedite makes every pending removal due right away
+func (s *scheduler) expedite() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	for _, r := range s.pending {
+		r.Due = now
+	}
+	heap.Init(&s.pending)
+	s.notify()
+}
+
+// wait waits for every removal to be executed or the context to be done
+func (s *scheduler) wait(ctx context.Context) error {
+	return waitUntil(ctx, func() bool {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return len(s.pending) == 0 && s.running == 0
+	})
+}
+
+// stop stops the scheduler and waits for the running removals to finish or the context to be done.
+// The removals still pending are dropped from the scheduler and returned
+func (s *scheduler) stop(ctx context.Context) ([]Removal, error) {
+	s.lock.Lock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.quit)
+	}
+	s.lock.Unlock()
+
+	err := waitUntil(ctx, func() bool { return s.Running() == 0 })
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pending := make([]Removal, 0, len(s.pending))
+	for len(s.pending) > 0 {
+		r := heap.Pop(&s.pending).(*Removal)
+		delete(s.byKey, r.key)
+		pending = append(pending, Removal{Name: r.Name, Type: r.Type, Value: r.Value, Due: r.Due})
+	}
+	return pending, err
+}
+
+// Running returns the number of removals being executed
+func (s *scheduler) Running() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.running
+}
+
+// notify wakes the scheduler goroutine up so it recomputes the next due time. It expects the lock to be held
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run waits for the pending removals to be due and executes them
+func (s *scheduler) run() {
+	timer := time.NewTimer(time.Hour)
+	for {
+		s.lock.Lock()
+		wait := time.Hour
+		if len(s.pending) > 0 {
+			wait = time.Until(s.pending[0].Due)
+		}
+		s.lock.Unlock()
+
+		if wait > 0 {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-s.wake:
+				continue
+			case <-s.quit:
+				timer.Stop()
+				return
+			}
+		}
+		if !s.dispatch() {
+			return
+		}
+	}
+}
+
+// dispatch executes the removals that are due, waiting for a free slot before each one. It returns false once the scheduler is stopped
+func (s *scheduler) dispatch() bool {
+	for {
+		s.lock.Lock()
+		if len(s.pending) == 0 || s.pending[0].Due.After(time.Now()) {
+			s.lock.Unlock()
+			return true
+		}
+		s.lock.Unlock()
+
+		select {
+		case s.slots <- struct{}{}:
+		case <-s.quit:
+			return false
+		}
+
+		s.lock.Lock()
+		if s.stopped {
+			s.lock.Unlock()
+			<-s.slots
+			return false
+		}
+		if len(s.pending) == 0 || s.pending[0].Due.After(time.Now()) {
+			// cancelled or rescheduled while waiting for the slot
+			s.lock.Unlock()
+			<-s.slots
+			continue
+		}
+		r := heap.Pop(&s.pending).(*Removal)
+		delete(s.byKey, r.key)
+		s.running++
+		s.lock.Unlock()
+
+		go func() {
+			defer func() {
+				s.lock.Lock()
+				s.running--
+				s.lock.Unlock()
+				<-s.slots
+			}()
+			s.remove(r.Name, r.Type, r.Value)
+		}()
+	}
+}
@@ -0,0 +1,166 @@
+package manager
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const schedulerBasePath = "./data-scheduler"
+
+func TestSchedulerExecutesInDueOrder(t *testing.T) {
+	executed := make(chan string, 3)
+	s := newScheduler(1, func(name, _, _ string) { executed <- name })
+
+	now := time.Now()
+	s.schedule("c", "c", "A", "", now.Add(60*time.Millisecond))
+	s.schedule("a", "a", "A", "", now.Add(20*time.Millisecond))
+	s.schedule("b", "b", "A", "", now.Add(40*time.Millisecond))
+
+	for _, expected := range []string{"a", "b", "c"} {
+		select {
+		case name := <-executed:
+			if name != expected {
+				t.Errorf("Expecting '%s' to be removed, got '%s'", expected, name)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for the removal of '%s'", expected)
+		}
+	}
+}
+
+func TestSchedulerPendingAndCancel(t *testing.T) {
+	s := newScheduler(1, func(_, _, _ string) { t.Error("Expecting no removal to be executed") })
+
+	now := time.Now()
+	s.schedule("b", "b", "A", "", now.Add(2*time.Hour))
+	s.schedule("a", "a", "A", "", now.Add(time.Hour))
+	s.schedule("b", "b", "A", "", now.Add(30*time.Minute)) // rescheduled
+
+	pending := s.Pending()
+	if len(pending) != 2 || pending[0].Name != "b" || pending[1].Name != "a" {
+		t.Fatalf("Expecting the pending removals to be [b a], got %v", pending)
+	}
+
+	if !s.cancel("a") {
+		t.Error("Expecting the pending removal to be cancelled")
+	}
+	if s.cancel("a") {
+		t.Error("Expecting a cancelled removal to not be cancelled twice")
+	}
+	if pending = s.Pending(); len(pending) != 1 || pending[0].Name != "b" {
+		t.Errorf("Expecting only the removal of 'b' to be pending, got %v", pending)
+	}
+}
+
+func TestSchedulerBoundsConcurrency(t *testing.T) {
+	const concurrency = 2
+	var lock sync.Mutex
+	running, maxRunning := 0, 0
+	release := make(chan struct{})
+	done := make(chan struct{}, 10)
+
+	s := newScheduler(concurrency, func(_, _, _ string) {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+		<-release
+		lock.Lock()
+		running--
+		lock.Unlock()
+		done <- struct{}{}
+	})
+
+	now := time.Now()
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		s.schedule(key, key, "A", "", now)
+	}
+
+	for i := 0; i < 100 && s.Running() < concurrency; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := s.Running(); got != concurrency {
+		t.Errorf("Expecting %d removals to be running, got %d", concurrency, got)
+	}
+	if got := len(s.Pending()); got != 3 {
+		t.Errorf("Expecting 3 removals to wait for a free slot, got %d", got)
+	}
+
+	close(release)
+	for i := 0; i < 5; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for the removals to be executed")
+		}
+	}
+	if maxRunning > concurrency {
+		t.Errorf("Expecting at most %d removals to run at the same time, got %d", concurrency, maxRunning)
+	}
+}
+
+func TestAddingARecordAgainCancelsItsRemoval(t *testing.T) {
+	_ = os.RemoveAll(schedulerBasePath)
+	defer os.RemoveAll(schedulerBasePath)
+	updater := new(MockDNSUpdater)
+	m, err := (&Builder{RemovalDelay: time.Hour}).New(updater, schedulerBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := hookTypes.DNSRecord{Name: "test0.test.com", Value: "0.0.0.0", Type: "A"}
+	if err := m.AddDNSRecord(context.Background(), record); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RemoveDNSRecord(context.Background(), record.Name, record.Type); err != nil {
+		t.Fatalf("Expecting the removal to succeed. Got err '%v'", err)
+	}
+	if pending := m.PendingRemovals(); len(pending) != 1 || pending[0].Name != record.Name {
+		t.Fatalf("Expecting the removal of '%s' to be pending. Got %v", record.Name, pending)
+	}
+
+	if err := m.AddDNSRecord(context.Background(), record); err != nil {
+		t.Fatalf("Expecting the addition to succeed. Got err '%v'", err)
+	}
+	if pending := m.PendingRemovals(); len(pending) != 0 {
+		t.Errorf("Expecting the removal to be cancelled. Got %v", pending)
+	}
+	if atomic.LoadUint64(&updater.RemovalCount) != 0 {
+		t.Errorf("Expecting the updater.RemoveRR to not be called. Got '%v' calls", updater.RemovalCount)
+	}
+}
+
+func TestDelayedRemovalLocksTheName(t *testing.T) {
+	_ = os.RemoveAll(schedulerBasePath)
+	defer os.RemoveAll(schedulerBasePath)
+	updater := new(MockDNSUpdater)
+	m, err := (&Builder{RemovalDelay: time.Hour}).New(updater, schedulerBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlock := m.locks.Lock(nameLockKey("test0.test.com"))
+	done := make(chan struct{})
+	go func() {
+		m.delayRemove("test0.test.com", "A", "0.0.0.0")
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if count := atomic.LoadUint64(&updater.RemovalCount); count != 0 {
+		t.Fatalf("Expecting the removal to wait for the name to be unlocked. Got '%v' calls", count)
+	}
+	unlock()
+	<-done
+	if count := atomic.LoadUint64(&updater.RemovalCount); count != 1 {
+		t.Errorf("Expecting the removal to run once the name is unlocked. Got '%v' calls", count)
+	}
+}
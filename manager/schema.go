@@ -0,0 +1,185 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SchemaVersion the version of the stored representation of the records written by this version
+const SchemaVersion = 1
+
+// envelope is the stored representation of a record
+type envelope struct {
+	Version   int       `json:"version"`
+	Record    Record    `json:"record"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// newEnvelope wraps the record, keeping the creation time of the previous version of the record, if any
+func newEnvelope(record Record, previous *Record, now time.Time) envelope {
+	env := envelope{Version: SchemaVersion, Record: record, CreatedAt: now, UpdatedAt: now}
+	if previous != nil && previous.CreatedAt != nil {
+		env.CreatedAt = *previous.CreatedAt
+	}
+	// the timestamps are held by the envelope only
+	env.Record.CreatedAt, env.Record.UpdatedAt = nil, nil
+	return env
+}
+
+// record returns the wrapped record along with its timestamps
+func (env *envelope) record() Record {
+	r := env.Record
+	createdAt, updatedAt := env.CreatedAt, env.UpdatedAt
+	r.CreatedAt, r.UpdatedAt = &createdAt, &updatedAt
+	return r
+}
+
+// schemaMigration upgrades the stored representation of a record from the version From to the next one
+type schemaMigration struct {
+	From        int
+	Description string
+	Apply       func(b []byte, now time.Time) ([]byte, error)
+}
+
+// schemaMigrations the migrations applied in order to upgrade a stored record to SchemaVersion, one per version
+var schemaMigrations = []schemaMigration{
+	{
+		From:        0,
+		Description: "wrap the bare record in a versioned envelope with timestamps",
+		Apply: func(b []byte, now time.Time) ([]byte, error) {
+			var r Record
+			if err := json.Unmarshal(b, &r); err != nil {
+				return nil, err
+			}
+			return json.Marshal(envelope{Version: 1, Record: r, CreatedAt: now, UpdatedAt: now})
+		},
+	},
+}
+
+// RecordMigration describes the changes needed to bring a stored record up to date
+type RecordMigration struct {
+	Key    string `json:"key"`
+	NewKey string `json:"newKey,omitempty"`
+	// Steps the descriptions of the schema migrations applied, and of the normalization of the name
+	Steps []string `json:"steps,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// decodeRecord parses a stored record, upgrading it to SchemaVersion. It returns the descriptions of the migrations applied
+func decodeRecord(b []byte) (*envelope, []string, error) {
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(b, &header); err != nil {
+		return nil, nil, err
+	}
+	if header.Version < 0 || header.Version > SchemaVersion {
+		return nil, nil, fmt.Errorf("schema version %d is not supported; the supported version is %d", header.Version, SchemaVersion)
+	}
+
+	var steps []string
+	now := time.Now()
+	for _, migration := range schemaMigrations[header.Version:] {
+		var err error
+		if b, err = migration.Apply(b, now); err != nil {
+			return nil, nil, fmt.Errorf("not possible to %s: %v", migration.Description, err)
+		}
+		steps = append(steps, fmt.Sprintf("v%d to v%d: %s", migration.From, migration.From+1, migration.Description))
+	}
+
+	env := new(envelope)
+	if err := json.Unmarshal(b, env); err != nil {
+		return nil, nil, err
+	}
+	return env, steps, nil
+}
+
+// MigrateRecords upgrades every stored record to SchemaVersion and moves it to its normalized key, as written by this version.
+// When dryRun is set, the store is left untouched and only the changes needed are reported. A record that cannot be
+// migrated, either because it cannot be parsed or because its normalized key is taken, is left in place and reported with an error
+func MigrateRecords(store RecordStore, dryRun bool) ([]RecordMigration, error) {
+	keys, err := store.Keys("")
+	if err != nil {
+		return nil, err
+	}
+
+	var report []RecordMigration
+	for _, key := range keys {
+		b, err := store.Read(key)
+		if err != nil {
+			return report, fmt.Errorf("not possible to read the record '%s': %v", key, err)
+		}
+
+		migration := RecordMigration{Key: key}
+		env, steps, err := decodeRecord(b)
+		if err != nil {
+			migration.Error = fmt.Sprintf("not possible to parse the record: %v", err)
+			report = append(report, migration)
+			continue
+		}
+		migration.Steps = steps
+		// the name and type are stored in their canonical form, as written by this version, keeping the name as stored
+		if name, recordType := canonicalName(env.Record.Name), strings.ToUpper(env.Record.Type); name != env.Record.Name || recordType != env.Record.Type {
+			migration.Steps = append(migration.Steps, fmt.Sprintf("put the name '%s' and type '%s' in their canonical form", env.Record.Name, env.Record.Type))
+			if name != env.Record.Name {
+				env.Record.RequestedName = env.Record.Name
+			}
+			env.Record.Name, env.Record.Type = name, recordType
+		}
+		if newKey := recordKey(env.Record.Name, env.Record.Type); newKey != key {
+			migration.NewKey = newKey
+		}
+		if len(migration.Steps) == 0 && migration.NewKey == "" {
+			continue
+		}
+
+		if !dryRun {
+			if b, err = json.Marshal(env); err == nil {
+				err = store.Update(func(tx RecordTx) error {
+					if migration.NewKey == "" {
+						return tx.Write(key, b)
+					}
+					if tx.Has(migration.NewKey) {
+						return fmt.Errorf("the key '%s' is already taken", migration.NewKey)
+					}
+					if err := tx.Write(migration.NewKey, b); err != nil {
+						return err
+					}
+					return tx.Erase(key)
+				})
+			}
+			if err != nil {
+				migration.Error = err.Error()
+			}
+		} else if migration.NewKey != "" && store.Has(migration.NewKey) {
+			migration.Error = fmt.Sprintf("the key '%s' is already taken", migration.NewKey)
+		}
+		report = append(report, migration)
+	}
+	return report, nil
+}
+
+// migrateRecords brings the stored records up to date, logging what has been done
+func migrateRecords(store RecordStore) error {
+	report, err := MigrateRecords(store, false)
+	if err != nil {
+		return err
+	}
+	migrated := 0
+	for _, migration := range report {
+		if migration.Error != "" {
+			logrus.Errorf("Not possible to migrate the record '%s'; leaving it in place: %s", migration.Key, migration.Error)
+			continue
+		}
+		migrated++
+	}
+	if migrated > 0 {
+		logrus.Infof("Migrated %d records to the schema version %d", migrated, SchemaVersion)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const schemaBasePath = "./data-schema"
+
+func TestDecodeRecord(t *testing.T) {
+	tests := []struct {
+		name      string
+		stored    string
+		wantSteps int
+		wantErr   bool
+	}{
+		{"bare record", `{"name":"a.test.com","value":"0.0.0.0","type":"A"}`, 1, false},
+		{"current version", `{"version":1,"record":{"name":"a.test.com","value":"0.0.0.0","type":"A"},"createdAt":"2020-01-01T00:00:00Z","updatedAt":"2020-01-02T00:00:00Z"}`, 0, false},
+		{"newer version", `{"version":2,"record":{"name":"a.test.com","value":"0.0.0.0","type":"A"}}`, 0, true},
+		{"invalid", `{"name":`, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, steps, err := decodeRecord([]byte(test.stored))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("decodeRecord() err = %v, want an error: %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(steps) != test.wantSteps {
+				t.Errorf("Expecting %d migration steps. Got %v", test.wantSteps, steps)
+			}
+			if env.Version != SchemaVersion || env.Record.Name != "a.test.com" || env.CreatedAt.IsZero() || env.UpdatedAt.IsZero() {
+				t.Errorf("Expecting the record to be upgraded to the current version. Got %+v", env)
+			}
+		})
+	}
+}
+
+func TestMigrateRecords(t *testing.T) {
+	_ = os.RemoveAll(schemaBasePath)
+	defer os.RemoveAll(schemaBasePath)
+
+	store := newDiskvStore(schemaBasePath)
+	stored := map[string]string{
+		"Old.test.com.A.bindman":     `{"name":"Old.test.com","value":"0.0.0.1","type":"A"}`,
+		"current.test.com.A.bindman": `{"version":1,"record":{"name":"current.test.com","value":"0.0.0.2","type":"A"},"createdAt":"2020-01-01T00:00:00Z","updatedAt":"2020-01-01T00:00:00Z"}`,
+		"broken.test.com.A.bindman":  `{"name":`,
+	}
+	for key, value := range stored {
+		if err := store.Write(key, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := MigrateRecords(store, true)
+	if err != nil || len(report) != 2 {
+		t.Fatalf("Expecting the old and broken records to be reported. Got %+v and err '%v'", report, err)
+	}
+	if report[0].Key != "Old.test.com.A.bindman" || report[0].NewKey != "old.test.com.A.bindman" || len(report[0].Steps) != 2 {
+		t.Errorf("Expecting the old record to be upgraded and moved. Got %+v", report[0])
+	}
+	if report[1].Key != "broken.test.com.A.bindman" || report[1].Error == "" {
+		t.Errorf("Expecting the broken record to be reported with an error. Got %+v", report[1])
+	}
+	if !store.Has("Old.test.com.A.bindman") {
+		t.Fatal("Expecting a dry run to leave the store untouched")
+	}
+
+	if report, err = MigrateRecords(store, false); err != nil || len(report) != 2 {
+		t.Fatalf("Expecting the same report when migrating. Got %+v and err '%v'", report, err)
+	}
+	b, err := store.Read("old.test.com.A.bindman")
+	if err != nil || store.Has("Old.test.com.A.bindman") {
+		t.Fatalf("Expecting the old record to be moved. Got err '%v'", err)
+	}
+	var env envelope
+	if err := json.Unmarshal(b, &env); err != nil || env.Version != SchemaVersion || env.Record.Value != "0.0.0.1" || env.Record.Name != "old.test.com" || env.Record.RequestedName != "Old.test.com" {
+		t.Errorf("Expecting the old record to be wrapped in an envelope with its canonical name. Got '%s' and err '%v'", b, err)
+	}
+
+	if report, _ = MigrateRecords(store, false); len(report) != 1 {
+		t.Errorf("Expecting only the broken record to be left. Got %+v", report)
+	}
+}
+
+func TestRecordTimestamps(t *testing.T) {
+	_ = os.RemoveAll(schemaBasePath)
+	defer os.RemoveAll(schemaBasePath)
+	m, err := new(Builder).New(new(MockDNSUpdater), schemaBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := hookTypes.DNSRecord{Name: "timed.test.com", Value: "0.0.0.1", Type: "A"}
+	if err := m.AddDNSRecord(context.Background(), record); err != nil {
+		t.Fatal(err)
+	}
+	added, _ := m.GetRecord(record.Name, record.Type)
+
+	time.Sleep(10 * time.Millisecond)
+	record.Value = "0.0.0.2"
+	if err := m.UpdateDNSRecord(context.Background(), record); err != nil {
+		t.Fatal(err)
+	}
+	updated, _ := m.GetRecord(record.Name, record.Type)
+
+	if !updated.CreatedAt.Equal(*added.CreatedAt) {
+		t.Errorf("Expecting the creation time to be kept on update. Got %v, then %v", added.CreatedAt, updated.CreatedAt)
+	}
+	if !updated.UpdatedAt.After(*added.UpdatedAt) {
+		t.Errorf("Expecting the update time to move forward. Got %v, then %v", added.UpdatedAt, updated.UpdatedAt)
+	}
+}
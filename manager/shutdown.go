@@ -0,0 +1,131 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ShutdownPersist keeps the pending removals in the data directory on shutdown, to be scheduled again on the next startup
+	ShutdownPersist = "persist"
+	// ShutdownExecute executes the pending removals right away on shutdown
+	ShutdownExecute = "execute"
+
+	removalsDir       = "removals"
+	removalsExtension = "removal"
+)
+
+// Shutdown stops the manager gracefully: it waits for the operations being applied and for the coalesced changes to be flushed,
+// then persists or executes the pending removals according to the PendingRemovalsOnShutdown mode and closes the record store.
+// It returns an error when not everything could be drained before the context is done
+func (m *Bind9Manager) Shutdown(ctx context.Context) error {
+	m.events.close()
+	var errs []string
+	if m.files != nil {
+		if err := m.files.stop(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("the convergence to the file source in progress did not finish in time: %v", err))
+		}
+	}
+	if m.Queue != nil {
+		if err := m.Queue.stop(ctx); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if m.coalescer != nil {
+		if err := m.coalescer.drain(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("the coalesced changes were not applied in time: %v", err))
+		}
+	}
+
+	if m.PendingRemovalsOnShutdown == ShutdownExecute {
+		logrus.Infof("Executing %d pending removals before shutting down", len(m.scheduler.Pending()))
+		m.scheduler.expedite()
+		if err := m.scheduler.wait(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("the pending removals were not executed in time: %v", err))
+		}
+	}
+
+	pending, err := m.scheduler.stop(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("the running removals did not finish in time: %v", err))
+	}
+	// removals left behind are persisted whatever the mode, so they are not lost
+	if err := m.persistRemovals(pending); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if m.propagation != nil {
+		if err := m.propagation.stop(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("the propagation poll in progress did not finish in time: %v", err))
+		}
+	}
+	if m.notifier != nil {
+		if err := m.notifier.stop(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("the webhook notification being sent did not finish in time: %v", err))
+		}
+	}
+
+	if err := m.DNSRecords.Close(); err != nil {
+		errs = append(errs, fmt.Sprintf("not possible to close the record store: %v", err))
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// persistRemovals writes the removals to the data directory
+func (m *Bind9Manager) persistRemovals(removals []Removal) error {
+	failed := 0
+	for _, r := range removals {
+		if err := m.removals.put(uuid.New().String(), r); err != nil {
+			logrus.Errorf("Not possible to persist the pending removal of '%s' with type '%s': %v", r.Name, r.Type, err)
+			failed++
+		}
+	}
+	if len(removals) > 0 {
+		logrus.Infof("Persisted %d pending removals", len(removals)-failed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d pending removals could not be persisted", failed)
+	}
+	return nil
+}
+
+// loadRemovals schedules again the removals persisted by a previous execution; the overdue ones are executed right away
+func (m *Bind9Manager) loadRemovals() {
+	ids := m.removals.ids()
+	for _, id := range ids {
+		r := new(Removal)
+		if err := m.removals.get(id, r); err != nil {
+			logrus.Errorf("Not possible to read the pending removal '%s': %v", id, err)
+			continue
+		}
+		m.scheduler.schedule(m.getRecordFileName(r.Name, r.Type), r.Name, r.Type, r.Value, r.Due)
+		_ = m.removals.remove(id)
+	}
+	if len(ids) > 0 {
+		logrus.Infof("Resuming %d pending removals", len(ids))
+	}
+}
+
+// waitUntil polls the condition until it holds or the context is done
+func waitUntil(ctx context.Context, condition func() bool) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for !condition() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const shutdownBasePath = "./data-shutdown"
+
+func TestNewUnknownShutdownMode(t *testing.T) {
+	_ = os.RemoveAll(shutdownBasePath)
+	defer os.RemoveAll(shutdownBasePath)
+	if _, err := (&Builder{PendingRemovalsOnShutdown: "drop"}).New(new(MockDNSUpdater), shutdownBasePath); err == nil {
+		t.Error("Expecting an error in face of an unknown pending removals shutdown mode")
+	}
+}
+
+func TestShutdownPersistsPendingRemovals(t *testing.T) {
+	_ = os.RemoveAll(shutdownBasePath)
+	defer os.RemoveAll(shutdownBasePath)
+	updater := new(MockDNSUpdater)
+	b := &Builder{RemovalDelay: time.Hour, PendingRemovalsOnShutdown: ShutdownPersist}
+	m := initShutdownManager(t, b, updater)
+
+	due := m.PendingRemovals()[0].Due
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expecting the shutdown to drain cleanly. Got err '%v'", err)
+	}
+	if removals := atomic.LoadUint64(&updater.RemovalCount); removals != 0 {
+		t.Errorf("Expecting the pending removal to not be executed. Got %d removals", removals)
+	}
+
+	m, err := b.New(updater, shutdownBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := m.PendingRemovals()
+	if len(pending) != 1 || pending[0].Name != "shutdown.test.com" || !pending[0].Due.Equal(due) {
+		t.Fatalf("Expecting the persisted removal to be scheduled again at %v. Got %v", due, pending)
+	}
+	if ids := m.removals.ids(); len(ids) != 0 {
+		t.Errorf("Expecting the persisted removals to be erased once scheduled again. Got %v", ids)
+	}
+}
+
+func TestShutdownExecutesPendingRemovals(t *testing.T) {
+	_ = os.RemoveAll(shutdownBasePath)
+	defer os.RemoveAll(shutdownBasePath)
+	updater := new(MockDNSUpdater)
+	m := initShutdownManager(t, &Builder{RemovalDelay: time.Hour, PendingRemovalsOnShutdown: ShutdownExecute}, updater)
+
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expecting the shutdown to drain cleanly. Got err '%v'", err)
+	}
+	if removals := atomic.LoadUint64(&updater.RemovalCount); removals != 1 {
+		t.Errorf("Expecting the pending removal to be executed. Got %d removals", removals)
+	}
+	if ids := m.removals.ids(); len(ids) != 0 {
+		t.Errorf("Expecting no removal to be persisted. Got %v", ids)
+	}
+}
+
+func TestShutdownTimesOutWithRunningOperations(t *testing.T) {
+	_ = os.RemoveAll(shutdownBasePath)
+	defer os.RemoveAll(shutdownBasePath)
+	updater := &MockDNSUpdater{Gate: make(chan struct{})}
+	m, err := (&Builder{Async: true, QueueSize: 10, QueueWorkers: 1, OperationRetention: time.Hour}).New(updater, shutdownBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the worker is stopped before the data directory is removed
+	defer m.Queue.stop(context.Background())
+	defer close(updater.Gate)
+
+	if _, err := m.Queue.Submit(OperationAdd, Record{DNSRecord: hookTypes.DNSRecord{Name: "blocked.test.com", Value: "0.0.0.0", Type: "A"}}); err != nil {
+		t.Fatal(err)
+	}
+	for atomic.LoadUint64(&updater.AddCount) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := m.Shutdown(ctx); err == nil {
+		t.Error("Expecting the shutdown to report the operation still running")
+	}
+
+	_, err = m.Queue.Submit(OperationAdd, Record{DNSRecord: hookTypes.DNSRecord{Name: "late.test.com", Value: "0.0.0.0", Type: "A"}})
+	if e, ok := err.(*hookTypes.Error); !ok || e.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expecting the submissions to be refused once shutting down. Got '%v'", err)
+	}
+}
+
+// initShutdownManager creates a manager with a record whose removal is pending
+func initShutdownManager(t *testing.T, b *Builder, updater *MockDNSUpdater) *Bind9Manager {
+	m, err := b.New(updater, shutdownBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := hookTypes.DNSRecord{Name: "shutdown.test.com", Value: "0.0.0.0", Type: "A"}
+	if err := m.AddDNSRecord(context.Background(), record); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RemoveDNSRecord(context.Background(), record.Name, record.Type); err != nil {
+		t.Fatal(err)
+	}
+	if pending := m.PendingRemovals(); len(pending) != 1 {
+		t.Fatalf("Expecting one pending removal. Got %v", pending)
+	}
+	return m
+}
@@ -0,0 +1,179 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/peterbourgon/diskv"
+)
+
+const (
+	// StoreDiskv identifies the store keeping each record in its own file of the data directory
+	StoreDiskv = "diskv"
+	// StoreBolt identifies the store keeping every record in a single embedded bolt database
+	StoreBolt = "bolt"
+)
+
+// RecordTx reads and writes the records of a store
+type RecordTx interface {
+	Has(key string) bool
+	Read(key string) ([]byte, error)
+	Write(key string, value []byte) error
+	Erase(key string) error
+}
+
+// RecordStore persists the records being managed, identified by their key
+type RecordStore interface {
+	RecordTx
+	// Keys lists the keys starting with prefix, sorted
+	Keys(prefix string) ([]string, error)
+	// Update runs fn in a transaction: its writes and erasures are applied only if it returns no error
+	Update(fn func(tx RecordTx) error) error
+	Close() error
+}
+
+// OpenRecordStore opens the store of the given backend inside basePath; an empty backend means StoreDiskv
+func OpenRecordStore(backend, basePath string) (RecordStore, error) {
+	switch backend {
+	case "", StoreDiskv:
+		return newDiskvStore(basePath), nil
+	case StoreBolt:
+		return newBoltStore(basePath)
+	default:
+		return nil, fmt.Errorf("unknown record store '%s', expecting '%s' or '%s'", backend, StoreDiskv, StoreBolt)
+	}
+}
+
+// MigrateStore copies every record of the store from to the store to in a single transaction, returning the number of records copied
+func MigrateStore(from, to RecordStore) (int, error) {
+	keys, err := from.Keys("")
+	if err != nil {
+		return 0, err
+	}
+	err = to.Update(func(tx RecordTx) error {
+		for _, key := range keys {
+			value, err := from.Read(key)
+			if err != nil {
+				return fmt.Errorf("not possible to read the record '%s': %v", key, err)
+			}
+			if err := tx.Write(key, value); err != nil {
+				return fmt.Errorf("not possible to write the record '%s': %v", key, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// diskvStore keeps each record in its own file of a flat directory
+type diskvStore struct {
+	*diskv.Diskv
+	// lock serializes the transactions
+	lock sync.Mutex
+}
+
+// newDiskvStore creates a diskvStore in basePath
+func newDiskvStore(basePath string) *diskvStore {
+	return &diskvStore{Diskv: diskv.New(diskv.Options{
+		BasePath:     basePath,
+		Transform:    func(s string) []string { return []string{} },
+		CacheSizeMax: 1024 * 1024,
+	})}
+}
+
+// Keys lists the keys of the record files, skipping the other files of the data directory
+func (s *diskvStore) Keys(prefix string) (keys []string, err error) {
+	suffix := "." + Extension
+	for key := range s.KeysPrefix(prefix, nil) {
+		if strings.HasSuffix(key, suffix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return
+}
+
+// Update stages the changes made by fn and writes them once it succeeds.
+// The files are written one by one, so a crash in the middle may leave only part of them written
+func (s *diskvStore) Update(fn func(tx RecordTx) error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tx := &diskvTx{store: s, changes: make(map[string][]byte)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	for _, key := range tx.order {
+		value, ok := tx.changes[key]
+		if !ok {
+			continue
+		}
+		var err error
+		if value == nil {
+			if s.Has(key) {
+				err = s.Erase(key)
+			}
+		} else {
+			err = s.Write(key, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close does nothing, files need no closing
+func (s *diskvStore) Close() error {
+	return nil
+}
+
+// diskvTx stages the changes of a diskvStore transaction; a nil value marks an erasure
+type diskvTx struct {
+	store   *diskvStore
+	changes map[string][]byte
+	order   []string
+}
+
+func (tx *diskvTx) Has(key string) bool {
+	if value, ok := tx.changes[key]; ok {
+		return value != nil
+	}
+	return tx.store.Has(key)
+}
+
+func (tx *diskvTx) Read(key string) ([]byte, error) {
+	if value, ok := tx.changes[key]; ok {
+		if value == nil {
+			return nil, fmt.Errorf("record '%s' erased in the transaction", key)
+		}
+		return value, nil
+	}
+	return tx.store.Read(key)
+}
+
+func (tx *diskvTx) Write(key string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	tx.stage(key, value)
+	return nil
+}
+
+func (tx *diskvTx) Erase(key string) error {
+	tx.stage(key, nil)
+	return nil
+}
+
+// stage records the change of the key, keeping the order in which keys are first changed
+func (tx *diskvTx) stage(key string, value []byte) {
+	if _, ok := tx.changes[key]; !ok {
+		tx.order = append(tx.order, key)
+	}
+	tx.changes[key] = value
+}
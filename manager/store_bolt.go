@@ -0,0 +1,125 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	boltFileName = "records.db"
+	boltBucket   = "records"
+)
+
+// boltStore keeps every record in a bucket of an embedded bolt database
+type boltStore struct {
+	db *bolt.DB
+}
+
+// newBoltStore opens, creating it if needed, the bolt database of the records inside basePath
+func newBoltStore(basePath string) (*boltStore, error) {
+	if err := os.MkdirAll(basePath, 0777); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(filepath.Join(basePath, boltFileName), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("not possible to open the bolt record store: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(boltBucket))
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) Has(key string) (ok bool) {
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		ok = newBoltTx(tx).Has(key)
+		return nil
+	})
+	return
+}
+
+func (s *boltStore) Read(key string) (value []byte, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		value, err = newBoltTx(tx).Read(key)
+		return err
+	})
+	return
+}
+
+func (s *boltStore) Write(key string, value []byte) error {
+	return s.Update(func(tx RecordTx) error { return tx.Write(key, value) })
+}
+
+func (s *boltStore) Erase(key string) error {
+	return s.Update(func(tx RecordTx) error { return tx.Erase(key) })
+}
+
+// Keys scans the keys starting with prefix, which bolt keeps sorted
+func (s *boltStore) Keys(prefix string) (keys []string, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(boltBucket)).Cursor()
+		p := []byte(prefix)
+		for k, _ := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	return
+}
+
+// Update runs fn in a bolt read-write transaction, rolled back when fn fails
+func (s *boltStore) Update(fn func(tx RecordTx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(newBoltTx(tx))
+	})
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// boltTx gives access to the records bucket within a bolt transaction
+type boltTx struct {
+	bucket *bolt.Bucket
+}
+
+func newBoltTx(tx *bolt.Tx) *boltTx {
+	return &boltTx{bucket: tx.Bucket([]byte(boltBucket))}
+}
+
+func (tx *boltTx) Has(key string) bool {
+	return tx.bucket.Get([]byte(key)) != nil
+}
+
+func (tx *boltTx) Read(key string) ([]byte, error) {
+	value := tx.bucket.Get([]byte(key))
+	if value == nil {
+		return nil, &os.PathError{Op: "read", Path: key, Err: os.ErrNotExist}
+	}
+	// the value is only valid during the transaction
+	return append([]byte(nil), value...), nil
+}
+
+func (tx *boltTx) Write(key string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	return tx.bucket.Put([]byte(key), value)
+}
+
+func (tx *boltTx) Erase(key string) error {
+	if tx.bucket.Get([]byte(key)) == nil {
+		return &os.PathError{Op: "erase", Path: key, Err: os.ErrNotExist}
+	}
+	return tx.bucket.Delete([]byte(key))
+}
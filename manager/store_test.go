@@ -0,0 +1,118 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const storeBasePath = "./data-store"
+
+func TestRecordStores(t *testing.T) {
+	for _, backend := range []string{StoreDiskv, StoreBolt} {
+		t.Run(backend, func(t *testing.T) {
+			defer os.RemoveAll(storeBasePath)
+			s, err := OpenRecordStore(backend, storeBasePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			for _, key := range []string{"b.test.com.A.bindman", "a.test.com.A.bindman", "a.test.com.CNAME.bindman"} {
+				if err := s.Write(key, []byte(key)); err != nil {
+					t.Fatalf("Expecting the write of '%s' to succeed. Got err '%v'", key, err)
+				}
+			}
+			if value, err := s.Read("b.test.com.A.bindman"); err != nil || string(value) != "b.test.com.A.bindman" {
+				t.Errorf("Expecting the written value to be read. Got '%s' and err '%v'", value, err)
+			}
+			if _, err := s.Read("unknown.A.bindman"); !os.IsNotExist(err) {
+				t.Errorf("Expecting a not exist error when reading an unknown key. Got '%v'", err)
+			}
+
+			keys, err := s.Keys("a.")
+			if expected := []string{"a.test.com.A.bindman", "a.test.com.CNAME.bindman"}; err != nil || !reflect.DeepEqual(keys, expected) {
+				t.Errorf("Expecting the prefix scan to return %v. Got %v and err '%v'", expected, keys, err)
+			}
+
+			failure := errors.New("failure")
+			err = s.Update(func(tx RecordTx) error {
+				if err := tx.Erase("a.test.com.A.bindman"); err != nil {
+					return err
+				}
+				if err := tx.Write("c.test.com.A.bindman", []byte("c")); err != nil {
+					return err
+				}
+				if tx.Has("a.test.com.A.bindman") || !tx.Has("c.test.com.A.bindman") {
+					t.Error("Expecting the changes to be visible within the transaction")
+				}
+				return failure
+			})
+			if err != failure {
+				t.Errorf("Expecting the transaction error to be returned. Got '%v'", err)
+			}
+			if !s.Has("a.test.com.A.bindman") || s.Has("c.test.com.A.bindman") {
+				t.Error("Expecting the changes of a failed transaction to be discarded")
+			}
+
+			err = s.Update(func(tx RecordTx) error {
+				if err := tx.Erase("a.test.com.A.bindman"); err != nil {
+					return err
+				}
+				return tx.Write("c.test.com.A.bindman", []byte("c"))
+			})
+			if err != nil || s.Has("a.test.com.A.bindman") || !s.Has("c.test.com.A.bindman") {
+				t.Errorf("Expecting the changes of a successful transaction to be applied. Got err '%v'", err)
+			}
+		})
+	}
+}
+
+func TestMigrateStore(t *testing.T) {
+	defer os.RemoveAll(storeBasePath)
+	m, err := new(Builder).New(new(MockDNSUpdater), storeBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []hookTypes.DNSRecord{
+		{Name: "a.test.com", Value: "0.0.0.0", Type: "A"},
+		{Name: "b.test.com", Value: "a.test.com", Type: "CNAME"},
+	}
+	for _, r := range records {
+		if err := m.AddDNSRecord(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	to, err := OpenRecordStore(StoreBolt, storeBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := MigrateStore(m.DNSRecords, to); err != nil || count != len(records) {
+		t.Fatalf("Expecting %d records to be migrated. Got %d and err '%v'", len(records), count, err)
+	}
+	if err := to.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = (&Builder{Store: StoreBolt}).New(new(MockDNSUpdater), storeBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.DNSRecords.Close()
+	migrated, err := m.GetDNSRecords()
+	if err != nil || !reflect.DeepEqual(migrated, records) {
+		t.Errorf("Expecting the migrated records to be %v. Got %v and err '%v'", records, migrated, err)
+	}
+}
+
+func TestNewUnknownStore(t *testing.T) {
+	defer os.RemoveAll(storeBasePath)
+	if _, err := (&Builder{Store: "sql"}).New(new(MockDNSUpdater), storeBasePath); err == nil {
+		t.Error("Expecting an error in face of an unknown record store")
+	}
+}
@@ -0,0 +1,110 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// VerificationHeader the response header telling the outcome of the verification of a change applied right away
+	VerificationHeader = "X-Bindman-Verification"
+	// VerificationVerified the change was verified to be served by the nameserver
+	VerificationVerified = "verified"
+	// VerificationFailed the change was accepted by the nameserver but is not served as expected
+	VerificationFailed = "failed"
+	// VerificationUnknown the change was accepted by the nameserver, which could not be queried to verify it
+	VerificationUnknown = "unknown"
+)
+
+// verificationRanks ranks the outcomes of the verification, the worst one being the outcome of several changes
+var verificationRanks = map[string]int{VerificationVerified: 1, VerificationUnknown: 2, VerificationFailed: 3}
+
+// verificationKey the key of the verificationRecorder in a context
+type verificationKey struct{}
+
+// verificationRecorder records the outcome of the verification of the changes applied with a context
+type verificationRecorder struct {
+	lock    sync.Mutex
+	outcome string
+}
+
+// WithVerification returns a context recording the outcome of the verification of the changes applied with it, along with
+// the function returning that outcome: the worst one of the changes, or empty when no change was verified
+func WithVerification(ctx context.Context) (context.Context, func() string) {
+	r := new(verificationRecorder)
+	return context.WithValue(ctx, verificationKey{}, r), func() string {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		return r.outcome
+	}
+}
+
+// recordVerification records the outcome of the verification of a change in the context, when made by WithVerification
+func recordVerification(ctx context.Context, outcome string) {
+	r, ok := ctx.Value(verificationKey{}).(*verificationRecorder)
+	if !ok || outcome == "" {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if verificationRanks[outcome] > verificationRanks[r.outcome] {
+		r.outcome = outcome
+	}
+}
+
+// Verifies tells whether the changes are verified by querying the nameserver once applied.
+// Removals are verified too, but only once their removal delay is over
+func (m *Bind9Manager) Verifies() bool {
+	v, ok := m.DNSUpdater.(nsupdate.Verifier)
+	return ok && v.Verifies()
+}
+
+// verified returns the outcome of the verification of a change the nameserver answered with the error, or empty when the
+// change was not applied or not verified, along with the error to report. A change not served as expected is a bad gateway
+// error, while a change that could not be verified because the nameserver could not be queried is not an error
+func (m *Bind9Manager) verified(err error) (string, error) {
+	if err == nil {
+		if m.Verifies() {
+			return VerificationVerified, nil
+		}
+		return "", nil
+	}
+	var verr *nsupdate.VerificationError
+	if !errors.As(err, &verr) {
+		return "", err
+	}
+	if verr.QueryFailed {
+		logrus.Warnf("The change to the %s record '%s' was accepted by the nameserver but could not be verified: %v", verr.Type, verr.Name, err)
+		return VerificationUnknown, nil
+	}
+	return VerificationFailed, verificationFailure(err)
+}
+
+// verificationFailure turns a change not served as expected into a bad gateway error, telling it apart from a change
+// refused by the nameserver. Other errors are returned as they are
+func verificationFailure(err error) error {
+	var verr *nsupdate.VerificationError
+	if !errors.As(err, &verr) {
+		return err
+	}
+	details := []string{"reason: " + verr.Reason}
+	for _, rr := range verr.Expected {
+		details = append(details, "expected: "+rr)
+	}
+	for _, rr := range verr.Served {
+		details = append(details, "served: "+rr)
+	}
+	return &hookTypes.Error{
+		Message: fmt.Sprintf("The change to the %s record '%s' was accepted by the nameserver but is not served as expected", verr.Type, verr.Name),
+		Code:    http.StatusBadGateway,
+		Details: details,
+		Err:     err,
+	}
+}
@@ -0,0 +1,127 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/labbsr0x/bindman-dns-bind9/nsupdate"
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const verifyBasePath = "./data-verify"
+
+// mockVerifier is a MockDNSUpdater verifying the changes, failing the ones to the records of the name unserved, and not able
+// to verify the ones to the records of the name unreachable
+type mockVerifier struct {
+	MockDNSUpdater
+	unserved    string
+	unreachable string
+}
+
+func (m *mockVerifier) Verifies() bool {
+	return true
+}
+
+func (m *mockVerifier) AddRR(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration) error {
+	if err := m.MockDNSUpdater.AddRR(ctx, record, ttl); err != nil {
+		return err
+	}
+	if record.Name == m.unserved {
+		return &nsupdate.VerificationError{Name: record.Name, Type: record.Type, Expected: []string{record.Name + ". 3600 IN A " + record.Value}, Reason: "the record is not served"}
+	}
+	if record.Name == m.unreachable {
+		return &nsupdate.VerificationError{Name: record.Name, Type: record.Type, Reason: "the nameserver cannot be queried", QueryFailed: true}
+	}
+	return nil
+}
+
+func TestVerification(t *testing.T) {
+	_ = os.RemoveAll(verifyBasePath)
+	defer os.RemoveAll(verifyBasePath)
+	m, err := new(Builder).New(&mockVerifier{unserved: "hidden.test.com", unreachable: "unknown.test.com"}, verifyBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Verifies() {
+		t.Error("Expecting the manager to verify the changes of a verifying DNSUpdater")
+	}
+
+	ctx, verification := WithVerification(context.Background())
+	if err := m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "app.test.com", Value: "0.0.0.1", Type: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	if outcome := verification(); outcome != VerificationVerified {
+		t.Errorf("Expecting the change to be verified. Got '%s'", outcome)
+	}
+
+	ctx, verification = WithVerification(context.Background())
+	err = m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "hidden.test.com", Value: "0.0.0.2", Type: "A"})
+	hookErr, ok := err.(*hookTypes.Error)
+	if !ok || hookErr.Code != http.StatusBadGateway || len(hookErr.Details) != 2 {
+		t.Fatalf("Expecting a bad gateway error with the reason and the expected record. Got '%v'", err)
+	}
+	if outcome := verification(); outcome != VerificationFailed {
+		t.Errorf("Expecting the verification to be reported as failed. Got '%s'", outcome)
+	}
+	if !m.HasDNSRecord("hidden.test.com", "A") {
+		t.Error("Expecting the record accepted by the nameserver to be stored even though it is not served")
+	}
+
+	ctx, verification = WithVerification(context.Background())
+	if err := m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "unknown.test.com", Value: "0.0.0.3", Type: "A"}); err != nil {
+		t.Errorf("Expecting a change that could not be verified not to fail. Got '%v'", err)
+	}
+	if outcome := verification(); outcome != VerificationUnknown {
+		t.Errorf("Expecting the verification to be reported as unknown. Got '%s'", outcome)
+	}
+	if !m.HasDNSRecord("unknown.test.com", "A") {
+		t.Error("Expecting the record that could not be verified to be stored")
+	}
+
+	ctx, verification = WithVerification(context.Background())
+	if err := m.AddDNSRecord(ctx, hookTypes.DNSRecord{Name: "app.test.com", Value: "other.test.com", Type: "CNAME"}); err == nil {
+		t.Error("Expecting the addition of a conflicting record to fail")
+	}
+	if outcome := verification(); outcome != "" {
+		t.Errorf("Expecting no verification outcome for a change not applied. Got '%s'", outcome)
+	}
+	if ids := m.intents.ids(); len(ids) != 0 {
+		t.Errorf("Expecting no intent left behind. Got %d", len(ids))
+	}
+}
+
+func TestCoalescedVerification(t *testing.T) {
+	_ = os.RemoveAll(verifyBasePath)
+	defer os.RemoveAll(verifyBasePath)
+	m, err := (&Builder{TTL: time.Hour, RemovalDelay: time.Hour, CoalesceWindow: 100 * time.Millisecond}).New(new(mockVerifier), verifyBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := hookTypes.DNSRecord{Name: "flap.test.com", Value: "0.0.0.1", Type: "A"}
+
+	outcomes := make(chan string, 2)
+	for _, remove := range []bool{false, true} {
+		go func(remove bool) {
+			ctx, verification := WithVerification(context.Background())
+			var err error
+			if remove {
+				time.Sleep(10 * time.Millisecond)
+				err = m.RemoveDNSRecord(ctx, record.Name, record.Type)
+			} else {
+				err = m.AddDNSRecord(ctx, record)
+			}
+			if err != nil {
+				t.Error(err)
+			}
+			outcomes <- verification()
+		}(remove)
+	}
+	for i := 0; i < 2; i++ {
+		if outcome := <-outcomes; outcome != "" {
+			t.Errorf("Expecting no verification outcome for changes coalesced into none. Got '%s'", outcome)
+		}
+	}
+}
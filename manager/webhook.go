@@ -0,0 +1,303 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SignatureHeader the header holding the HMAC-SHA256 signature of the webhook payload, as "sha256=<hex digest>"
+	SignatureHeader = "X-Bindman-Signature"
+	// EventHeader the header holding the type of the event notified
+	EventHeader = "X-Bindman-Event"
+	// DeliveryHeader the header holding the id of the delivery, the same on every attempt
+	DeliveryHeader = "X-Bindman-Delivery"
+
+	outboxDir       = "outbox"
+	outboxExtension = "webhook"
+
+	defaultWebhookTimeout     = 10 * time.Second
+	defaultWebhookMaxAttempts = 10
+	webhookInitialBackoff     = time.Second
+	webhookMaxBackoff         = 5 * time.Minute
+	webhookPollInterval       = time.Second
+)
+
+var webhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "bindman_webhook_deliveries_total",
+	Help: "How many webhook notifications were attempted, by outcome: delivered, failed (to be retried) or dropped (out of attempts).",
+}, []string{"outcome"})
+
+func init() {
+	prometheus.MustRegister(webhookDeliveries)
+}
+
+// delivery is a webhook notification waiting in the outbox
+type delivery struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Event       Event     `json:"event"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// notifier delivers the events to the webhooks, in order for each webhook, retrying them with an exponential backoff.
+// The deliveries are kept in a persistent outbox until they succeed or run out of attempts, so they survive restarts, and
+// in memory, in order for each webhook, so they are not read again on every attempt
+type notifier struct {
+	urls        []string
+	secret      []byte
+	maxAttempts int
+	client      *http.Client
+	outbox      *journal
+	lock        sync.Mutex
+	pending     map[string][]delivery
+	// reserved the ids of the pending deliveries not persisted yet
+	reserved map[string]bool
+	wake     chan struct{}
+	quit     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// newNotifier creates a notifier delivering the events to the urls, and starts delivering the ones left in the outbox
+func newNotifier(urls []string, secret string, timeout time.Duration, maxAttempts int, basePath string) *notifier {
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = defaultWebhookMaxAttempts
+	}
+	n := &notifier{
+		urls:        urls,
+		secret:      []byte(secret),
+		maxAttempts: maxAttempts,
+		client:      &http.Client{Timeout: timeout},
+		outbox:      newJournal(basePath, outboxDir, outboxExtension),
+		pending:     make(map[string][]delivery),
+		reserved:    make(map[string]bool),
+		wake:        make(chan struct{}, 1),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	resumed := 0
+	for _, id := range n.outbox.ids() {
+		var d delivery
+		if err := n.outbox.get(id, &d); err != nil {
+			logrus.Errorf("Not possible to read the webhook notification '%s'; dropping it: %v", id, err)
+			_ = n.outbox.remove(id)
+			continue
+		}
+		n.pending[d.URL] = append(n.pending[d.URL], d)
+		resumed++
+	}
+	if resumed > 0 {
+		logrus.Infof("Resuming %d pending webhook notifications", resumed)
+	}
+	go n.run()
+	return n
+}
+
+// reserve puts the deliveries of the event after the ones of every webhook, returning the function persisting them in the
+// outbox. A delivery is not made until persisted, so the deliveries can be persisted out of the lock ordering the events
+func (n *notifier) reserve(event Event) func() {
+	now := time.Now()
+	deliveries := make([]delivery, 0, len(n.urls))
+	n.lock.Lock()
+	for _, url := range n.urls {
+		// ids sort by creation time, so the deliveries are made in order after a restart
+		d := delivery{ID: fmt.Sprintf("%019d-%s", now.UnixNano(), uuid.New().String()), URL: url, Event: event, NextAttempt: now}
+		n.pending[url] = append(n.pending[url], d)
+		n.reserved[d.ID] = true
+		deliveries = append(deliveries, d)
+	}
+	n.lock.Unlock()
+
+	return func() {
+		for _, d := range deliveries {
+			err := n.outbox.put(d.ID, d)
+			if err != nil {
+				logrus.Errorf("Not possible to persist the notification of the event %d to '%s'; it will not be sent: %v", event.Seq, d.URL, err)
+				n.replace(d, true)
+			}
+			n.lock.Lock()
+			delete(n.reserved, d.ID)
+			n.lock.Unlock()
+		}
+		select {
+		case n.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run delivers the due notifications until stopped
+func (n *notifier) run() {
+	defer close(n.done)
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		n.deliverDue()
+		select {
+		case <-n.quit:
+			return
+		case <-n.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue attempts the due deliveries. A webhook whose oldest delivery is not due, not persisted yet, or fails, gets
+// nothing else until it succeeds
+func (n *notifier) deliverDue() {
+	n.lock.Lock()
+	urls := make([]string, 0, len(n.pending))
+	for url := range n.pending {
+		urls = append(urls, url)
+	}
+	n.lock.Unlock()
+
+	for _, url := range urls {
+		for {
+			select {
+			case <-n.quit:
+				return
+			default:
+			}
+
+			n.lock.Lock()
+			queue := n.pending[url]
+			if len(queue) == 0 || n.reserved[queue[0].ID] || time.Now().Before(queue[0].NextAttempt) {
+				n.lock.Unlock()
+				break
+			}
+			d := queue[0]
+			n.lock.Unlock()
+
+			done := n.attempt(&d)
+			n.replace(d, done)
+			if !done {
+				break
+			}
+		}
+	}
+}
+
+// replace replaces the pending delivery by its new state, or removes it when done with
+func (n *notifier) replace(d delivery, done bool) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	queue := n.pending[d.URL]
+	for i := range queue {
+		if queue[i].ID != d.ID {
+			continue
+		}
+		if !done {
+			queue[i] = d
+		} else if len(queue) == 1 {
+			delete(n.pending, d.URL)
+		} else {
+			n.pending[d.URL] = append(queue[:i], queue[i+1:]...)
+		}
+		return
+	}
+}
+
+// attempt delivers the notification, telling whether it is done with, delivered or out of attempts. Otherwise its next
+// attempt is scheduled and persisted
+func (n *notifier) attempt(d *delivery) bool {
+	err := n.post(*d)
+	if err == nil {
+		webhookDeliveries.WithLabelValues("delivered").Inc()
+		_ = n.outbox.remove(d.ID)
+		return true
+	}
+	d.Attempts++
+	d.LastError = err.Error()
+	if d.Attempts >= n.maxAttempts {
+		webhookDeliveries.WithLabelValues("dropped").Inc()
+		logrus.Errorf("Giving up notifying the event %d to '%s' after %d attempts: %v", d.Event.Seq, d.URL, d.Attempts, err)
+		_ = n.outbox.remove(d.ID)
+		return true
+	}
+	webhookDeliveries.WithLabelValues("failed").Inc()
+	d.NextAttempt = time.Now().Add(webhookBackoff(d.Attempts))
+	logrus.Warnf("Not possible to notify the event %d to '%s'; retrying at %v: %v", d.Event.Seq, d.URL, d.NextAttempt, err)
+	if err := n.outbox.put(d.ID, d); err != nil {
+		logrus.Errorf("Not possible to persist the webhook notification '%s': %v", d.ID, err)
+	}
+	return false
+}
+
+// post sends the event to the webhook; any status other than 2xx is a failure
+func (n *notifier) post(d delivery) error {
+	body, err := json.Marshal(d.Event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, d.Event.Type)
+	req.Header.Set(DeliveryHeader, d.ID)
+	req.Header.Set(SignatureHeader, Sign(n.secret, body))
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// stop stops delivering, waiting for the delivery being made. The deliveries left are kept in the outbox
+func (n *notifier) stop(ctx context.Context) error {
+	n.stopOnce.Do(func() { close(n.quit) })
+	select {
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// webhookBackoff returns the wait before the next attempt of a delivery, doubling on every attempt up to webhookMaxBackoff
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookInitialBackoff
+	for i := 1; i < attempts && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > webhookMaxBackoff {
+		backoff = webhookMaxBackoff
+	}
+	return backoff
+}
+
+// Sign returns the signature of the webhook payload sent in the SignatureHeader: "sha256=" followed by the hex encoded HMAC-SHA256
+// of the payload keyed by the secret
+func Sign(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
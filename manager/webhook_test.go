@@ -0,0 +1,181 @@
+package manager
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const webhookBasePath = "./data-webhook"
+
+// webhookReceiver records the notifications received, failing the first ones with the given statuses
+type webhookReceiver struct {
+	lock     sync.Mutex
+	statuses []int
+	received []*http.Request
+	bodies   [][]byte
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wr.lock.Lock()
+	defer wr.lock.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	wr.received = append(wr.received, r)
+	wr.bodies = append(wr.bodies, body)
+	if len(wr.statuses) > 0 {
+		w.WriteHeader(wr.statuses[0])
+		wr.statuses = wr.statuses[1:]
+	}
+}
+
+func (wr *webhookReceiver) count() int {
+	wr.lock.Lock()
+	defer wr.lock.Unlock()
+	return len(wr.received)
+}
+
+func TestWebhookNotifications(t *testing.T) {
+	_ = os.RemoveAll(webhookBasePath)
+	defer os.RemoveAll(webhookBasePath)
+	receiver := &webhookReceiver{statuses: []int{http.StatusInternalServerError}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	m, err := (&Builder{WebhookURLs: []string{server.URL}, WebhookSecret: "secret"}).New(new(MockDNSUpdater), webhookBasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.notifier.stop(context.Background())
+
+	record := hookTypes.DNSRecord{Name: "hook.test.com", Value: "0.0.0.1", Type: "A"}
+	_ = m.AddDNSRecord(context.Background(), record)
+	record.Value = "0.0.0.2"
+	_ = m.UpdateDNSRecord(context.Background(), record)
+
+	// the first attempt fails, so both are delivered after the backoff, in order
+	waitFor(func() bool { return receiver.count() == 3 })
+	time.Sleep(50 * time.Millisecond)
+	if count := receiver.count(); count != 3 {
+		t.Fatalf("Expecting a failed attempt and two deliveries. Got %d requests", count)
+	}
+
+	expected := []string{EventAdd, EventAdd, EventUpdate}
+	for i, r := range receiver.received {
+		if r.Header.Get(EventHeader) != expected[i] {
+			t.Errorf("Expecting the request %d to notify '%s'. Got '%s'", i, expected[i], r.Header.Get(EventHeader))
+		}
+		if signature := r.Header.Get(SignatureHeader); signature != Sign([]byte("secret"), receiver.bodies[i]) {
+			t.Errorf("Expecting the request %d to be signed. Got '%s'", i, signature)
+		}
+	}
+	if receiver.received[0].Header.Get(DeliveryHeader) != receiver.received[1].Header.Get(DeliveryHeader) {
+		t.Error("Expecting the retry to be sent with the same delivery id")
+	}
+	if ids := m.notifier.outbox.ids(); len(ids) != 0 {
+		t.Errorf("Expecting the outbox to be emptied. Got %v", ids)
+	}
+}
+
+func TestWebhookRequiresSecret(t *testing.T) {
+	_ = os.RemoveAll(webhookBasePath)
+	defer os.RemoveAll(webhookBasePath)
+
+	if _, err := (&Builder{WebhookURLs: []string{"http://hook.test.com"}}).New(new(MockDNSUpdater), webhookBasePath); err == nil {
+		t.Error("Expecting the manager not to start with webhooks and no secret to sign the notifications")
+	}
+}
+
+func TestWebhookOutboxSurvivesRestart(t *testing.T) {
+	_ = os.RemoveAll(webhookBasePath)
+	defer os.RemoveAll(webhookBasePath)
+	receiver := new(webhookReceiver)
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	n := newNotifier([]string{server.URL}, "secret", 0, 0, webhookBasePath)
+	_ = n.stop(context.Background())
+	n.reserve(Event{Seq: 1, Type: EventAdd})()
+	if ids := n.outbox.ids(); len(ids) != 1 {
+		t.Fatalf("Expecting the notification to be kept in the outbox. Got %v", ids)
+	}
+
+	n = newNotifier([]string{server.URL}, "secret", 0, 0, webhookBasePath)
+	defer n.stop(context.Background())
+	waitFor(func() bool { return receiver.count() == 1 })
+	if count := receiver.count(); count != 1 {
+		t.Errorf("Expecting the notification left in the outbox to be delivered on restart. Got %d requests", count)
+	}
+}
+
+func TestWebhookDeliveredInEventOrder(t *testing.T) {
+	_ = os.RemoveAll(webhookBasePath)
+	defer os.RemoveAll(webhookBasePath)
+	receiver := new(webhookReceiver)
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	n := newNotifier([]string{server.URL}, "secret", 0, 0, webhookBasePath)
+	defer n.stop(context.Background())
+	first := n.reserve(Event{Seq: 1, Type: EventAdd})
+	second := n.reserve(Event{Seq: 2, Type: EventUpdate})
+
+	// the second event persisted first waits for the first one
+	second()
+	time.Sleep(50 * time.Millisecond)
+	if count := receiver.count(); count != 0 {
+		t.Fatalf("Expecting nothing to be delivered before the first event is persisted. Got %d requests", count)
+	}
+	first()
+	waitFor(func() bool { return receiver.count() == 2 })
+	if count := receiver.count(); count != 2 || receiver.received[0].Header.Get(EventHeader) != EventAdd || receiver.received[1].Header.Get(EventHeader) != EventUpdate {
+		t.Errorf("Expecting both events to be delivered in order. Got %d requests", count)
+	}
+}
+
+func TestWebhookGivesUp(t *testing.T) {
+	_ = os.RemoveAll(webhookBasePath)
+	defer os.RemoveAll(webhookBasePath)
+	receiver := &webhookReceiver{statuses: []int{http.StatusBadGateway}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	n := newNotifier([]string{server.URL}, "secret", 0, 1, webhookBasePath)
+	defer n.stop(context.Background())
+	n.reserve(Event{Seq: 1, Type: EventAdd})()
+	waitFor(func() bool { return len(n.outbox.ids()) == 0 })
+	if count := receiver.count(); count != 1 {
+		t.Errorf("Expecting a single attempt. Got %d requests", count)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{20, webhookMaxBackoff},
+	}
+
+	for _, test := range tests {
+		if got := webhookBackoff(test.attempts); got != test.expected {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", test.attempts, got, test.expected)
+		}
+	}
+}
+
+// waitFor waits up to 5 seconds for the condition to hold
+func waitFor(cond func() bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = waitUntil(ctx, cond)
+}
@@ -0,0 +1,84 @@
+package nsupdate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ChangeAdd adds the record
+	ChangeAdd = "add"
+	// ChangeUpdate replaces the records of the name and type with the record
+	ChangeUpdate = "update"
+	// ChangeRemove removes the records of the name and type
+	ChangeRemove = "remove"
+)
+
+// Change a change to a record, part of a batch
+type Change struct {
+	Type   string
+	Record hookTypes.DNSRecord
+}
+
+// BatchUpdater defines an interface to apply several changes atomically
+type BatchUpdater interface {
+	ApplyChanges(ctx context.Context, changes []Change, ttl time.Duration) error
+}
+
+// ApplyChanges applies the changes in a single update message, which the nameserver applies atomically: either every change is
+// applied or none is
+func (nsu *NSUpdate) ApplyChanges(ctx context.Context, changes []Change, ttl time.Duration) (err error) {
+	if len(changes) == 0 {
+		return nil
+	}
+	cmd, err := nsu.buildBatchCommand(changes, ttl)
+	if err != nil {
+		return
+	}
+	logrus.Infof("cmd to be executed: %s", cmd)
+	if err = nsu.ExecuteCommand(ctx, cmd); err != nil || !nsu.Verify {
+		return
+	}
+	// every change is verified, a change not served as expected being reported over one that could not be verified
+	for _, change := range changes {
+		name, _ := nsu.normalizeName(change.Record.Name)
+		var verr error
+		switch change.Type {
+		case ChangeRemove:
+			verr = nsu.verify(ctx, name, change.Record.Type, "", 0, false)
+		default:
+			verr = nsu.verify(ctx, name, change.Record.Type, change.Record.Value, ttl, change.Type == ChangeUpdate)
+		}
+		if e, ok := verr.(*VerificationError); ok && (err == nil || (!e.QueryFailed && err.(*VerificationError).QueryFailed)) {
+			err = verr
+		}
+	}
+	return
+}
+
+// buildBatchCommand builds the nsupdate commands of the changes, sent in a single update message
+func (nsu *NSUpdate) buildBatchCommand(changes []Change, ttl time.Duration) (string, error) {
+	var commands []string
+	for _, change := range changes {
+		name, err := nsu.normalizeName(change.Record.Name)
+		if err != nil {
+			return "", err
+		}
+		switch change.Type {
+		case ChangeAdd:
+			commands = append(commands, nsu.buildAddCommand(name, change.Record.Type, change.Record.Value, ttl))
+		case ChangeUpdate:
+			commands = append(commands, nsu.buildDeleteCommand(name, change.Record.Type), nsu.buildAddCommand(name, change.Record.Type, change.Record.Value, ttl))
+		case ChangeRemove:
+			commands = append(commands, nsu.buildDeleteCommand(name, change.Record.Type))
+		default:
+			return "", fmt.Errorf("unknown change type '%s'", change.Type)
+		}
+	}
+	return strings.Join(commands, "\n"), nil
+}
@@ -0,0 +1,52 @@
+package nsupdate
+
+import (
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+func TestNSUpdate_buildBatchCommand(t *testing.T) {
+	nsu := &NSUpdate{Builder: Builder{Zone: "test.com"}}
+	tests := []struct {
+		name    string
+		changes []Change
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "changes",
+			changes: []Change{
+				{Type: ChangeAdd, Record: hookTypes.DNSRecord{Name: "App.test.com", Value: "0.0.0.1", Type: "A"}},
+				{Type: ChangeUpdate, Record: hookTypes.DNSRecord{Name: "www.test.com", Value: "app.test.com.", Type: "CNAME"}},
+				{Type: ChangeRemove, Record: hookTypes.DNSRecord{Name: "old.test.com", Type: "A"}},
+			},
+			want: "update add app.test.com 60 A 0.0.0.1\n" +
+				"update delete www.test.com CNAME\n" +
+				"update add www.test.com 60 CNAME app.test.com.\n" +
+				"update delete old.test.com A",
+		},
+		{
+			name:    "out of the zone",
+			changes: []Change{{Type: ChangeAdd, Record: hookTypes.DNSRecord{Name: "app.other.com", Value: "0.0.0.1", Type: "A"}}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown change",
+			changes: []Change{{Type: "replace", Record: hookTypes.DNSRecord{Name: "app.test.com", Value: "0.0.0.1", Type: "A"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nsu.buildBatchCommand(tt.changes, time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildBatchCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("buildBatchCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package nsupdate
 
 import (
+	"strings"
+	"time"
+
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
@@ -12,16 +15,45 @@ const (
 	nameServerKeyFile     = nameServerPrefix + "key-file"
 	nameServerZone        = nameServerPrefix + "zone"
 	debug                 = "debug"
+	updateTimeout         = "update-timeout"
+	updateVerify          = "update-verify"
 	defaultNameServerPort = "53"
+	defaultUpdateTimeout  = 30 * time.Second
+
+	reversePrefix  = "reverse."
+	reverseZone    = reversePrefix + "zone"
+	reverseKeyFile = reversePrefix + "key-file"
+
+	retryPrefix           = "retry."
+	retryAttempts         = retryPrefix + "attempts"
+	retryInitialBackoff   = retryPrefix + "initial-backoff"
+	retryMaxBackoff       = retryPrefix + "max-backoff"
+	retryMaxElapsed       = retryPrefix + "max-elapsed"
+	retryRcodes           = retryPrefix + "rcodes"
+	defaultRetryAttempts  = 3
+	defaultInitialBackoff = 200 * time.Millisecond
+	defaultMaxBackoff     = 5 * time.Second
+	defaultMaxElapsed     = 30 * time.Second
 )
 
+var defaultRetryRcodes = []string{"SERVFAIL", RcodeTimeout, RcodeConnRefused}
+
 // AddFlags adds flags for Builder.
 func AddFlags(flags *pflag.FlagSet) {
 	flags.String(nameServerAddress, "", "Address of the nameserver that an instance of a Bindman will manage")
 	flags.String(nameServerPort, defaultNameServerPort, "Custom port for communication with the nameserver")
 	flags.String(nameServerKeyFile, "", `Zone key-file name that will be used to authenticate with the nameserver. MUST be inside the /data volume`)
 	flags.String(nameServerZone, "", "The name of the zone a bindman-dns-bind9 instance is able to manage")
+	flags.String(reverseZone, "", "The name of the reverse zone (in-addr.arpa or ip6.arpa) where the PTR records of the A and AAAA records are maintained. Empty disables the PTR records")
+	flags.String(reverseKeyFile, "", "Reverse zone key-file name. MUST be inside the /data volume. Defaults to the key-file of the zone")
 	flags.BoolP(debug, "d", false, "The name of the zone a bindman-dns-bind9 instance is able to manage")
+	flags.Duration(updateTimeout, defaultUpdateTimeout, "Maximum time a DNS update may take, retries included. The nsupdate process is killed when it is exceeded. Zero means no limit")
+	flags.Bool(updateVerify, false, "Verify every change is served by querying the nameserver once applied, failing the change when it is not")
+	flags.Int(retryAttempts, defaultRetryAttempts, "Maximum number of times a nsupdate command is executed when it fails with a transient error")
+	flags.Duration(retryInitialBackoff, defaultInitialBackoff, "Upper bound of the randomized wait before the first retry of a nsupdate command; it doubles on every retry")
+	flags.Duration(retryMaxBackoff, defaultMaxBackoff, "Maximum upper bound of the randomized wait between two retries of a nsupdate command")
+	flags.Duration(retryMaxElapsed, defaultMaxElapsed, "Maximum time spent retrying a nsupdate command. Zero means no limit")
+	flags.StringSlice(retryRcodes, defaultRetryRcodes, "Comma separated list of the DNS rcodes (and the TIMEOUT and CONNREFUSED transport conditions) considered transient and thus retried")
 }
 
 // InitFromViper initializes Builder with properties retrieved from Viper.
@@ -30,6 +62,29 @@ func (b *Builder) InitFromViper(v *viper.Viper) *Builder {
 	b.Port = v.GetString(nameServerPort)
 	b.KeyFile = v.GetString(nameServerKeyFile)
 	b.Zone = v.GetString(nameServerZone)
+	b.ReverseZone = v.GetString(reverseZone)
+	b.ReverseKeyFile = v.GetString(reverseKeyFile)
 	b.Debug = v.GetBool(debug)
+	b.Timeout = v.GetDuration(updateTimeout)
+	b.Verify = v.GetBool(updateVerify)
+	b.Retry = RetryPolicy{
+		Attempts:        v.GetInt(retryAttempts),
+		InitialBackoff:  v.GetDuration(retryInitialBackoff),
+		MaxBackoff:      v.GetDuration(retryMaxBackoff),
+		MaxElapsed:      v.GetDuration(retryMaxElapsed),
+		RetryableRcodes: getList(v, retryRcodes),
+	}
 	return b
 }
+
+// getList reads a list property, accepting comma separated values as the ones coming from environment variables
+func getList(v *viper.Viper, key string) (list []string) {
+	for _, item := range v.GetStringSlice(key) {
+		for _, value := range strings.Split(item, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				list = append(list, value)
+			}
+		}
+	}
+	return
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 func TestBingFlags(t *testing.T) {
@@ -25,7 +26,16 @@ func TestBingFlags(t *testing.T) {
 		fmt.Sprintf("--%s=%s", nameServerPort, port),
 		fmt.Sprintf("--%s=%s", nameServerKeyFile, keyFile),
 		fmt.Sprintf("--%s=%s", nameServerZone, zone),
+		fmt.Sprintf("--%s=%s", reverseZone, "0.10.in-addr.arpa"),
+		fmt.Sprintf("--%s=%s", reverseKeyFile, "K0.10.in-addr.arpa.+157+12345.key"),
 		fmt.Sprintf("--%s=%t", debug, true),
+		fmt.Sprintf("--%s=%s", updateTimeout, "5s"),
+		fmt.Sprintf("--%s=%t", updateVerify, true),
+		fmt.Sprintf("--%s=%d", retryAttempts, 5),
+		fmt.Sprintf("--%s=%s", retryInitialBackoff, "1s"),
+		fmt.Sprintf("--%s=%s", retryMaxBackoff, "10s"),
+		fmt.Sprintf("--%s=%s", retryMaxElapsed, "1m"),
+		fmt.Sprintf("--%s=%s", retryRcodes, "SERVFAIL,TIMEOUT"),
 	})
 	require.NoError(t, err)
 
@@ -36,7 +46,18 @@ func TestBingFlags(t *testing.T) {
 	assert.Equal(t, port, b.Port)
 	assert.Equal(t, keyFile, b.KeyFile)
 	assert.Equal(t, zone, b.Zone)
+	assert.Equal(t, "0.10.in-addr.arpa", b.ReverseZone)
+	assert.Equal(t, "K0.10.in-addr.arpa.+157+12345.key", b.ReverseKeyFile)
 	assert.Equal(t, true, b.Debug)
+	assert.Equal(t, 5*time.Second, b.Timeout)
+	assert.Equal(t, true, b.Verify)
+	assert.Equal(t, RetryPolicy{
+		Attempts:        5,
+		InitialBackoff:  time.Second,
+		MaxBackoff:      10 * time.Second,
+		MaxElapsed:      time.Minute,
+		RetryableRcodes: []string{"SERVFAIL", RcodeTimeout},
+	}, b.Retry)
 }
 
 func TestDefaultValues(t *testing.T) {
@@ -50,4 +71,20 @@ func TestDefaultValues(t *testing.T) {
 
 	assert.Equal(t, defaultNameServerPort, b.Port)
 	assert.Equal(t, false, b.Debug)
+	assert.Equal(t, defaultUpdateTimeout, b.Timeout)
+	assert.Equal(t, defaultRetryAttempts, b.Retry.Attempts)
+	assert.Equal(t, defaultInitialBackoff, b.Retry.InitialBackoff)
+	assert.Equal(t, defaultMaxBackoff, b.Retry.MaxBackoff)
+	assert.Equal(t, defaultMaxElapsed, b.Retry.MaxElapsed)
+	assert.Equal(t, defaultRetryRcodes, b.Retry.RetryableRcodes)
+}
+
+func TestRetryRcodesFromEnvironment(t *testing.T) {
+	v := viper.New()
+	v.Set(retryRcodes, "SERVFAIL, CONNREFUSED")
+
+	b := &Builder{}
+	b.InitFromViper(v)
+
+	assert.Equal(t, []string{"SERVFAIL", RcodeConnRefused}, b.Retry.RetryableRcodes)
 }
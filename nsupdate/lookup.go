@@ -0,0 +1,50 @@
+package nsupdate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/miekg/dns"
+)
+
+// NameLookup defines an interface to query the records served by the DNS Server
+type NameLookup interface {
+	// LookupName lists every record served for the name, of any type
+	LookupName(ctx context.Context, name string) ([]hookTypes.DNSRecord, error)
+}
+
+// LookupName lists every record served for the name by the nameserver. The ANY query is sent over TCP, so the nameserver answers
+// with the full set of records instead of a minimal one
+func (nsu *NSUpdate) LookupName(ctx context.Context, name string) ([]hookTypes.DNSRecord, error) {
+	name, err := nsu.normalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := dns.Fqdn(nsu.getOwnerName(name))
+	msg, err := nsu.exchange(ctx, nsu.address(), owner, dns.TypeANY)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("lookup of %s interrupted: %w", name, ctxErr)
+		}
+		return nil, fmt.Errorf("lookup of %s failed: %w", name, err)
+	}
+	if msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("lookup of %s failed: the nameserver answered %s", name, dns.RcodeToString[msg.Rcode])
+	}
+
+	records := []hookTypes.DNSRecord{}
+	for _, rr := range msg.Answer {
+		if !strings.EqualFold(rr.Header().Name, owner) {
+			continue
+		}
+		records = append(records, hookTypes.DNSRecord{
+			Name:  strings.TrimSuffix(rr.Header().Name, "."),
+			Type:  dns.TypeToString[rr.Header().Rrtype],
+			Value: rdata(rr),
+		})
+	}
+	return records, nil
+}
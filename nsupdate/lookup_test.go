@@ -0,0 +1,43 @@
+package nsupdate
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+func TestNSUpdate_LookupName(t *testing.T) {
+	port, shutdown := serveZone(t,
+		"app.test.com. 3600 IN A 10.0.0.1",
+		"app.test.com. 3600 IN TXT \"v=spf1 -all\"",
+		"app.test.com. 3600 IN MX 10 mail.test.com.",
+		"www.test.com. 3600 IN CNAME app.test.com.",
+	)
+	defer shutdown()
+	nsu := &NSUpdate{Builder{Server: "127.0.0.1", Port: port, Zone: "test.com", Timeout: time.Second}}
+
+	records, err := nsu.LookupName(context.Background(), "App.test.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []hookTypes.DNSRecord{
+		{Name: "app.test.com", Type: "A", Value: "10.0.0.1"},
+		{Name: "app.test.com", Type: "TXT", Value: `"v=spf1 -all"`},
+		{Name: "app.test.com", Type: "MX", Value: "10 mail.test.com."},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("LookupName() = %v, want %v", records, expected)
+	}
+
+	if records, err := nsu.LookupName(context.Background(), "gone.test.com"); err != nil || len(records) != 0 {
+		t.Errorf("LookupName() = %v, err %v, want no record", records, err)
+	}
+
+	shutdown()
+	if _, err := nsu.LookupName(context.Background(), "app.test.com"); err == nil {
+		t.Error("LookupName() want an error when the nameserver cannot be queried")
+	}
+}
@@ -23,6 +23,8 @@ func (nsu *NSUpdate) check() (success bool, errs []string) {
 
 	if strings.TrimSpace(nsu.Zone) == "" {
 		errs = append(errs, fmt.Sprintf(errMsg, "DNS zone"))
+	} else if _, err := NormalizeName(nsu.Zone); err != nil {
+		errs = append(errs, fmt.Sprintf("The DNS zone is not valid: %v", err))
 	}
 
 	// TODO: Test connection
@@ -34,25 +36,62 @@ func (nsu *NSUpdate) getKeyFilePath() string {
 	return path.Join(nsu.BasePath, nsu.KeyFile)
 }
 
-// getSubdomainName we expect names to come in the format subdomain.zone. This function returns the subdomain part
+// getSubdomainName we expect names to come in the format subdomain.zone. This function returns the subdomain part; it is empty for the zone apex
 func (nsu *NSUpdate) getSubdomainName(name string) string {
+	if name == nsu.Zone {
+		return ""
+	}
 	return strings.TrimSuffix(name, "."+nsu.Zone)
 }
 
-// checkName checks if the name is in the expected format: subdomain.zone
-func (nsu *NSUpdate) checkName(name string) (err error) {
-	if !strings.HasSuffix(name, "."+nsu.Zone) {
-		err = types.BadRequestError(fmt.Sprintf("the record name '%s' is not allowed. Must obey the following pattern: '<subdomain>.%s'", name, nsu.Zone), nil)
+// getOwnerName returns the name the record is owned by in the nsupdate commands: the zone itself for the zone apex,
+// or else subdomain.zone
+func (nsu *NSUpdate) getOwnerName(name string) string {
+	if subdomain := nsu.getSubdomainName(name); subdomain != "" {
+		return subdomain + "." + nsu.Zone
+	}
+	return nsu.Zone
+}
+
+// checkName checks if the name is in the expected format, once normalized: the zone apex, or subdomain.zone where a wildcard '*'
+// may only be the whole leftmost label of the subdomain, as in *.subdomain.zone
+func (nsu *NSUpdate) checkName(name string) error {
+	_, err := nsu.normalizeName(name)
+	return err
+}
+
+// normalizeName returns the canonical form of the name, checking it is in the expected format
+func (nsu *NSUpdate) normalizeName(name string) (string, error) {
+	canonical, err := NormalizeName(name)
+	if err != nil {
+		return "", err
+	}
+	zone, _ := NormalizeName(nsu.Zone)
+	if canonical == zone {
+		return canonical, nil
+	}
+	if !strings.HasSuffix(canonical, "."+zone) || !validSubdomain(strings.TrimSuffix(canonical, "."+zone)) {
+		return "", types.BadRequestError(fmt.Sprintf("the record name '%s' is not allowed. Must obey the following pattern: '<subdomain>.%s'", name, nsu.Zone), nil)
+	}
+	return canonical, nil
+}
+
+// validSubdomain tells whether the subdomain has no empty label, and no wildcard other than a whole leftmost label
+func validSubdomain(subdomain string) bool {
+	for i, label := range strings.Split(subdomain, ".") {
+		if label == "" || (strings.Contains(label, "*") && (i > 0 || label != "*")) {
+			return false
+		}
 	}
-	return
+	return true
 }
 
 // buildAddCommand builds a nsupdate add command
 func (nsu *NSUpdate) buildAddCommand(recordName, recordType, value string, ttl time.Duration) string {
-	return fmt.Sprintf("update add %s.%s %d %s %s", nsu.getSubdomainName(recordName), nsu.Zone, int(ttl.Seconds()), recordType, value)
+	return fmt.Sprintf("update add %s %d %s %s", nsu.getOwnerName(recordName), int(ttl.Seconds()), recordType, value)
 }
 
 // buildDeleteCommand builds a nsupdate delete command
 func (nsu *NSUpdate) buildDeleteCommand(recordName, recordType string) string {
-	return fmt.Sprintf("update delete %s.%s %s", nsu.getSubdomainName(recordName), nsu.Zone, recordType)
+	return fmt.Sprintf("update delete %s %s", nsu.getOwnerName(recordName), recordType)
 }
@@ -2,6 +2,7 @@ package nsupdate
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -40,6 +41,18 @@ func TestNSUpdate_buildDeleteCommand(t *testing.T) {
 			args:   args{"subdomain.example.test.com", "TXT"},
 			want:   "update delete subdomain.example.test.com TXT",
 		},
+		{
+			name:   "apex",
+			fields: fields{Builder: Builder{Zone: "test.com"}},
+			args:   args{"test.com", "MX"},
+			want:   "update delete test.com MX",
+		},
+		{
+			name:   "wildcard",
+			fields: fields{Builder: Builder{Zone: "test.com"}},
+			args:   args{"*.apps.test.com", "A"},
+			want:   "update delete *.apps.test.com A",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -87,6 +100,18 @@ func TestNSUpdate_buildAddCommand(t *testing.T) {
 			args:   args{"subdomain.example.test.com", "TXT", "subdomain_example", time.Second},
 			want:   "update add subdomain.example.test.com 1 TXT subdomain_example",
 		},
+		{
+			name:   "apex",
+			fields: fields{Builder: Builder{Zone: "test.com."}},
+			args:   args{"test.com.", "TXT", "v=spf1", time.Hour},
+			want:   "update add test.com. 3600 TXT v=spf1",
+		},
+		{
+			name:   "wildcard",
+			fields: fields{Builder: Builder{Zone: "test.com"}},
+			args:   args{"*.apps.test.com", "A", "0.0.0.0", time.Hour},
+			want:   "update add *.apps.test.com 3600 A 0.0.0.0",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -172,7 +197,9 @@ func TestGetSubdomainName(t *testing.T) {
 		{"a.test.com.", "a"},
 		{"www.test.com.", "www"},
 		{"www1.test.com.", "www1"},
-		{"test.com.", "test.com."},
+		{"test.com.", ""},
+		{"*.test.com.", "*"},
+		{"*.apps.test.com.", "*.apps"},
 		{"_.test.com.", "_"},
 		{"subdomain.test.com.", "subdomain"},
 		{"subdomain.test.com.br.", "subdomain.test.com.br."},
@@ -197,25 +224,38 @@ func TestCheckName(t *testing.T) {
 	nsUpdate := NSUpdate{Builder{Zone: "test.com.", Server: "localhost", Debug: true, Port: "53", KeyFile: "Ktest.com.+157+50086.key"}}
 
 	errorMsg := "the record name '%s' is not allowed. Must obey the following pattern: '<subdomain>.%s'"
+	invalidMsg := "the record name '%s' is not a valid domain name: %s"
 
 	tests := []struct {
 		name     string
 		expected error
 	}{
 		{"teste.io.", types.BadRequestError(fmt.Sprintf(errorMsg, "teste.io.", nsUpdate.Zone), nil)},
-		{".test.com", types.BadRequestError(fmt.Sprintf(errorMsg, ".test.com", nsUpdate.Zone), nil)},
-		{"test.com.", types.BadRequestError(fmt.Sprintf(errorMsg, "test.com.", nsUpdate.Zone), nil)},
-		{"subdomain.test.com", types.BadRequestError(fmt.Sprintf(errorMsg, "subdomain.test.com", nsUpdate.Zone), nil)},
+		{"etest.com.", types.BadRequestError(fmt.Sprintf(errorMsg, "etest.com.", nsUpdate.Zone), nil)},
 		{"subdomain.test.com.br", types.BadRequestError(fmt.Sprintf(errorMsg, "subdomain.test.com.br", nsUpdate.Zone), nil)},
-		{"subdomain.subdomain.test.com", types.BadRequestError(fmt.Sprintf(errorMsg, "subdomain.subdomain.test.com", nsUpdate.Zone), nil)},
 		{"subdomain.teste.com", types.BadRequestError(fmt.Sprintf(errorMsg, "subdomain.teste.com", nsUpdate.Zone), nil)},
 		{"subdomain.teste.com.", types.BadRequestError(fmt.Sprintf(errorMsg, "subdomain.teste.com.", nsUpdate.Zone), nil)},
 		{"subdomain.etest.com", types.BadRequestError(fmt.Sprintf(errorMsg, "subdomain.etest.com", nsUpdate.Zone), nil)},
 		{"subdomain.etest.com.", types.BadRequestError(fmt.Sprintf(errorMsg, "subdomain.etest.com.", nsUpdate.Zone), nil)},
 		{"subdomain.teste.com.br.", types.BadRequestError(fmt.Sprintf(errorMsg, "subdomain.teste.com.br.", nsUpdate.Zone), nil)},
+		{"a.*.test.com.", types.BadRequestError(fmt.Sprintf(errorMsg, "a.*.test.com.", nsUpdate.Zone), nil)},
+		{".test.com", types.BadRequestError(fmt.Sprintf(invalidMsg, ".test.com", "it has an empty label"), nil)},
+		{".test.com.", types.BadRequestError(fmt.Sprintf(invalidMsg, ".test.com.", "it has an empty label"), nil)},
+		{"a..test.com.", types.BadRequestError(fmt.Sprintf(invalidMsg, "a..test.com.", "it has an empty label"), nil)},
+		{"a*.test.com.", types.BadRequestError(fmt.Sprintf(invalidMsg, "a*.test.com.", "the label 'a*' has the character '*'"), nil)},
+		{"**.test.com.", types.BadRequestError(fmt.Sprintf(invalidMsg, "**.test.com.", "the label '**' has the character '*'"), nil)},
 		{"subdomain.subdomain.test.com.", nil},
 		{"subdomain.test.com.", nil},
 		{"a.test.com.", nil},
+		{"test.com.", nil},
+		{"*.test.com.", nil},
+		{"*.apps.test.com.", nil},
+		{"_sip._tcp.test.com.", nil},
+		// fully qualified or not, in any case
+		{"subdomain.test.com", nil},
+		{"subdomain.subdomain.test.com", nil},
+		{"Web.Test.COM", nil},
+		{"bücher.test.com", nil},
 	}
 
 	for _, test := range tests {
@@ -235,6 +275,42 @@ func TestCheckName(t *testing.T) {
 
 }
 
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		wantErr  bool
+	}{
+		{"web.test.com", "web.test.com", false},
+		{"Web.Test.COM.", "web.test.com", false},
+		{" web.test.com. ", "web.test.com", false},
+		{"bücher.test.com", "xn--bcher-kva.test.com", false},
+		{"xn--bcher-kva.test.com", "xn--bcher-kva.test.com", false},
+		{"*.apps.test.com", "*.apps.test.com", false},
+		{"_sip._tcp.test.com", "_sip._tcp.test.com", false},
+		{strings.Repeat("a", MaxLabelLength) + ".test.com", strings.Repeat("a", MaxLabelLength) + ".test.com", false},
+		{strings.Repeat("a", MaxLabelLength+1) + ".test.com", "", true},
+		{strings.Repeat("a.", 123) + "test.com", "", true},
+		{"", "", true},
+		{".", "", true},
+		{"a b.test.com", "", true},
+		{"a/b.test.com", "", true},
+		{"-a.test.com", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NormalizeName(test.name)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NormalizeName() err = %v, want an error: %v", err, test.wantErr)
+			}
+			if got != test.expected {
+				t.Errorf("NormalizeName() = %v, want %v", got, test.expected)
+			}
+		})
+	}
+}
+
 func TestNSUpdate_getKeyFilePath(t *testing.T) {
 	type fields struct {
 		Builder *Builder
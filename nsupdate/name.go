@@ -0,0 +1,61 @@
+package nsupdate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"golang.org/x/net/idna"
+)
+
+const (
+	// MaxLabelLength the maximum length of a label of a domain name, in octets
+	MaxLabelLength = 63
+	// MaxNameLength the maximum length of a domain name in its textual form, without the trailing dot
+	MaxNameLength = 253
+)
+
+// names maps the names as for a lookup, lower casing them and converting the IDNs to punycode, but leaves the characters
+// disallowed in host names, such as '_' and '*', to be validated by NormalizeName
+var names = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false), idna.Transitional(false))
+
+// NormalizeName returns the canonical form of the domain name: without the trailing dot, lower cased, with its internationalized
+// labels converted to punycode. It returns a bad request error when the name is empty, has an empty label or a label with
+// characters other than letters, digits, '-' and '_' (but a single '*'), or exceeds the label or total length limits
+func NormalizeName(name string) (string, error) {
+	trimmed := strings.TrimSuffix(strings.TrimSpace(name), ".")
+	if trimmed == "" {
+		return "", types.BadRequestError("the record name must not be empty", nil)
+	}
+	canonical, err := names.ToASCII(trimmed)
+	if err != nil {
+		return "", types.BadRequestError(fmt.Sprintf("the record name '%s' is not a valid domain name", name), err)
+	}
+	if len(canonical) > MaxNameLength {
+		return "", types.BadRequestError(fmt.Sprintf("the record name '%s' is longer than %d characters", name, MaxNameLength), nil)
+	}
+	for _, label := range strings.Split(canonical, ".") {
+		if err := checkLabel(label); err != "" {
+			return "", types.BadRequestError(fmt.Sprintf("the record name '%s' is not a valid domain name: %s", name, err), nil)
+		}
+	}
+	return canonical, nil
+}
+
+// checkLabel checks a label of a canonical name, returning what is wrong with it, if anything
+func checkLabel(label string) string {
+	switch {
+	case label == "":
+		return "it has an empty label"
+	case len(label) > MaxLabelLength:
+		return fmt.Sprintf("the label '%s' is longer than %d characters", label, MaxLabelLength)
+	case label == "*":
+		return ""
+	}
+	for _, c := range label {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return fmt.Sprintf("the label '%s' has the character '%c'", label, c)
+		}
+	}
+	return ""
+}
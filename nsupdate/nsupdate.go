@@ -2,6 +2,7 @@ package nsupdate
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -21,6 +22,13 @@ type Builder struct {
 	BasePath string
 	Zone     string
 	Debug    bool
+	Retry    RetryPolicy
+	Timeout  time.Duration
+	// ReverseZone the zone where the PTR records are maintained, with the ReverseKeyFile or else the KeyFile
+	ReverseZone    string
+	ReverseKeyFile string
+	// Verify when set, every change is checked to be served by querying the nameserver once applied
+	Verify bool
 }
 
 // NSUpdate holds the information necessary to successfully run nsupdate requests
@@ -30,15 +38,25 @@ type NSUpdate struct {
 
 // DNSUpdater defines an interface to communicate with DNS Server via nsupdate commands
 type DNSUpdater interface {
-	RemoveRR(name, recordType string) (err error)
-	AddRR(record hookTypes.DNSRecord, ttl time.Duration) (err error)
-	UpdateRR(record hookTypes.DNSRecord, ttl time.Duration) (err error)
+	RemoveRR(ctx context.Context, name, recordType string) (err error)
+	AddRR(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration) (err error)
+	UpdateRR(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration) (err error)
+}
+
+// ReverseUpdater defines an interface to maintain the PTR records of a reverse zone via nsupdate commands
+type ReverseUpdater interface {
+	DNSUpdater
+	// InZone tells whether the name belongs to the reverse zone
+	InZone(name string) bool
 }
 
 // New constructs a new NSUpdate instance from environment variables
 func (b *Builder) New(basePath string) (*NSUpdate, error) {
 	b.BasePath = basePath
 	result := &NSUpdate{*b}
+	if zone, err := NormalizeName(b.Zone); err == nil {
+		result.Zone = zone
+	}
 
 	if succ, errs := result.check(); !succ {
 		return nil, fmt.Errorf("Errors encountered:\n\t%v", strings.Join(errs, "\n\t"))
@@ -46,47 +64,81 @@ func (b *Builder) New(basePath string) (*NSUpdate, error) {
 	return result, nil
 }
 
+// NewReverse constructs the NSUpdate instance of the reverse zone; it returns nil when no reverse zone is set
+func (b *Builder) NewReverse(basePath string) (*NSUpdate, error) {
+	if strings.TrimSpace(b.ReverseZone) == "" {
+		return nil, nil
+	}
+	reverse := *b
+	reverse.Zone = b.ReverseZone
+	if strings.TrimSpace(b.ReverseKeyFile) != "" {
+		reverse.KeyFile = b.ReverseKeyFile
+	}
+	reverse.ReverseZone, reverse.ReverseKeyFile = "", ""
+	return reverse.New(basePath)
+}
+
+// InZone tells whether the name belongs to the zone
+func (nsu *NSUpdate) InZone(name string) bool {
+	return nsu.checkName(name) == nil
+}
+
 // RemoveRR removes a Resource Record
-func (nsu *NSUpdate) RemoveRR(name, recordType string) (err error) {
-	err = nsu.checkName(name)
+func (nsu *NSUpdate) RemoveRR(ctx context.Context, name, recordType string) (err error) {
+	name, err = nsu.normalizeName(name)
 	if err == nil {
 		cmd := nsu.buildDeleteCommand(name, recordType)
 		logrus.Infof("cmd to be executed: %s", cmd)
-		err = nsu.ExecuteCommand(cmd)
+		err = nsu.ExecuteCommand(ctx, cmd)
+	}
+	if err == nil && nsu.Verify {
+		err = nsu.verify(ctx, name, recordType, "", 0, false)
 	}
 	return
 }
 
 // AddRR adds a Resource Record
-func (nsu *NSUpdate) AddRR(record hookTypes.DNSRecord, ttl time.Duration) (err error) {
-	err = nsu.checkName(record.Name)
+func (nsu *NSUpdate) AddRR(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration) (err error) {
+	record.Name, err = nsu.normalizeName(record.Name)
 	if err == nil {
 		cmd := nsu.buildAddCommand(record.Name, record.Type, record.Value, ttl)
 		logrus.Infof("cmd to be executed: %s", cmd)
-		err = nsu.ExecuteCommand(cmd)
+		err = nsu.ExecuteCommand(ctx, cmd)
+	}
+	if err == nil && nsu.Verify {
+		err = nsu.verify(ctx, record.Name, record.Type, record.Value, ttl, false)
 	}
 	return
 }
 
 // UpdateRR updates a DNS Resource Record
-func (nsu *NSUpdate) UpdateRR(record hookTypes.DNSRecord, ttl time.Duration) (err error) {
-	err = nsu.checkName(record.Name)
+func (nsu *NSUpdate) UpdateRR(ctx context.Context, record hookTypes.DNSRecord, ttl time.Duration) (err error) {
+	record.Name, err = nsu.normalizeName(record.Name)
 	if err == nil {
 		deleteCmd := nsu.buildDeleteCommand(record.Name, record.Type)
 		addCmd := nsu.buildAddCommand(record.Name, record.Type, record.Value, ttl)
 		cmd := fmt.Sprintf("%v\n%v", deleteCmd, addCmd)
 		logrus.Infof("cmd to be executed: %s", cmd)
-		err = nsu.ExecuteCommand(cmd)
+		err = nsu.ExecuteCommand(ctx, cmd)
+	}
+	if err == nil && nsu.Verify {
+		err = nsu.verify(ctx, record.Name, record.Type, record.Value, ttl, true)
 	}
 	return
 }
 
-// ExecuteCommand executes a given nsupdate command
-func (nsu *NSUpdate) ExecuteCommand(cmd string) (err error) {
+// ExecuteCommand executes a given nsupdate command; the nsupdate process is killed when the context is done or the update timeout expires
+func (nsu *NSUpdate) ExecuteCommand(ctx context.Context, cmd string) (err error) {
+	if nsu.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, nsu.Timeout)
+		defer cancel()
+	}
+
 	fileName, err := nsu.BuildCmdFile(cmd)
 	if err == nil {
 		logrus.Infof("Created the nsupdate cmd file %s successfully", fileName)
-		err = nsu.ExecCmdFile(fileName)
+		err = nsu.Retry.Do(ctx, func(ctx context.Context) error { return nsu.ExecCmdFile(ctx, fileName) })
 		if err == nil {
 			logrus.Infof("Executes cmd %s successfully", cmd)
 		}
@@ -116,15 +168,17 @@ func (nsu *NSUpdate) BuildCmdFile(cmd string) (fileName string, err error) {
 	return
 }
 
-// ExecCmdFile executes an nsupdate cmd file
-func (nsu *NSUpdate) ExecCmdFile(filePath string) (err error) {
+// ExecCmdFile executes an nsupdate cmd file; the nsupdate process is killed when the context is done
+func (nsu *NSUpdate) ExecCmdFile(ctx context.Context, filePath string) (err error) {
 	keyFilePath := nsu.getKeyFilePath()
 	// The -v option makes nsupdate use a TCP connection.
-	exe := exec.Command("nsupdate", "-v", "-k", keyFilePath, filePath)
+	exe := exec.CommandContext(ctx, "nsupdate", "-v", "-k", keyFilePath, filePath)
 	msg, err := exe.CombinedOutput()
 
-	if err != nil {
-		err = fmt.Errorf("error executing command file %s: %s %s", exe.Path, err.Error(), string(msg))
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = fmt.Errorf("nsupdate execution of command file %s interrupted: %w", filePath, ctxErr)
+	} else if err != nil {
+		err = newCommandError(exe.Path, err, string(msg))
 	}
 	return
 }
@@ -1,9 +1,12 @@
 package nsupdate
 
 import (
+	"context"
+	"errors"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 )
 
 const basePath = "./data"
@@ -161,3 +164,14 @@ func TestBuilder_New(t *testing.T) {
 		})
 	}
 }
+
+func TestNSUpdate_ExecuteCommandCancelled(t *testing.T) {
+	nsu := &NSUpdate{Builder{Server: "localhost", Port: "53", KeyFile: "Ktest.com.+157+50086.key", Zone: "test.com", Timeout: time.Minute}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := nsu.ExecuteCommand(ctx, nsu.buildDeleteCommand("a.test.com", "A"))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a context.Canceled error, got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package nsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+// RecordQuerier defines an interface to query the records served by the DNS Server for a name and type
+type RecordQuerier interface {
+	QueryRecord(ctx context.Context, name, recordType string) (*Answer, error)
+}
+
+// Answer describes the answer of the nameserver to a query for the records of a name and type
+type Answer struct {
+	Rcode         string `json:"rcode"`
+	Authoritative bool   `json:"authoritative"`
+	// Serial the SOA serial of the zone served by the nameserver; unset when it could not be read
+	Serial  *uint32        `json:"serial,omitempty"`
+	Records []ServedRecord `json:"records"`
+	owner   string
+	rrs     []dns.RR
+}
+
+// ServedRecord a record served by the nameserver, its value being in the zone file format
+type ServedRecord struct {
+	Value string `json:"value"`
+	TTL   uint32 `json:"ttl"`
+}
+
+// Check returns why the answer differs from the record of the type with the value and the TTL being the only one served;
+// empty when it does not
+func (a *Answer) Check(recordType, value string, ttl time.Duration) string {
+	expected, err := newRR(a.owner, recordType, value, ttl)
+	if err != nil {
+		return fmt.Sprintf("the value '%s' cannot be parsed: %v", value, err)
+	}
+	return compare(expected, a.rrs, true)
+}
+
+// QueryRecord asks the nameserver for the records of the name and type, along with the SOA serial of the zone
+func (nsu *NSUpdate) QueryRecord(ctx context.Context, name, recordType string) (*Answer, error) {
+	name, err := nsu.normalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+	recordType = strings.ToUpper(recordType)
+	qtype, ok := dns.StringToType[recordType]
+	if !ok {
+		return nil, types.BadRequestError(fmt.Sprintf("the record type '%s' is not known", recordType), nil)
+	}
+
+	owner := dns.Fqdn(nsu.getOwnerName(name))
+	msg, err := nsu.exchange(ctx, nsu.address(), owner, qtype)
+	if err != nil {
+		return nil, err
+	}
+	answer := &Answer{Rcode: dns.RcodeToString[msg.Rcode], Authoritative: msg.Authoritative, Records: []ServedRecord{}, owner: owner}
+	for _, rr := range filter(msg, owner, qtype) {
+		answer.rrs = append(answer.rrs, rr)
+		answer.Records = append(answer.Records, ServedRecord{Value: rdata(rr), TTL: rr.Header().Ttl})
+	}
+	if serial, err := nsu.Serial(ctx, ""); err == nil {
+		answer.Serial = &serial
+	} else {
+		logrus.Warnf("Not possible to read the serial of the zone %s: %v", nsu.Zone, err)
+	}
+	return answer, nil
+}
+
+// address returns the address of the nameserver, as host:port
+func (nsu *NSUpdate) address() string {
+	return net.JoinHostPort(nsu.Server, nsu.Port)
+}
+
+// query asks the nameserver at address for the records of the owner name and type; it fails unless the nameserver answers
+// with the records or tells there are none
+func (nsu *NSUpdate) query(ctx context.Context, address, owner string, qtype uint16) ([]dns.RR, error) {
+	msg, err := nsu.exchange(ctx, address, owner, qtype)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("the nameserver answered %s", dns.RcodeToString[msg.Rcode])
+	}
+	return filter(msg, owner, qtype), nil
+}
+
+// exchange sends the query for the owner name and type to the nameserver at address, over TCP and without recursion
+func (nsu *NSUpdate) exchange(ctx context.Context, address, owner string, qtype uint16) (*dns.Msg, error) {
+	if nsu.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, nsu.Timeout)
+		defer cancel()
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(owner, qtype)
+	msg.RecursionDesired = false
+	answer, _, err := (&dns.Client{Net: "tcp"}).ExchangeContext(ctx, msg, address)
+	return answer, err
+}
+
+// filter returns the records of the answer section with the owner name and type
+func filter(msg *dns.Msg, owner string, qtype uint16) (records []dns.RR) {
+	for _, rr := range msg.Answer {
+		if rr.Header().Rrtype == qtype && strings.EqualFold(rr.Header().Name, owner) {
+			records = append(records, rr)
+		}
+	}
+	return
+}
+
+// newRR builds the record of the owner name and type with the value and the TTL
+func newRR(owner, recordType, value string, ttl time.Duration) (dns.RR, error) {
+	rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", owner, int(ttl.Seconds()), recordType, value))
+	if err == nil && rr == nil {
+		err = errors.New("empty record")
+	}
+	return rr, err
+}
+
+// rdata returns the value of the record in the zone file format
+func rdata(rr dns.RR) string {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+// compare returns why the records served differ from the expected record; empty when it is served, with its TTL, and is the
+// only one served when only is set
+func compare(expected dns.RR, served []dns.RR, only bool) string {
+	var found dns.RR
+	for _, rr := range served {
+		if dns.IsDuplicate(expected, rr) {
+			found = rr
+		}
+	}
+	switch {
+	case found == nil:
+		return "the record is not served"
+	case found.Header().Ttl != expected.Header().Ttl:
+		return fmt.Sprintf("the record is served with the TTL %d instead of %d", found.Header().Ttl, expected.Header().Ttl)
+	case only && len(served) > 1:
+		return "other records of the type are served"
+	}
+	return ""
+}
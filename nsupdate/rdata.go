@@ -0,0 +1,175 @@
+package nsupdate
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/labbsr0x/bindman-dns-webhook/src/types"
+)
+
+const (
+	// MaxTXTChunkLength the maximum length of a character string of a TXT record, in octets
+	MaxTXTChunkLength = 255
+	maxUint16         = 65535
+	maxUint8          = 255
+)
+
+// caaTags the property tags of CAA records defined by RFC 8659
+var caaTags = map[string]bool{"issue": true, "issuewild": true, "iodef": true}
+
+// RecordData is the structured payload of the MX, SRV, CAA and TXT records, rendered into their RDATA. Only the fields of
+// the type of the record may be set:
+//   - MX: Priority and Target
+//   - SRV: Priority, Weight, Port and Target
+//   - CAA: Flag, Tag and Value
+//   - TXT: Strings
+type RecordData struct {
+	Priority *int     `json:"priority,omitempty"`
+	Weight   *int     `json:"weight,omitempty"`
+	Port     *int     `json:"port,omitempty"`
+	Target   string   `json:"target,omitempty"`
+	Flag     *int     `json:"flag,omitempty"`
+	Tag      string   `json:"tag,omitempty"`
+	Value    string   `json:"value,omitempty"`
+	Strings  []string `json:"strings,omitempty"`
+}
+
+// RenderRDATA validates the payload of a record of the given type and renders it into the RDATA sent to the nameserver.
+// It returns a bad request error listing every problem found
+func RenderRDATA(recordType string, data *RecordData) (string, error) {
+	var errs []string
+	var rdata string
+	recordType = strings.ToUpper(recordType)
+	switch recordType {
+	case "MX":
+		errs = data.only(recordType, "priority", "target")
+		priority := checkNumber(&errs, "priority", data.Priority, maxUint16)
+		target := checkTarget(&errs, data.Target)
+		rdata = fmt.Sprintf("%d %s", priority, target)
+	case "SRV":
+		errs = data.only(recordType, "priority", "weight", "port", "target")
+		priority := checkNumber(&errs, "priority", data.Priority, maxUint16)
+		weight := checkNumber(&errs, "weight", data.Weight, maxUint16)
+		port := checkNumber(&errs, "port", data.Port, maxUint16)
+		target := checkTarget(&errs, data.Target)
+		rdata = fmt.Sprintf("%d %d %d %s", priority, weight, port, target)
+	case "CAA":
+		errs = data.only(recordType, "flag", "tag", "value")
+		flag := 0
+		if data.Flag != nil {
+			flag = checkNumber(&errs, "flag", data.Flag, maxUint8)
+		}
+		if !caaTags[data.Tag] {
+			errs = append(errs, fmt.Sprintf("the tag '%s' must be one of issue, issuewild or iodef", data.Tag))
+		}
+		checkText(&errs, "value", data.Value)
+		rdata = fmt.Sprintf("%d %s %s", flag, data.Tag, quote(data.Value))
+	case "TXT":
+		errs = data.only(recordType, "strings")
+		if len(data.Strings) == 0 {
+			errs = append(errs, "the strings must not be empty")
+		}
+		var chunks []string
+		for _, s := range data.Strings {
+			checkText(&errs, "strings", s)
+			for _, chunk := range chunk(s, MaxTXTChunkLength) {
+				chunks = append(chunks, quote(chunk))
+			}
+		}
+		rdata = strings.Join(chunks, " ")
+	default:
+		return "", types.BadRequestError(fmt.Sprintf("Structured data is not supported for records of type '%s'; use the value instead", recordType), nil)
+	}
+
+	if len(errs) > 0 {
+		return "", types.BadRequestError(fmt.Sprintf("Invalid data for a record of type '%s'", recordType), nil, errs...)
+	}
+	return rdata, nil
+}
+
+// only returns an error for every field set other than the given ones
+func (data *RecordData) only(recordType string, fields ...string) (errs []string) {
+	set := map[string]bool{
+		"priority": data.Priority != nil,
+		"weight":   data.Weight != nil,
+		"port":     data.Port != nil,
+		"target":   data.Target != "",
+		"flag":     data.Flag != nil,
+		"tag":      data.Tag != "",
+		"value":    data.Value != "",
+		"strings":  data.Strings != nil,
+	}
+	for _, field := range fields {
+		delete(set, field)
+	}
+	for _, field := range []string{"priority", "weight", "port", "target", "flag", "tag", "value", "strings"} {
+		if set[field] {
+			errs = append(errs, fmt.Sprintf("the field '%s' does not apply to records of type '%s'", field, recordType))
+		}
+	}
+	return
+}
+
+// checkNumber checks the field is set and between 0 and max, returning its value
+func checkNumber(errs *[]string, field string, value *int, max int) int {
+	if value == nil {
+		*errs = append(*errs, fmt.Sprintf("the field '%s' must be set", field))
+		return 0
+	}
+	if *value < 0 || *value > max {
+		*errs = append(*errs, fmt.Sprintf("the field '%s' must be between 0 and %d", field, max))
+	}
+	return *value
+}
+
+// checkTarget checks the target is a valid domain name, returning it fully qualified. The root "." is allowed, meaning
+// there is no target: a null MX or an unavailable SRV service
+func checkTarget(errs *[]string, target string) string {
+	if target == "." {
+		return target
+	}
+	canonical, err := NormalizeName(target)
+	if err != nil {
+		*errs = append(*errs, fmt.Sprintf("the target '%s' is not a valid domain name", target))
+		return target
+	}
+	return canonical + "."
+}
+
+// checkText checks the text has no control characters, which would break the commands sent to the nameserver
+func checkText(errs *[]string, field, text string) {
+	for _, c := range text {
+		if unicode.IsControl(c) {
+			*errs = append(*errs, fmt.Sprintf("the field '%s' must not have control characters", field))
+			return
+		}
+	}
+}
+
+// quote returns the string as a quoted character string, escaping the quotes and backslashes
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// chunk splits the string in chunks of at most size bytes, not splitting multi-byte characters
+func chunk(s string, size int) []string {
+	if s == "" {
+		return []string{s}
+	}
+	var chunks []string
+	for len(s) > size {
+		i := size
+		for i > 0 && !isRuneStart(s[i]) {
+			i--
+		}
+		chunks = append(chunks, s[:i])
+		s = s[i:]
+	}
+	return append(chunks, s)
+}
+
+// isRuneStart tells whether the byte starts an UTF-8 encoded character
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,55 @@
+package nsupdate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderRDATA(t *testing.T) {
+	n := func(v int) *int { return &v }
+	long := strings.Repeat("a", MaxTXTChunkLength)
+	tests := []struct {
+		name       string
+		recordType string
+		data       RecordData
+		expected   string
+		wantErr    bool
+	}{
+		{"mx", "MX", RecordData{Priority: n(10), Target: "Mail.Test.com"}, "10 mail.test.com.", false},
+		{"mx lower cased type", "mx", RecordData{Priority: n(0), Target: "mail.test.com."}, "0 mail.test.com.", false},
+		{"mx without priority", "MX", RecordData{Target: "mail.test.com"}, "", true},
+		{"mx priority out of range", "MX", RecordData{Priority: n(65536), Target: "mail.test.com"}, "", true},
+		{"mx invalid target", "MX", RecordData{Priority: n(10), Target: "mail test.com"}, "", true},
+		{"null mx", "MX", RecordData{Priority: n(0), Target: "."}, "0 .", false},
+		{"mx without target", "MX", RecordData{Priority: n(10)}, "", true},
+		{"mx with port", "MX", RecordData{Priority: n(10), Port: n(25), Target: "mail.test.com"}, "", true},
+		{"srv", "SRV", RecordData{Priority: n(10), Weight: n(5), Port: n(5060), Target: "sip.test.com"}, "10 5 5060 sip.test.com.", false},
+		{"srv no target", "SRV", RecordData{Priority: n(0), Weight: n(0), Port: n(0), Target: "."}, "0 0 0 .", false},
+		{"srv without port", "SRV", RecordData{Priority: n(10), Weight: n(5), Target: "sip.test.com"}, "", true},
+		{"srv negative weight", "SRV", RecordData{Priority: n(10), Weight: n(-1), Port: n(5060), Target: "sip.test.com"}, "", true},
+		{"caa", "CAA", RecordData{Tag: "issue", Value: "letsencrypt.org"}, `0 issue "letsencrypt.org"`, false},
+		{"caa critical", "CAA", RecordData{Flag: n(128), Tag: "iodef", Value: `mailto:"ca"@test.com`}, `128 iodef "mailto:\"ca\"@test.com"`, false},
+		{"caa flag out of range", "CAA", RecordData{Flag: n(256), Tag: "issue", Value: "ca.org"}, "", true},
+		{"caa unknown tag", "CAA", RecordData{Tag: "other", Value: "ca.org"}, "", true},
+		{"caa control characters", "CAA", RecordData{Tag: "issue", Value: "ca.org\nupdate delete test.com"}, "", true},
+		{"txt", "TXT", RecordData{Strings: []string{"v=spf1 -all", `a "quoted" \ value`}}, `"v=spf1 -all" "a \"quoted\" \\ value"`, false},
+		{"txt empty string", "TXT", RecordData{Strings: []string{""}}, `""`, false},
+		{"txt chunked", "TXT", RecordData{Strings: []string{long + "b"}}, `"` + long + `" "b"`, false},
+		{"txt chunked on characters", "TXT", RecordData{Strings: []string{long[1:] + "é"}}, `"` + long[1:] + `" "é"`, false},
+		{"txt without strings", "TXT", RecordData{}, "", true},
+		{"txt with value", "TXT", RecordData{Strings: []string{"a"}, Value: "a"}, "", true},
+		{"unsupported type", "A", RecordData{Value: "0.0.0.1"}, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := RenderRDATA(test.recordType, &test.data)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("RenderRDATA() err = %v, want an error: %v", err, test.wantErr)
+			}
+			if got != test.expected {
+				t.Errorf("RenderRDATA() = %v, want %v", got, test.expected)
+			}
+		})
+	}
+}
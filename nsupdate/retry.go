@@ -0,0 +1,144 @@
+package nsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RcodeTimeout identifies nsupdate failures caused by the nameserver not answering in time
+	RcodeTimeout = "TIMEOUT"
+	// RcodeConnRefused identifies nsupdate failures caused by the nameserver refusing the connection
+	RcodeConnRefused = "CONNREFUSED"
+)
+
+var (
+	updateFailedPattern = regexp.MustCompile(`update failed: ([A-Z]+)`)
+	timeoutPattern      = regexp.MustCompile(`(?i)timed out|couldn't talk to`)
+	connRefusedPattern  = regexp.MustCompile(`(?i)connection refused`)
+)
+
+// CommandError holds the details of a failed nsupdate execution
+type CommandError struct {
+	// Path the path of the executed nsupdate binary
+	Path string
+	// Rcode the DNS response code or the transport condition that caused the failure
+	Rcode string
+	// Output the combined output of the nsupdate process
+	Output string
+	// Err the error returned when executing the nsupdate process
+	Err error
+}
+
+// Error gives a string representation of the failed execution
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("error executing command file %s: %s %s", e.Path, e.Err.Error(), e.Output)
+}
+
+// Unwrap returns the error returned when executing the nsupdate process
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// newCommandError builds a CommandError classifying the nsupdate output
+func newCommandError(path string, err error, output string) *CommandError {
+	return &CommandError{Path: path, Rcode: classifyOutput(output), Output: output, Err: err}
+}
+
+// classifyOutput extracts the rcode or transport condition from the nsupdate output; it returns an empty string when none is identified
+func classifyOutput(output string) string {
+	if m := updateFailedPattern.FindStringSubmatch(output); m != nil {
+		return m[1]
+	}
+	if connRefusedPattern.MatchString(output) {
+		return RcodeConnRefused
+	}
+	if timeoutPattern.MatchString(output) {
+		return RcodeTimeout
+	}
+	return ""
+}
+
+// RetryPolicy defines how transient nsupdate failures are retried
+type RetryPolicy struct {
+	// Attempts the maximum number of times a command is executed; values lower than one mean a single attempt
+	Attempts int
+	// InitialBackoff the upper bound of the wait before the first retry; it doubles on every attempt
+	InitialBackoff time.Duration
+	// MaxBackoff the maximum upper bound of the wait between two attempts
+	MaxBackoff time.Duration
+	// MaxElapsed the maximum time spent retrying a command; zero means no limit
+	MaxElapsed time.Duration
+	// RetryableRcodes the rcodes and transport conditions considered transient
+	RetryableRcodes []string
+}
+
+// IsRetryable tells if the error was caused by a transient condition according to the policy
+func (p *RetryPolicy) IsRetryable(err error) bool {
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Rcode == "" {
+		return false
+	}
+	for _, rcode := range p.RetryableRcodes {
+		if strings.EqualFold(strings.TrimSpace(rcode), cmdErr.Rcode) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the wait before the given retry, using exponential backoff with full jitter
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	ceiling := p.InitialBackoff
+	for i := 0; i < retry && (p.MaxBackoff <= 0 || ceiling < p.MaxBackoff); i++ {
+		ceiling *= 2
+	}
+	if p.MaxBackoff > 0 && ceiling > p.MaxBackoff {
+		ceiling = p.MaxBackoff
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// Do runs fn until it succeeds, fails with a non transient error, the policy limits are reached or the context is done
+func (p *RetryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	return p.do(ctx, fn, func(d time.Duration) error {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// do is Do with a pluggable sleep function
+func (p *RetryPolicy) do(ctx context.Context, fn func(ctx context.Context) error, sleep func(time.Duration) error) (err error) {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err = fn(ctx)
+		if err == nil || attempt >= p.Attempts || !p.IsRetryable(err) || ctx.Err() != nil {
+			return
+		}
+		wait := p.backoff(attempt - 1)
+		if p.MaxElapsed > 0 && time.Since(start)+wait > p.MaxElapsed {
+			logrus.Warnf("Giving up retrying after %d attempts: max elapsed time of %v reached", attempt, p.MaxElapsed)
+			return
+		}
+		logrus.Warnf("Attempt %d failed with a transient error; retrying in %v: %v", attempt, wait, err)
+		if sleepErr := sleep(wait); sleepErr != nil {
+			return
+		}
+	}
+}
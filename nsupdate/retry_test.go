@@ -0,0 +1,172 @@
+package nsupdate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClassifyOutput(t *testing.T) {
+	tests := []struct {
+		output   string
+		expected string
+	}{
+		{"update failed: SERVFAIL\n", "SERVFAIL"},
+		{"update failed: REFUSED\n", "REFUSED"},
+		{"update failed: NOTAUTH\n", "NOTAUTH"},
+		{"update failed: NOTZONE\n", "NOTZONE"},
+		{"; Communication with 10.0.0.1#53 failed: timed out\n", RcodeTimeout},
+		{"; Communication with 10.0.0.1#53 failed: connection refused\n", RcodeConnRefused},
+		{"; couldn't talk to any default nameserver\n", RcodeTimeout},
+		{"could not read key from Ktest.com.+157+50086.key\n", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.output, func(t *testing.T) {
+			if got := classifyOutput(test.output); got != test.expected {
+				t.Errorf("classifyOutput() = %v, want %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_IsRetryable(t *testing.T) {
+	policy := RetryPolicy{RetryableRcodes: []string{"SERVFAIL", "timeout", RcodeConnRefused}}
+
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"servfail", &CommandError{Rcode: "SERVFAIL"}, true},
+		{"case insensitive", &CommandError{Rcode: RcodeTimeout}, true},
+		{"connection refused", &CommandError{Rcode: RcodeConnRefused}, true},
+		{"refused", &CommandError{Rcode: "REFUSED"}, false},
+		{"notauth", &CommandError{Rcode: "NOTAUTH"}, false},
+		{"notzone", &CommandError{Rcode: "NOTZONE"}, false},
+		{"unknown", &CommandError{}, false},
+		{"not a command error", errors.New("any"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := policy.IsRetryable(test.err); got != test.expected {
+				t.Errorf("IsRetryable() = %v, want %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Do(t *testing.T) {
+	transient := &CommandError{Rcode: "SERVFAIL", Err: errors.New("exit status 2")}
+	permanent := &CommandError{Rcode: "REFUSED", Err: errors.New("exit status 2")}
+
+	tests := []struct {
+		name        string
+		policy      RetryPolicy
+		errs        []error
+		wantCalls   int
+		wantSuccess bool
+	}{
+		{
+			name:        "success at first attempt",
+			policy:      RetryPolicy{Attempts: 3, RetryableRcodes: []string{"SERVFAIL"}},
+			errs:        []error{nil},
+			wantCalls:   1,
+			wantSuccess: true,
+		},
+		{
+			name:        "success after transient errors",
+			policy:      RetryPolicy{Attempts: 3, InitialBackoff: time.Second, RetryableRcodes: []string{"SERVFAIL"}},
+			errs:        []error{transient, transient, nil},
+			wantCalls:   3,
+			wantSuccess: true,
+		},
+		{
+			name:      "gives up after all attempts",
+			policy:    RetryPolicy{Attempts: 3, RetryableRcodes: []string{"SERVFAIL"}},
+			errs:      []error{transient, transient, transient, nil},
+			wantCalls: 3,
+		},
+		{
+			name:      "permanent errors are not retried",
+			policy:    RetryPolicy{Attempts: 3, RetryableRcodes: []string{"SERVFAIL"}},
+			errs:      []error{permanent, nil},
+			wantCalls: 1,
+		},
+		{
+			name:      "zero attempts means a single attempt",
+			policy:    RetryPolicy{RetryableRcodes: []string{"SERVFAIL"}},
+			errs:      []error{transient, nil},
+			wantCalls: 1,
+		},
+		{
+			name:      "gives up when the max elapsed time would be exceeded",
+			policy:    RetryPolicy{Attempts: 10, InitialBackoff: time.Hour, MaxBackoff: time.Hour, MaxElapsed: time.Nanosecond, RetryableRcodes: []string{"SERVFAIL"}},
+			errs:      []error{transient, nil},
+			wantCalls: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			err := test.policy.do(context.Background(), func(_ context.Context) error {
+				calls++
+				return test.errs[calls-1]
+			}, func(d time.Duration) error {
+				if test.policy.MaxBackoff > 0 && d > test.policy.MaxBackoff {
+					t.Errorf("waited %v, which is longer than the max backoff %v", d, test.policy.MaxBackoff)
+				}
+				return nil
+			})
+			if calls != test.wantCalls {
+				t.Errorf("expected %d calls, got %d", test.wantCalls, calls)
+			}
+			if (err == nil) != test.wantSuccess {
+				t.Errorf("expected success = %v, got err %v", test.wantSuccess, err)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_DoCancelled(t *testing.T) {
+	policy := RetryPolicy{Attempts: 10, InitialBackoff: time.Hour, RetryableRcodes: []string{"SERVFAIL"}}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	done := make(chan error)
+	go func() {
+		done <- policy.Do(ctx, func(_ context.Context) error {
+			calls++
+			return &CommandError{Rcode: "SERVFAIL", Err: errors.New("exit status 2")}
+		})
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected the last error to be returned")
+		}
+		if calls != 1 {
+			t.Errorf("expected 1 call, got %d", calls)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the retry wait to be interrupted by the context cancellation")
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for retry := 0; retry < 10; retry++ {
+		ceiling := policy.InitialBackoff << uint(retry)
+		if ceiling > policy.MaxBackoff {
+			ceiling = policy.MaxBackoff
+		}
+		if got := policy.backoff(retry); got < 0 || got >= ceiling {
+			t.Errorf("backoff(%d) = %v, want a value in [0, %v)", retry, got, ceiling)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package nsupdate
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ReverseName returns the name of the PTR record of the IPv4 or IPv6 address: the octets of an IPv4 address reversed under
+// in-addr.arpa, or the nibbles of an IPv6 address reversed under ip6.arpa
+func ReverseName(address string) (string, error) {
+	ip := net.ParseIP(strings.TrimSpace(address))
+	if ip == nil {
+		return "", fmt.Errorf("'%s' is not an IP address", address)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", ip4[3], ip4[2], ip4[1], ip4[0]), nil
+	}
+	var b strings.Builder
+	for i := len(ip) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "%x.%x.", ip[i]&0x0f, ip[i]>>4)
+	}
+	b.WriteString("ip6.arpa")
+	return b.String(), nil
+}
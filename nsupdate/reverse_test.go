@@ -0,0 +1,52 @@
+package nsupdate
+
+import "testing"
+
+func TestReverseName(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected string
+		wantErr  bool
+	}{
+		{"10.0.1.2", "2.1.0.10.in-addr.arpa", false},
+		{"::ffff:10.0.1.2", "2.1.0.10.in-addr.arpa", false},
+		{"2001:db8::567:89ab", "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa", false},
+		{"app.test.com", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.address, func(t *testing.T) {
+			got, err := ReverseName(test.address)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ReverseName() err = %v, want an error: %v", err, test.wantErr)
+			}
+			if got != test.expected {
+				t.Errorf("ReverseName() = %v, want %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestBuilder_NewReverse(t *testing.T) {
+	b := &Builder{Server: "bind", KeyFile: "Ktest.com.key", Zone: "test.com"}
+	if reverse, err := b.NewReverse(basePath); reverse != nil || err != nil {
+		t.Fatalf("Expecting no reverse NSUpdate without a reverse zone. Got %v and err '%v'", reverse, err)
+	}
+
+	b.ReverseZone = "0.10.in-addr.arpa"
+	reverse, err := b.NewReverse(basePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reverse.Zone != b.ReverseZone || reverse.KeyFile != b.KeyFile || reverse.Server != b.Server {
+		t.Errorf("Expecting the reverse zone with the key of the zone. Got %+v", reverse)
+	}
+	if !reverse.InZone("2.1.0.10.in-addr.arpa") || reverse.InZone("2.1.0.11.in-addr.arpa") {
+		t.Error("Expecting only the names of the reverse zone to be in the zone")
+	}
+
+	b.ReverseKeyFile = "K0.10.in-addr.arpa.key"
+	if reverse, _ = b.NewReverse(basePath); reverse.KeyFile != b.ReverseKeyFile {
+		t.Errorf("Expecting the key of the reverse zone. Got %s", reverse.KeyFile)
+	}
+}
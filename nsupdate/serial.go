@@ -0,0 +1,29 @@
+package nsupdate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// SerialQuerier defines an interface to query the SOA serial of the zone served by a nameserver
+type SerialQuerier interface {
+	// Serial returns the SOA serial of the zone served by the nameserver at address, as host:port; empty means the nameserver updated
+	Serial(ctx context.Context, address string) (uint32, error)
+}
+
+// Serial returns the SOA serial of the zone served by the nameserver at address, as host:port; empty means the nameserver updated
+func (nsu *NSUpdate) Serial(ctx context.Context, address string) (uint32, error) {
+	if address == "" {
+		address = nsu.address()
+	}
+	records, err := nsu.query(ctx, address, dns.Fqdn(nsu.Zone), dns.TypeSOA)
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, fmt.Errorf("the nameserver %s does not serve the zone %s", address, nsu.Zone)
+	}
+	return records[0].(*dns.SOA).Serial, nil
+}
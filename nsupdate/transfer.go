@@ -0,0 +1,89 @@
+package nsupdate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/miekg/dns"
+)
+
+// infrastructureTypes the record types served for the zone itself or for DNSSEC, which are not managed as records
+var infrastructureTypes = map[string]bool{
+	"SOA": true, "NS": true, "RRSIG": true, "NSEC": true, "NSEC3": true, "NSEC3PARAM": true, "DNSKEY": true, "DS": true, "TSIG": true,
+}
+
+// TransferZone lists the records served for the zone by the nameserver, through a zone transfer (AXFR) authenticated with the key file.
+// Only the first value of a record with several values is kept
+func (nsu *NSUpdate) TransferZone(ctx context.Context) ([]hookTypes.DNSRecord, error) {
+	if nsu.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, nsu.Timeout)
+		defer cancel()
+	}
+	key, err := readTSIGKey(nsu.getKeyFilePath())
+	if err != nil {
+		return nil, err
+	}
+
+	zone := dns.Fqdn(nsu.Zone)
+	msg := new(dns.Msg)
+	msg.SetAxfr(zone)
+	msg.SetTsig(key.Name, key.Algorithm, 300, time.Now().Unix())
+	transfer := &dns.Transfer{TsigSecret: map[string]string{key.Name: key.Secret}}
+	if nsu.Timeout > 0 {
+		transfer.DialTimeout, transfer.ReadTimeout = nsu.Timeout, nsu.Timeout
+	}
+	envelopes, err := transfer.In(msg, nsu.address())
+	if err != nil {
+		return nil, fmt.Errorf("transfer of the zone %s failed: %w", nsu.Zone, err)
+	}
+	// closing the connection ends the transfer when the context is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = transfer.Conn.Close()
+		case <-done:
+		}
+	}()
+
+	var rrs []dns.RR
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			err = envelope.Error
+			continue
+		}
+		rrs = append(rrs, envelope.RR...)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, fmt.Errorf("transfer of the zone %s interrupted: %w", nsu.Zone, ctxErr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("transfer of the zone %s failed: %w", nsu.Zone, err)
+	}
+	return zoneRecords(rrs), nil
+}
+
+// zoneRecords returns the records of a zone transfer, leaving out the infrastructure records and the values of a record
+// but the first one
+func zoneRecords(rrs []dns.RR) (records []hookTypes.DNSRecord) {
+	seen := make(map[string]bool)
+	for _, rr := range rrs {
+		recordType := dns.TypeToString[rr.Header().Rrtype]
+		if infrastructureTypes[recordType] {
+			continue
+		}
+		name := strings.TrimSuffix(rr.Header().Name, ".")
+		key := strings.ToLower(name) + " " + recordType
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		records = append(records, hookTypes.DNSRecord{Name: name, Type: recordType, Value: rdata(rr)})
+	}
+	return
+}
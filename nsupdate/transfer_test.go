@@ -0,0 +1,148 @@
+package nsupdate
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	hookTypes "github.com/labbsr0x/bindman-dns-webhook/src/types"
+	"github.com/miekg/dns"
+)
+
+const (
+	transferBasePath = "./data-transfer"
+	transferSecret   = "c2VjcmV0LWtleS1vZi10aGUtdGVzdA=="
+)
+
+// newRRs parses the records, in the zone file format
+func newRRs(t *testing.T, records ...string) (rrs []dns.RR) {
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rrs = append(rrs, rr)
+	}
+	return
+}
+
+// serveTransfer serves the records as the transfer of the test.com zone, to the clients authenticated by the key test.com
+func serveTransfer(t *testing.T, rrs []dns.RR) (port string, shutdown func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		answer := new(dns.Msg)
+		answer.SetReply(r)
+		if r.IsTsig() == nil || w.TsigStatus() != nil || r.Question[0].Qtype != dns.TypeAXFR {
+			answer.Rcode = dns.RcodeRefused
+		} else {
+			answer.Answer = rrs
+			answer.SetTsig("test.com.", dns.HmacMD5, 300, time.Now().Unix())
+		}
+		_ = w.WriteMsg(answer)
+	})
+	started := make(chan struct{})
+	server := &dns.Server{Listener: listener, Handler: handler, TsigSecret: map[string]string{"test.com.": transferSecret}, NotifyStartedFunc: func() { close(started) }}
+	go func() { _ = server.ActivateAndServe() }()
+	<-started
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port), func() { _ = server.Shutdown() }
+}
+
+func TestNSUpdate_TransferZone(t *testing.T) {
+	_ = os.RemoveAll(transferBasePath)
+	defer os.RemoveAll(transferBasePath)
+	if err := os.MkdirAll(transferBasePath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := "Ktest.com.+157+12345.key"
+	if err := ioutil.WriteFile(filepath.Join(transferBasePath, keyFile), []byte("test.com. IN KEY 512 3 157 "+transferSecret+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	port, shutdown := serveTransfer(t, newRRs(t,
+		"test.com. 3600 IN SOA ns.test.com. admin.test.com. 10 3600 600 86400 3600",
+		"app.test.com. 100 IN A 10.0.0.1",
+		"txt.test.com. 100 IN TXT \"v=spf1 -all\" \"second\"",
+		"test.com. 3600 IN SOA ns.test.com. admin.test.com. 10 3600 600 86400 3600",
+	))
+	defer shutdown()
+
+	nsu := &NSUpdate{Builder{Server: "127.0.0.1", Port: port, Zone: "test.com", KeyFile: keyFile, BasePath: transferBasePath, Timeout: time.Second}}
+	records, err := nsu.TransferZone(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []hookTypes.DNSRecord{
+		{Name: "app.test.com", Value: "10.0.0.1", Type: "A"},
+		{Name: "txt.test.com", Value: `"v=spf1 -all" "second"`, Type: "TXT"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("TransferZone() = %v, want %v", records, expected)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(transferBasePath, keyFile), []byte("test.com. IN KEY 512 3 157 b3RoZXItc2VjcmV0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nsu.TransferZone(context.Background()); err == nil {
+		t.Error("Expecting the transfer to fail with another key")
+	}
+}
+
+func TestZoneRecords(t *testing.T) {
+	rrs := newRRs(t,
+		"test.com. 3600 IN SOA ns.test.com. admin.test.com. 10 3600 600 86400 3600",
+		"test.com. 3600 IN NS ns.test.com.",
+		"app.test.com. 100 IN A 10.0.0.1",
+		"App.test.com. 100 IN A 10.0.0.2",
+		"www.test.com. 100 IN cname app.test.com.",
+		"txt.test.com. 100 IN TXT \"v=spf1\" \"-all\"",
+		"test.com. 3600 IN SOA ns.test.com. admin.test.com. 10 3600 600 86400 3600",
+	)
+	expected := []hookTypes.DNSRecord{
+		{Name: "app.test.com", Value: "10.0.0.1", Type: "A"},
+		{Name: "www.test.com", Value: "app.test.com.", Type: "CNAME"},
+		{Name: "txt.test.com", Value: `"v=spf1" "-all"`, Type: "TXT"},
+	}
+	if got := zoneRecords(rrs); !reflect.DeepEqual(got, expected) {
+		t.Errorf("zoneRecords() = %v, want %v", got, expected)
+	}
+}
+
+func TestReadTSIGKey(t *testing.T) {
+	_ = os.RemoveAll(transferBasePath)
+	defer os.RemoveAll(transferBasePath)
+	if err := os.MkdirAll(transferBasePath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"Ktest.com.+157+12345.key":     "test.com. IN KEY 512 3 157 " + transferSecret + "\n",
+		"Ktest.com.+157+12345.private": "Private-key-format: v1.3\nAlgorithm: 157 (HMAC_MD5)\nKey: " + transferSecret + "\nBits: AAA=\n",
+		"Ktest.com.+001+12345.key":     "test.com. IN KEY 512 3 1 " + transferSecret + "\n",
+		"garbage.key":                  "not a key",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(transferBasePath, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := &tsigKey{Name: "test.com.", Algorithm: dns.HmacMD5, Secret: transferSecret}
+	for _, name := range []string{"Ktest.com.+157+12345.key", "Ktest.com.+157+12345.private"} {
+		if key, err := readTSIGKey(filepath.Join(transferBasePath, name)); err != nil || !reflect.DeepEqual(key, expected) {
+			t.Errorf("readTSIGKey(%s) = %v, %v; want %v", name, key, err, expected)
+		}
+	}
+	for _, name := range []string{"Ktest.com.+001+12345.key", "garbage.key", "missing.key"} {
+		if _, err := readTSIGKey(filepath.Join(transferBasePath, name)); err == nil {
+			t.Errorf("Expecting readTSIGKey(%s) to fail", name)
+		}
+	}
+}
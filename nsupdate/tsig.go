@@ -0,0 +1,80 @@
+package nsupdate
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// tsigAlgorithms the TSIG algorithms by number of the HMAC algorithms of the keys made by dnssec-keygen
+var tsigAlgorithms = map[uint8]string{157: dns.HmacMD5, 161: dns.HmacSHA1, 163: dns.HmacSHA256, 165: dns.HmacSHA512}
+
+// tsigKey the key authenticating the messages sent to the nameserver
+type tsigKey struct {
+	// Name the name of the key, in canonical form
+	Name      string
+	Algorithm string
+	// Secret the base64 encoded secret
+	Secret string
+}
+
+// readTSIGKey reads the key made by dnssec-keygen, from its public K<name>.+<algorithm>+<id>.key file or its .private one,
+// as nsupdate does
+func readTSIGKey(path string) (*tsigKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("not possible to read the key file '%s': %v", path, err)
+	}
+	if strings.HasSuffix(path, ".private") {
+		return parsePrivateKey(filepath.Base(path), string(b))
+	}
+
+	rr, err := dns.NewRR(string(b))
+	key, ok := rr.(*dns.KEY)
+	if err != nil || !ok {
+		return nil, fmt.Errorf("the key file '%s' does not hold a KEY record: %v", path, err)
+	}
+	algorithm, ok := tsigAlgorithms[key.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("the algorithm %d of the key file '%s' is not supported", key.Algorithm, path)
+	}
+	return &tsigKey{Name: strings.ToLower(dns.Fqdn(key.Hdr.Name)), Algorithm: algorithm, Secret: key.PublicKey}, nil
+}
+
+// parsePrivateKey parses the content of the .private file of a key, whose name comes from the name of the file
+func parsePrivateKey(fileName, content string) (*tsigKey, error) {
+	parts := strings.SplitN(strings.TrimPrefix(fileName, "K"), "+", 2)
+	if !strings.HasPrefix(fileName, "K") || len(parts) != 2 {
+		return nil, fmt.Errorf("the name of the key file '%s' is not in the K<name>.+<algorithm>+<id>.private format", fileName)
+	}
+	key := &tsigKey{Name: strings.ToLower(dns.Fqdn(strings.TrimSuffix(parts[0], ".")))}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		field := strings.SplitN(scanner.Text(), ":", 2)
+		if len(field) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(field[1])
+		switch strings.TrimSpace(field[0]) {
+		case "Algorithm":
+			// such as "157 (HMAC_MD5)"
+			number, err := strconv.ParseUint(strings.SplitN(value, " ", 2)[0], 10, 8)
+			if err != nil || tsigAlgorithms[uint8(number)] == "" {
+				return nil, fmt.Errorf("the algorithm '%s' of the key file '%s' is not supported", value, fileName)
+			}
+			key.Algorithm = tsigAlgorithms[uint8(number)]
+		case "Key":
+			key.Secret = value
+		}
+	}
+	if key.Algorithm == "" || key.Secret == "" {
+		return nil, fmt.Errorf("the key file '%s' lacks the algorithm or the key", fileName)
+	}
+	return key, nil
+}
@@ -0,0 +1,87 @@
+package nsupdate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+// VerificationError reports a change accepted by the nameserver which is not served as expected once applied, as happens
+// when the update policy or the views of the nameserver do not match the zone being updated
+type VerificationError struct {
+	Name string
+	Type string
+	// Expected the record expected to be served, in the zone file format; empty when no record of the type is expected
+	Expected []string
+	// Served the records of the type actually served, in the zone file format
+	Served []string
+	Reason string
+	// QueryFailed tells the nameserver could not be queried, so whether the change is served is not known
+	QueryFailed bool
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("the %s record '%s' is not served as expected: %s", e.Type, e.Name, e.Reason)
+}
+
+// Verifies tells whether every change is verified by querying the nameserver once applied
+func (nsu *NSUpdate) Verifies() bool {
+	return nsu.Verify
+}
+
+// verify queries the nameserver for the records of the name and type, checking the record with the value and the TTL is served.
+// When only is set, it must be the only record of its type. When the value is empty, no record of the type must be served.
+// It returns a VerificationError when the records served are not the expected ones, or the nameserver cannot be queried,
+// telling both apart
+func (nsu *NSUpdate) verify(ctx context.Context, name, recordType, value string, ttl time.Duration, only bool) error {
+	recordType = strings.ToUpper(recordType)
+	owner := dns.Fqdn(nsu.getOwnerName(name))
+	qtype, ok := dns.StringToType[recordType]
+	if !ok {
+		logrus.Warnf("Not verifying the %s record '%s': the type is not known", recordType, name)
+		return nil
+	}
+
+	verr := &VerificationError{Name: name, Type: recordType}
+	var expected dns.RR
+	if value != "" {
+		rr, err := newRR(owner, recordType, value, ttl)
+		if err != nil {
+			logrus.Warnf("Not verifying the %s record '%s': the value '%s' cannot be parsed: %v", recordType, name, value, err)
+			return nil
+		}
+		expected = rr
+		verr.Expected = []string{rr.String()}
+	}
+
+	served, err := nsu.query(ctx, nsu.address(), owner, qtype)
+	if err != nil {
+		verr.Reason = fmt.Sprintf("the nameserver could not be queried: %v", err)
+		verr.QueryFailed = true
+		return verr
+	}
+	for _, rr := range served {
+		verr.Served = append(verr.Served, rr.String())
+	}
+
+	if expected == nil {
+		if len(served) > 0 {
+			verr.Reason = "the record is still served"
+			return verr
+		}
+		return nil
+	}
+	if verr.Reason = compare(expected, served, only); verr.Reason == "" {
+		return nil
+	}
+	return verr
+}
+
+// Verifier defines an interface for the DNSUpdater able to verify the changes are served once applied
+type Verifier interface {
+	Verifies() bool
+}
@@ -0,0 +1,113 @@
+package nsupdate
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// serveZone starts a nameserver answering over TCP with the records given in the zone file format; it returns its port
+func serveZone(t *testing.T, records ...string) (port string, shutdown func()) {
+	var rrs []dns.RR
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rrs = append(rrs, rr)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		answer := new(dns.Msg)
+		answer.SetReply(r)
+		answer.Authoritative = true
+		for _, rr := range rrs {
+			if rr.Header().Name == r.Question[0].Name && (rr.Header().Rrtype == r.Question[0].Qtype || r.Question[0].Qtype == dns.TypeANY) {
+				answer.Answer = append(answer.Answer, rr)
+			}
+		}
+		_ = w.WriteMsg(answer)
+	})
+	started := make(chan struct{})
+	server := &dns.Server{Listener: listener, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go func() { _ = server.ActivateAndServe() }()
+	<-started
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port), func() { _ = server.Shutdown() }
+}
+
+func TestNSUpdate_verify(t *testing.T) {
+	port, shutdown := serveZone(t,
+		"app.test.com. 3600 IN A 10.0.0.1",
+		"multi.test.com. 3600 IN A 10.0.0.1",
+		"multi.test.com. 3600 IN A 10.0.0.2",
+		"short.test.com. 60 IN A 10.0.0.1",
+		"www.test.com. 3600 IN CNAME app.test.com.",
+		"txt.test.com. 3600 IN TXT \"v=spf1 -all\"",
+	)
+	defer shutdown()
+	nsu := &NSUpdate{Builder{Server: "127.0.0.1", Port: port, Zone: "test.com", Timeout: time.Second}}
+
+	tests := []struct {
+		name       string
+		record     string
+		recordType string
+		value      string
+		only       bool
+		reason     string
+	}{
+		{"served", "app.test.com", "A", "10.0.0.1", true, ""},
+		{"served among others", "multi.test.com", "A", "10.0.0.2", false, ""},
+		{"served along with others", "multi.test.com", "A", "10.0.0.2", true, "other records of the type are served"},
+		{"not served", "app.test.com", "A", "10.0.0.9", false, "the record is not served"},
+		{"other ttl", "short.test.com", "A", "10.0.0.1", false, "the record is served with the TTL 60 instead of 3600"},
+		{"relative target", "www.test.com", "cname", "app.test.com", true, ""},
+		{"unquoted text split on spaces", "txt.test.com", "TXT", "v=spf1 -all", true, "the record is not served"},
+		{"quoted text", "txt.test.com", "TXT", `"v=spf1 -all"`, true, ""},
+		{"removed", "gone.test.com", "A", "", false, ""},
+		{"still served", "app.test.com", "A", "", false, "the record is still served"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := nsu.verify(context.Background(), test.record, test.recordType, test.value, time.Hour, test.only)
+			if test.reason == "" {
+				if err != nil {
+					t.Errorf("verify() err = %v, want none", err)
+				}
+				return
+			}
+			if verr, ok := err.(*VerificationError); !ok || verr.Reason != test.reason || verr.QueryFailed {
+				t.Errorf("verify() err = %v, want the reason '%s'", err, test.reason)
+			}
+		})
+	}
+
+	shutdown()
+	err := nsu.verify(context.Background(), "app.test.com", "A", "10.0.0.1", time.Hour, false)
+	if verr, ok := err.(*VerificationError); !ok || !verr.QueryFailed {
+		t.Errorf("verify() err = %v, want a VerificationError telling the nameserver cannot be queried", err)
+	}
+}
+
+func TestNSUpdate_Serial(t *testing.T) {
+	port, shutdown := serveZone(t, "test.com. 3600 IN SOA ns.test.com. admin.test.com. 42 3600 600 86400 3600")
+	defer shutdown()
+	nsu := &NSUpdate{Builder{Server: "127.0.0.1", Port: port, Zone: "test.com", Timeout: time.Second}}
+
+	for _, address := range []string{"", "127.0.0.1:" + port} {
+		if serial, err := nsu.Serial(context.Background(), address); err != nil || serial != 42 {
+			t.Errorf("Serial(%s) = %d, err %v, want 42", address, serial, err)
+		}
+	}
+	other := &NSUpdate{Builder{Server: "127.0.0.1", Port: port, Zone: "other.com", Timeout: time.Second}}
+	if _, err := other.Serial(context.Background(), ""); err == nil {
+		t.Error("Serial() want an error for a zone not served")
+	}
+}